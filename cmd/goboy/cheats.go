@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/Humpheh/goboy/pkg/gb"
+)
+
+// Get the options to apply the cheats given by the cheat and cheat-file
+// flags.
+func cheatOptions() []gb.GameboyOption {
+	var opts []gb.GameboyOption
+	if *cheatFile != "" {
+		opts = append(opts, gb.WithCheatFile(*cheatFile))
+	}
+	if *cheatCodes == "" {
+		return opts
+	}
+	var cheats []gb.Cheat
+	for _, code := range strings.Split(*cheatCodes, ",") {
+		cheat, err := gb.ParseCheat(code)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cheats = append(cheats, cheat)
+	}
+	return append(opts, gb.WithCheats(cheats...))
+}
+
+// Run the cheat command in the debugger, which lists, adds, enables,
+// disables, deletes or saves the cheats.
+func runCheatCommand(gameboy *gb.Gameboy, args []string) error {
+	cheats := gameboy.Cheats()
+	if len(args) == 0 {
+		for i, cheat := range cheats.List() {
+			fmt.Printf("cheat %v: %v\n", i, cheat)
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: cheat add code [name]")
+		}
+		index, err := cheats.AddCode(args[1], strings.Join(args[2:], " "))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("cheat %v: %v\n", index, cheats.List()[index])
+
+	case "on", "off", "delete":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: cheat %s index", args[0])
+		}
+		index, err := strconv.Atoi(args[1])
+		if err != nil {
+			return err
+		}
+		if index < 0 || index >= len(cheats.List()) {
+			return fmt.Errorf("no cheat %v", index)
+		}
+		if args[0] == "delete" {
+			cheats.Remove(index)
+		} else {
+			cheats.SetEnabled(index, args[0] == "on")
+		}
+
+	case "save":
+		filename := gameboy.GetLoadedCart().GetCheatFilename()
+		if len(args) > 1 {
+			filename = args[1]
+		}
+		if filename == "" {
+			return fmt.Errorf("usage: cheat save file")
+		}
+		if err := cheats.SaveFile(filename); err != nil {
+			return err
+		}
+		fmt.Printf("saved cheats to %s\n", filename)
+
+	default:
+		return fmt.Errorf("unknown cheat command %q", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/Humpheh/goboy/pkg/disasm"
+	"github.com/Humpheh/goboy/pkg/gb"
+	"github.com/Humpheh/goboy/pkg/headless"
+)
+
+const debugHelp = `Commands:
+  break location        add a breakpoint at addr, bank:addr or a label (b)
+  watch addr[-end] [r|w|rw]
+                        add a memory watchpoint (w)
+  delete b|w index      delete a breakpoint or watchpoint (d)
+  list                  list breakpoints and watchpoints (l)
+  step                  execute one instruction (s)
+  next                  execute one instruction, stepping over calls (n)
+  finish                run until the current function returns (f)
+  continue              run until a breakpoint or watchpoint (c)
+  frame [count]         run until count frames have completed
+  regs                  print the registers (r)
+  disasm [addr] [count] disassemble instructions (u)
+  set reg value         set a register (a, f, b, c, d, e, h, l, sp, pc)
+  mem addr [length]     print memory (x)
+  poke addr value...    write values to memory
+  png file              write the current frame to a png file
+  cheat [add code [name]|on i|off i|delete i|save [file]]
+                        list, add, enable, disable, delete or save cheats
+  search new [u8|s8|u16|s16]
+                        start a search of cart RAM, WRAM and HRAM, which only
+                        covers the cart RAM and WRAM banks that are mapped
+  search changed|unchanged|increased|decreased
+                        keep results compared to the previous search
+  search eq|ne value    keep results equal or not equal to a value
+  search [list [count]] print the search results
+  display [addr [u8|s8|u16|s16] [name]]
+                        watch a value each frame, or print the watched values
+  undisplay index       stop watching a value
+  quit                  exit the debugger (q)
+`
+
+// Run a rom without a window in an interactive debugger.
+func debugCommand(args []string) {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	rom := romArg()
+
+	var opts []gb.GameboyOption
+	if !*dmgMode {
+		opts = append(opts, gb.WithCGBEnabled())
+	}
+	opts = append(opts, patchOptions()...)
+	opts = append(opts, cheatOptions()...)
+	gameboy, err := gb.New(rom, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer closeGameboy(gameboy)
+
+	binding := headless.New(0)
+	debugger := gameboy.Debugger()
+	gameboy.Watches().SetFrameHandler(printWatchChanges)
+	symbols := loadSymbols(rom, "")
+
+	// Interrupt a running continue with ctrl-c
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		for range interrupts {
+			debugger.Interrupt()
+		}
+	}()
+
+	fmt.Print("Type 'help' for a list of commands.\n")
+	printStop(debugger, symbols, gb.StopEvent{Reason: gb.StopStep, PC: debugger.Registers().PC})
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("(goboy) ")
+		if !scanner.Scan() {
+			return
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		quit, err := runDebugCommand(debugger, symbols, binding, gameboy, fields[0], fields[1:])
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+// Run a single debugger command. Returns true if the debugger should quit.
+func runDebugCommand(d *gb.Debugger, symbols *disasm.Symbols, binding *headless.Binding, gameboy *gb.Gameboy, command string, args []string) (bool, error) {
+	switch command {
+	case "help", "h":
+		fmt.Print(debugHelp)
+
+	case "break", "b":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: break location")
+		}
+		bp, err := parseBreakpoint(args[0], symbols)
+		if err != nil {
+			return false, err
+		}
+		d.AddBreakpoint(bp)
+		fmt.Printf("breakpoint %v: %v\n", len(d.Breakpoints())-1, bp)
+
+	case "watch", "w":
+		if len(args) < 1 {
+			return false, fmt.Errorf("usage: watch addr[-end] [r|w|rw]")
+		}
+		wp, err := parseWatchpoint(args)
+		if err != nil {
+			return false, err
+		}
+		d.AddWatchpoint(wp)
+		fmt.Printf("watchpoint %v: %v\n", len(d.Watchpoints())-1, wp)
+
+	case "delete", "d":
+		if len(args) != 2 {
+			return false, fmt.Errorf("usage: delete b|w index")
+		}
+		index, err := strconv.Atoi(args[1])
+		if err != nil {
+			return false, err
+		}
+		if args[0] == "w" {
+			d.RemoveWatchpoint(index)
+		} else {
+			d.RemoveBreakpoint(index)
+		}
+
+	case "list", "l":
+		for i, bp := range d.Breakpoints() {
+			fmt.Printf("breakpoint %v: %v\n", i, bp)
+		}
+		for i, wp := range d.Watchpoints() {
+			fmt.Printf("watchpoint %v: %v\n", i, wp)
+		}
+
+	case "step", "s":
+		printStop(d, symbols, d.Step())
+	case "next", "n":
+		printStop(d, symbols, d.StepOver())
+	case "finish", "f":
+		printStop(d, symbols, d.StepOut())
+	case "continue", "c":
+		printStop(d, symbols, d.Continue())
+
+	case "frame":
+		count := 1
+		if len(args) > 0 {
+			var err error
+			if count, err = strconv.Atoi(args[0]); err != nil {
+				return false, err
+			}
+		}
+		printStop(d, symbols, d.RunFrames(count))
+
+	case "regs", "r":
+		fmt.Println(d.Registers())
+
+	case "disasm", "u":
+		address := d.Registers().PC
+		count := 10
+		var err error
+		if len(args) > 0 {
+			if address, _, err = parseLocation(args[0], symbols); err != nil {
+				return false, err
+			}
+		}
+		if len(args) > 1 {
+			if count, err = strconv.Atoi(args[1]); err != nil {
+				return false, err
+			}
+		}
+		for i := 0; i < count; i++ {
+			ins := disasm.Decode(debugRead(d), address)
+			printInstruction(ins, d.ROMBank(0x4000), symbols)
+			address += uint16(ins.Len())
+		}
+
+	case "set":
+		if len(args) != 2 {
+			return false, fmt.Errorf("usage: set reg value")
+		}
+		return false, setRegister(d, args[0], args[1])
+
+	case "mem", "x":
+		if len(args) < 1 {
+			return false, fmt.Errorf("usage: mem addr [length]")
+		}
+		address, err := parseAddress(args[0])
+		if err != nil {
+			return false, err
+		}
+		length := 0x40
+		if len(args) > 1 {
+			if length, err = strconv.Atoi(args[1]); err != nil {
+				return false, err
+			}
+			if length <= 0 {
+				return false, fmt.Errorf("usage: mem addr [length], where length is greater than 0")
+			}
+		}
+		printMemory(address, d.ReadMemory(address, length))
+
+	case "poke":
+		if len(args) < 2 {
+			return false, fmt.Errorf("usage: poke addr value...")
+		}
+		address, err := parseAddress(args[0])
+		if err != nil {
+			return false, err
+		}
+		var data []byte
+		for _, arg := range args[1:] {
+			value, err := strconv.ParseUint(strings.TrimPrefix(arg, "0x"), 16, 8)
+			if err != nil {
+				return false, err
+			}
+			data = append(data, byte(value))
+		}
+		d.WriteMemory(address, data)
+
+	case "png":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: png file")
+		}
+		binding.Render(&gameboy.PreparedData)
+		return false, binding.SavePNG(args[0])
+
+	case "cheat":
+		return false, runCheatCommand(gameboy, args)
+
+	case "search":
+		return false, runSearchCommand(gameboy, args)
+
+	case "display":
+		return false, runDisplayCommand(gameboy, args)
+
+	case "undisplay":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: undisplay index")
+		}
+		index, err := strconv.Atoi(args[0])
+		if err != nil {
+			return false, err
+		}
+		gameboy.Watches().Remove(index)
+
+	case "quit", "q":
+		return true, nil
+
+	default:
+		return false, fmt.Errorf("unknown command %q, type 'help' for a list of commands", command)
+	}
+	return false, nil
+}
+
+// Print the reason the debugger stopped, the current registers and the next
+// instruction.
+func printStop(d *gb.Debugger, symbols *disasm.Symbols, event gb.StopEvent) {
+	fmt.Printf("%v\n%v\n", event, d.Registers())
+	printInstruction(disasm.Decode(debugRead(d), event.PC), d.ROMBank(0x4000), symbols)
+}
+
+// Get a function which reads memory through the debugger.
+func debugRead(d *gb.Debugger) disasm.ReadFunc {
+	return func(address uint16) byte {
+		return d.ReadMemory(address, 1)[0]
+	}
+}
+
+// Print a range of memory in rows of 16 bytes.
+func printMemory(address uint16, data []byte) {
+	for i := 0; i < len(data); i += 16 {
+		end := i + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		fmt.Printf("%04X:", address+uint16(i))
+		for _, value := range data[i:end] {
+			fmt.Printf(" %02X", value)
+		}
+		fmt.Println()
+	}
+}
+
+// Parse a hex address which may be prefixed with 0x or $.
+func parseAddress(str string) (uint16, error) {
+	str = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(str), "0x"), "$")
+	value, err := strconv.ParseUint(str, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", str)
+	}
+	return uint16(value), nil
+}
+
+// Parse a breakpoint in the format addr, bank:addr or a label.
+func parseBreakpoint(str string, symbols *disasm.Symbols) (gb.Breakpoint, error) {
+	address, bank, err := parseLocation(str, symbols)
+	if bank < 0 {
+		bank = gb.AnyBank
+	}
+	return gb.Breakpoint{Address: address, Bank: bank}, err
+}
+
+// Parse a watchpoint in the format addr[-end] [r|w|rw].
+func parseWatchpoint(args []string) (gb.Watchpoint, error) {
+	wp := gb.Watchpoint{Kind: gb.WatchWrite}
+	parts := strings.SplitN(args[0], "-", 2)
+	var err error
+	if wp.Start, err = parseAddress(parts[0]); err != nil {
+		return wp, err
+	}
+	wp.End = wp.Start
+	if len(parts) == 2 {
+		if wp.End, err = parseAddress(parts[1]); err != nil {
+			return wp, err
+		}
+	}
+	if len(args) > 1 {
+		kinds := map[string]gb.WatchKind{"r": gb.WatchRead, "w": gb.WatchWrite, "rw": gb.WatchReadWrite}
+		kind, ok := kinds[args[1]]
+		if !ok {
+			return wp, fmt.Errorf("invalid watch type %q", args[1])
+		}
+		wp.Kind = kind
+	}
+	return wp, nil
+}
+
+// Set the value of a register by name.
+func setRegister(d *gb.Debugger, name string, str string) error {
+	value, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(str), "0x"), 16, 16)
+	if err != nil {
+		return fmt.Errorf("invalid value %q", str)
+	}
+	regs := d.Registers()
+	byteRegs := map[string]*byte{
+		"a": &regs.A, "f": &regs.F, "b": &regs.B, "c": &regs.C,
+		"d": &regs.D, "e": &regs.E, "h": &regs.H, "l": &regs.L,
+	}
+	switch name = strings.ToLower(name); name {
+	case "sp":
+		regs.SP = uint16(value)
+	case "pc":
+		regs.PC = uint16(value)
+	default:
+		reg, ok := byteRegs[name]
+		if !ok {
+			return fmt.Errorf("unknown register %q", name)
+		}
+		*reg = byte(value)
+	}
+	d.SetRegisters(regs)
+	return nil
+}
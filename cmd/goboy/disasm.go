@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Humpheh/goboy/pkg/cart"
+	"github.com/Humpheh/goboy/pkg/disasm"
+)
+
+// Disassemble a range of a rom to stdout.
+func disasmCommand(args []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	bank := flags.Int("bank", -1, "rom bank mapped at 0x4000-0x7FFF (defaults to the bank in -from, or 1)")
+	from := flags.String("from", "0x150", "address to start at, as addr, bank:addr or a symbol name")
+	to := flags.String("to", "", "address to stop at (inclusive)")
+	count := flags.Int("count", 64, "number of instructions to disassemble if -to is not set")
+	symFile := flags.String("sym", "", "symbol file to load labels from (defaults to the rom with a .sym extension)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: goboy disasm [options] rom.gb\n")
+		flags.PrintDefaults()
+	}
+
+	// Allow the flags to be passed before or after the rom
+	if err := flags.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	rom := flags.Arg(0)
+	if rom == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err := flags.Parse(flags.Args()[1:]); err != nil {
+		log.Fatal(err)
+	}
+
+	data, err := cart.LoadROMFile(rom)
+	if err != nil {
+		log.Fatal(err)
+	}
+	symbols := loadSymbols(rom, *symFile)
+
+	start, startBank, err := parseLocation(*from, symbols)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *bank < 0 {
+		*bank = 1
+		if startBank > 0 {
+			*bank = startBank
+		}
+	}
+	read := disasm.ROMReader(data, *bank)
+
+	var instructions []disasm.Instruction
+	if *to != "" {
+		end, _, err := parseLocation(*to, symbols)
+		if err != nil {
+			log.Fatal(err)
+		}
+		instructions = disasm.Range(read, start, end)
+	} else {
+		address := start
+		for i := 0; i < *count; i++ {
+			ins := disasm.Decode(read, address)
+			instructions = append(instructions, ins)
+			address += uint16(ins.Len())
+		}
+	}
+
+	for _, ins := range instructions {
+		printInstruction(ins, *bank, symbols)
+	}
+}
+
+// Print an instruction with its bytes, and its label if it has one.
+func printInstruction(ins disasm.Instruction, bank int, symbols *disasm.Symbols) {
+	insBank := bank
+	if ins.Address < 0x4000 || ins.Address >= 0x8000 {
+		insBank = 0
+	}
+	if label, ok := symbols.Lookup(bank, ins.Address); ok {
+		fmt.Printf("%02X:%04X %s:\n", insBank, ins.Address, label)
+	}
+	var raw []string
+	for _, b := range ins.Bytes {
+		raw = append(raw, fmt.Sprintf("%02X", b))
+	}
+	fmt.Printf("%02X:%04X  %-9s %s\n", insBank, ins.Address, strings.Join(raw, " "), symbols.Format(ins, bank))
+}
+
+// Load the symbols for a rom. If no symbol file is given then the rom file
+// with a .sym extension is used if it exists.
+func loadSymbols(rom, symFile string) *disasm.Symbols {
+	if symFile == "" {
+		symFile = strings.TrimSuffix(rom, filepath.Ext(rom)) + ".sym"
+		if _, err := os.Stat(symFile); err != nil {
+			return nil
+		}
+	}
+	symbols, err := disasm.LoadSymbols(symFile)
+	if err != nil {
+		log.Fatalf("Error loading symbols: %v", err)
+	}
+	return symbols
+}
+
+// Parse a location in the format addr, bank:addr or a symbol name. The bank
+// is -1 if the location did not specify one.
+func parseLocation(str string, symbols *disasm.Symbols) (uint16, int, error) {
+	if symbol, ok := symbols.Find(str); ok {
+		return symbol.Address, symbol.Bank, nil
+	}
+	bank := -1
+	if parts := strings.SplitN(str, ":", 2); len(parts) == 2 {
+		value, err := strconv.ParseUint(parts[0], 16, 16)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid bank %q", parts[0])
+		}
+		bank = int(value)
+		str = parts[1]
+	}
+	address, err := parseAddress(str)
+	return address, bank, err
+}
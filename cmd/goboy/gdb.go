@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/Humpheh/goboy/pkg/gb"
+	"github.com/Humpheh/goboy/pkg/gdbstub"
+)
+
+// Run a rom without a window and serve the gdb remote serial protocol so a
+// debugger can be attached to it.
+func gdbCommand(args []string) {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	rom := romArg()
+
+	var opts []gb.GameboyOption
+	if !*dmgMode {
+		opts = append(opts, gb.WithCGBEnabled())
+	}
+	opts = append(opts, patchOptions()...)
+	opts = append(opts, cheatOptions()...)
+	gameboy, err := gb.New(rom, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer closeGameboy(gameboy)
+
+	server := gdbstub.New(gameboy)
+	server.Verbose = *gdbVerbose
+	if err := server.ListenAndServe(*gdbAddr); err != nil {
+		log.Print(err)
+	}
+}
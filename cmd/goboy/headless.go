@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/Humpheh/goboy/pkg/gb"
+	"github.com/Humpheh/goboy/pkg/headless"
+)
+
+// Run the rom without a window or sound as fast as possible until the frame
+// limit or serial condition has been reached.
+func runHeadless() {
+	rom := romArg()
+	if *frames == 0 && *untilSerial == "" {
+		log.Fatal("Headless mode requires -frames or -until-serial to be set.")
+	}
+
+	var serial strings.Builder
+	opts := []gb.GameboyOption{
+		gb.WithTransferFunction(func(val byte) {
+			serial.WriteByte(val)
+		}),
+	}
+	if !*dmgMode {
+		opts = append(opts, gb.WithCGBEnabled())
+	}
+	opts = append(opts, traceOptions()...)
+	opts = append(opts, cameraOptions()...)
+	opts = append(opts, patchOptions()...)
+	opts = append(opts, cheatOptions()...)
+
+	gameboy, err := gb.New(rom, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer closeGameboy(gameboy)
+	if *stepThrough {
+		gameboy.Debug.OutputOpcodes = true
+	}
+
+	binding := headless.New(*frames)
+	reached := false
+	for binding.IsRunning() {
+		gameboy.ProcessInput(binding.ProcessButtonInput())
+		gameboy.Update()
+		binding.Render(&gameboy.PreparedData)
+
+		if *untilSerial != "" && strings.Contains(serial.String(), *untilSerial) {
+			reached = true
+			binding.Stop()
+		}
+	}
+	fmt.Printf("Ran %v frames\n", binding.Frames())
+
+	if *pngOut != "" {
+		if err := binding.SavePNG(*pngOut); err != nil {
+			log.Fatalf("Failed to write png: %v", err)
+		}
+	}
+
+	if *untilSerial != "" && !reached {
+		fmt.Printf("Serial output did not contain %q:\n%s\n", *untilSerial, serial.String())
+		closeGameboy(gameboy)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Humpheh/goboy/pkg/cart"
+)
+
+// Print the cartridge header of a rom.
+func infoCommand(args []string) {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: goboy info rom.gb\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	data, err := cart.LoadROMFile(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	header, err := cart.ParseHeader(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Title:            %s\n", header.Title)
+	fmt.Printf("Cartridge type:   0x%02X %s\n", header.CartridgeType, unknownIfEmpty(header.CartridgeTypeName()))
+	fmt.Printf("ROM size:         0x%02X %s\n", header.ROMSizeCode, formatSize(header.ROMSize()))
+	fmt.Printf("RAM size:         0x%02X %s\n", header.RAMSizeCode, formatSize(header.RAMSize()))
+	fmt.Printf("CGB:              0x%02X %s\n", header.CGBFlag, cgbSupport(header.CGBFlag))
+	fmt.Printf("SGB:              0x%02X %v\n", header.SGBFlag, header.SupportsSGB())
+	fmt.Printf("Licensee:         %s\n", licenseeCode(header))
+	fmt.Printf("Destination:      0x%02X %s\n", header.DestinationCode, destination(header.DestinationCode))
+	fmt.Printf("Version:          %v\n", header.Version)
+
+	status := "ok"
+	if checksum := cart.ComputeHeaderChecksum(data); checksum != header.HeaderChecksum {
+		status = fmt.Sprintf("mismatch (rom has 0x%02X)", checksum)
+	}
+	fmt.Printf("Header checksum:  0x%02X %s\n", header.HeaderChecksum, status)
+
+	status = "ok"
+	if checksum := cart.ComputeGlobalChecksum(data); checksum != header.GlobalChecksum {
+		status = fmt.Sprintf("mismatch (rom has 0x%04X)", checksum)
+	}
+	fmt.Printf("Global checksum:  0x%04X %s\n", header.GlobalChecksum, status)
+
+	status = "ok"
+	if err := header.Validate(data); err != nil {
+		status = err.Error()
+	}
+	fmt.Printf("Validation:       %s\n", status)
+}
+
+// Get the licensee code and the name of the publisher.
+func licenseeCode(header cart.Header) string {
+	code := fmt.Sprintf("0x%02X", header.OldLicenseeCode)
+	if header.OldLicenseeCode == 0x33 {
+		code = fmt.Sprintf("%q", header.NewLicenseeCode)
+	}
+	return code + " " + unknownIfEmpty(header.Licensee())
+}
+
+// Describe the CGB flag.
+func cgbSupport(flag byte) string {
+	switch flag {
+	case 0x80:
+		return "supported"
+	case 0xC0:
+		return "required"
+	default:
+		return "not supported"
+	}
+}
+
+// Describe the destination code.
+func destination(code byte) string {
+	if code == 0x00 {
+		return "Japan"
+	}
+	return "Overseas"
+}
+
+// Format a size in bytes in KB, or "none" if it is zero.
+func formatSize(size int) string {
+	if size == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%vKB", size/1024)
+}
+
+// Replace an empty name with "(unknown)".
+func unknownIfEmpty(str string) string {
+	if str == "" {
+		return "(unknown)"
+	}
+	return str
+}
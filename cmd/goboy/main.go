@@ -6,8 +6,10 @@ import (
 	"log"
 	"os"
 	"runtime/pprof"
+	"strings"
 	"time"
 
+	"github.com/Humpheh/goboy/pkg/cart"
 	"github.com/Humpheh/goboy/pkg/gb"
 	"github.com/Humpheh/goboy/pkg/pixelbinding"
 )
@@ -23,18 +25,74 @@ var (
 	vsyncOff    = flag.Bool("disableVsync", false, "set to disable vsync (debugging)")
 	stepThrough = flag.Bool("stepthrough", false, "step through opcodes (debugging)")
 	unlocked    = flag.Bool("unlocked", false, "if to unlock the cpu speed (debugging)")
+
+	headlessMode = flag.Bool("headless", false, "run without a window or sound output")
+	frames       = flag.Int("frames", 0, "number of frames to run for in headless mode (0 for no limit)")
+	untilSerial  = flag.String("until-serial", "", "stop headless mode once the serial output contains this string")
+	pngOut       = flag.String("png", "", "write the final frame to this png file in headless mode")
+
+	traceFile   = flag.String("trace", "", "write a trace of every instruction executed to this file")
+	traceDisasm = flag.Bool("trace-disasm", false, "include the disassembled instruction in the trace")
+
+	cameraImages = flag.String("camera", "", "comma separated list of png files captured by the pocket camera")
+	patchFile    = flag.String("patch", "", "ips, ups or bps patch to apply to the rom (defaults to a patch next to the rom)")
+	cheatCodes   = flag.String("cheat", "", "comma separated list of game genie or gameshark codes to apply")
+	cheatFile    = flag.String("cheat-file", "", "file of cheats to load (defaults to the rom with a .cheats extension)")
+
+	gdbAddr    = flag.String("gdb-addr", "localhost:2345", "address to listen on for gdb connections")
+	gdbVerbose = flag.Bool("gdb-verbose", false, "log gdb remote protocol packets")
 )
 
+// Subcommands which can be run with 'goboy <command>'. If no command is
+// given then the rom is run in a window.
+var commands = map[string]func(args []string){
+	"run":       runCommand,
+	"debug":     debugCommand,
+	"gdb":       gdbCommand,
+	"disasm":    disasmCommand,
+	"info":      infoCommand,
+	"tracediff": tracediffCommand,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
 	flag.Parse()
+	run()
+}
+
+// Run a rom with the options passed on the command line.
+func runCommand(args []string) {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	run()
+}
+
+// Run the rom in either a window or headless depending on the flags.
+func run() {
+	if *headlessMode {
+		runHeadless()
+		return
+	}
 	pixelbinding.Run(start)
 }
 
-func start(binding gb.IOBinding) {
+// Get the rom file passed as the first argument.
+func romArg() string {
 	rom := flag.Arg(0)
 	if rom == "" {
 		log.Fatal("No ROM file specified. Please provide a ROM file as an argument.")
 	}
+	return rom
+}
+
+func start(binding gb.IOBinding) {
+	rom := romArg()
 
 	// If the CPU profile flag is set, then setup the profiling
 	if *cpuprofile != "" {
@@ -56,12 +114,17 @@ func start(binding gb.IOBinding) {
 	if !*mute {
 		opts = append(opts, gb.WithSound())
 	}
+	opts = append(opts, traceOptions()...)
+	opts = append(opts, cameraOptions()...)
+	opts = append(opts, patchOptions()...)
+	opts = append(opts, cheatOptions()...)
 
 	// Initialise the GameBoy with the flag options
 	gameboy, err := gb.New(rom, opts...)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer closeGameboy(gameboy)
 	if *stepThrough {
 		gameboy.Debug.OutputOpcodes = true
 	}
@@ -111,6 +174,36 @@ func startGBLoop(gameboy *gb.Gameboy, monitor gb.IOBinding) {
 	}
 }
 
+// Get the options to load the images captured by the pocket camera if the
+// camera flag is set.
+func cameraOptions() []gb.GameboyOption {
+	if *cameraImages == "" {
+		return nil
+	}
+	source, err := cart.LoadPNGImageSource(strings.Split(*cameraImages, ",")...)
+	if err != nil {
+		log.Fatalf("Failed to load camera images: %v", err)
+	}
+	return []gb.GameboyOption{gb.WithImageSource(source)}
+}
+
+// Get the option to apply a patch to the rom if the patch flag is set.
+func patchOptions() []gb.GameboyOption {
+	if *patchFile == "" {
+		return nil
+	}
+	return []gb.GameboyOption{gb.WithPatch(*patchFile)}
+}
+
+// Close the Gameboy, which will flush any unsaved changes to the save data,
+// and then close the trace file.
+func closeGameboy(gameboy *gb.Gameboy) {
+	if err := gameboy.Close(); err != nil {
+		log.Printf("Failed to close: %v", err)
+	}
+	closeTrace()
+}
+
 // Start the CPU profile to a the file passed in from the flag.
 func startCPUProfiling() {
 	log.Print("Starting CPU profile...")
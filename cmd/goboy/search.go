@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Humpheh/goboy/pkg/gb"
+)
+
+// The RAM search started by the search command in the debugger.
+var ramSearch *gb.RAMSearch
+
+// Filters which compare the values with the previous search.
+var searchFilters = map[string]gb.SearchFilter{
+	"changed":   gb.SearchChanged,
+	"unchanged": gb.SearchUnchanged,
+	"increased": gb.SearchIncreased,
+	"decreased": gb.SearchDecreased,
+}
+
+// Run the search command in the debugger, which starts a RAM search, filters
+// it or lists the results.
+func runSearchCommand(gameboy *gb.Gameboy, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	if args[0] != "new" && ramSearch == nil {
+		return fmt.Errorf("no search, start one with 'search new [u8|s8|u16|s16]'")
+	}
+
+	switch args[0] {
+	case "new":
+		valueType := gb.Uint8
+		if len(args) > 1 {
+			var err error
+			if valueType, err = gb.ParseValueType(args[1]); err != nil {
+				return err
+			}
+		}
+		ramSearch = gameboy.NewRAMSearch(valueType, gb.SearchAllRAM)
+		fmt.Printf("%v results\n", ramSearch.Count())
+
+	case "changed", "unchanged", "increased", "decreased":
+		fmt.Printf("%v results\n", ramSearch.Filter(searchFilters[args[0]], 0))
+
+	case "eq", "ne":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: search %s value", args[0])
+		}
+		value, err := parseValue(args[1])
+		if err != nil {
+			return err
+		}
+		filter := gb.SearchEqual
+		if args[0] == "ne" {
+			filter = gb.SearchNotEqual
+		}
+		fmt.Printf("%v results\n", ramSearch.Filter(filter, value))
+
+	case "list":
+		count := 20
+		if len(args) > 1 {
+			var err error
+			if count, err = strconv.Atoi(args[1]); err != nil {
+				return err
+			}
+		}
+		results := ramSearch.Results()
+		for i, result := range results {
+			if i == count {
+				fmt.Printf("... %v more\n", len(results)-count)
+				break
+			}
+			fmt.Printf("%04X: %v (was %v)\n", result.Address, result.Value, result.Previous)
+		}
+		fmt.Printf("%v results\n", len(results))
+
+	default:
+		return fmt.Errorf("unknown search command %q", args[0])
+	}
+	return nil
+}
+
+// Run the display command in the debugger, which adds a value to the watch
+// list or prints the current values.
+func runDisplayCommand(gameboy *gb.Gameboy, args []string) error {
+	watches := gameboy.Watches()
+	if len(args) == 0 {
+		for i, value := range watches.Values() {
+			fmt.Printf("display %v: %v = %v\n", i, value.MemoryWatch, value.Value)
+		}
+		return nil
+	}
+
+	watch := gb.MemoryWatch{Type: gb.Uint8}
+	var err error
+	if watch.Address, err = parseAddress(args[0]); err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		if watch.Type, err = gb.ParseValueType(args[1]); err != nil {
+			return err
+		}
+	}
+	watch.Name = strings.Join(args[2:], " ")
+	index := watches.Add(watch)
+	fmt.Printf("display %v: %v\n", index, watch)
+	return nil
+}
+
+// Print the values in the watch list which changed during a frame.
+func printWatchChanges(frame int, values []gb.WatchValue) {
+	var changed []string
+	for _, value := range values {
+		if value.Changed {
+			changed = append(changed, value.String())
+		}
+	}
+	if len(changed) > 0 {
+		fmt.Printf("frame %v: %s\n", frame, strings.Join(changed, " "))
+	}
+}
+
+// Parse a decimal value, or a hex value prefixed with 0x, which may be
+// negative.
+func parseValue(str string) (int, error) {
+	value, err := strconv.ParseInt(str, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", str)
+	}
+	return int(value), nil
+}
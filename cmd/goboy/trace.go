@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/Humpheh/goboy/pkg/gb"
+	"github.com/Humpheh/goboy/pkg/tracediff"
+)
+
+// File which the instruction trace is written to, or nil if there is no trace.
+var traceOut *os.File
+
+// Get the options to write an instruction trace if the trace flag is set. The
+// trace is flushed when the Gameboy is closed, and the file is closed after
+// that by closeTrace.
+func traceOptions() []gb.GameboyOption {
+	if *traceFile == "" {
+		return nil
+	}
+	f, err := os.Create(*traceFile)
+	if err != nil {
+		log.Fatalf("Failed to create trace: %v", err)
+	}
+	traceOut = f
+	format := gb.TraceFormatDoctor
+	if *traceDisasm {
+		format = gb.TraceFormatDisasm
+	}
+	return []gb.GameboyOption{gb.WithTraceWriter(f, format)}
+}
+
+// Close the trace file if one was created. This must be called after the
+// Gameboy is closed so that the trace has been flushed.
+func closeTrace() {
+	if traceOut == nil {
+		return
+	}
+	if err := traceOut.Close(); err != nil {
+		log.Printf("Failed to close trace: %v", err)
+	}
+	traceOut = nil
+}
+
+// Compare a trace against a reference log and report the first instruction
+// which differs.
+func tracediffCommand(args []string) {
+	flags := flag.NewFlagSet("tracediff", flag.ExitOnError)
+	ignore := flags.String("ignore", "", "comma separated list of fields to ignore, e.g. F,PCMEM")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: goboy tracediff [options] reference.log trace.log\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	expected, err := os.Open(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer expected.Close()
+	actual, err := os.Open(flags.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer actual.Close()
+
+	var ignored []string
+	if *ignore != "" {
+		ignored = strings.Split(*ignore, ",")
+	}
+	divergence, err := tracediff.Compare(expected, actual, ignored...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if divergence == nil {
+		fmt.Println("Traces match")
+		return
+	}
+	fmt.Println(divergence)
+	expected.Close()
+	actual.Close()
+	os.Exit(1)
+}
@@ -35,6 +35,7 @@ type APU struct {
 	lVol, rVol             float64
 
 	audioBuffer chan [2]byte
+	stop        chan struct{}
 }
 
 // Init the sound emulation for a Gameboy.
@@ -76,10 +77,18 @@ func (a *APU) playSound(bufferSeconds int) {
 	frameTime := time.Second / time.Duration(bufferSeconds)
 	ticker := time.NewTicker(frameTime)
 	targetSamples := sampleRate / bufferSeconds
+	a.stop = make(chan struct{})
 	go func() {
+		defer ticker.Stop()
 		var reading [2]byte
 		var buffer []byte
-		for range ticker.C {
+		for {
+			select {
+			case <-ticker.C:
+			case <-a.stop:
+				return
+			}
+
 			fbLen := len(a.audioBuffer)
 			if fbLen >= targetSamples/2 {
 				newBuffer := make([]byte, fbLen*2)
@@ -98,6 +107,16 @@ func (a *APU) playSound(bufferSeconds int) {
 	}()
 }
 
+// Close stops the sound output. No more samples will be buffered once the
+// APU has been closed.
+func (a *APU) Close() {
+	a.playing = false
+	if a.stop != nil {
+		close(a.stop)
+		a.stop = nil
+	}
+}
+
 func (a *APU) Buffer(cpuTicks int, speed int) {
 	if !a.playing {
 		return
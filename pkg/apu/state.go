@@ -0,0 +1,167 @@
+package apu
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// Snapshot of the APU registers and the state of each channel.
+type apuState struct {
+	Memory      [52]byte
+	WaveformRAM []byte
+	TickCounter float64
+	LVol, RVol  float64
+	Channels    [4]channelState
+}
+
+// Snapshot of the internal state of a single sound channel. The wave
+// generator cannot be serialised, so it is rebuilt from the registers.
+type channelState struct {
+	Frequency float64
+	Time      float64
+	Amplitude float64
+	Duration  int
+	Length    int
+
+	EnvelopeVolume     int
+	EnvelopeTime       int
+	EnvelopeSteps      int
+	EnvelopeStepsInit  int
+	EnvelopeSamples    int
+	EnvelopeIncreasing bool
+
+	SweepTime     float64
+	SweepStepLen  byte
+	SweepSteps    byte
+	SweepStep     byte
+	SweepIncrease bool
+
+	OnL, OnR     bool
+	DebugOff     bool
+	HasGenerator bool
+}
+
+// MarshalState returns a snapshot of the APU registers and channel state
+// which can be restored with UnmarshalState.
+func (a *APU) MarshalState() ([]byte, error) {
+	state := apuState{
+		Memory:      a.memory,
+		WaveformRAM: a.waveformRam,
+		TickCounter: a.tickCounter,
+		LVol:        a.lVol,
+		RVol:        a.rVol,
+	}
+	for i, chn := range a.channels() {
+		state.Channels[i] = chn.state()
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode a snapshot and check that it can be restored into the APU.
+func (a *APU) decodeState(data []byte) (apuState, error) {
+	var state apuState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return state, err
+	}
+	if len(state.WaveformRAM) != len(a.waveformRam) {
+		return state, fmt.Errorf("state has %v bytes of waveform RAM but apu has %v", len(state.WaveformRAM), len(a.waveformRam))
+	}
+	return state, nil
+}
+
+// ValidateState checks that a snapshot can be restored with UnmarshalState,
+// without modifying the APU.
+func (a *APU) ValidateState(data []byte) error {
+	_, err := a.decodeState(data)
+	return err
+}
+
+// UnmarshalState restores the APU registers and channel state from a snapshot.
+// If the snapshot is invalid then an error is returned and the APU is not
+// modified.
+func (a *APU) UnmarshalState(data []byte) error {
+	state, err := a.decodeState(data)
+	if err != nil {
+		return err
+	}
+	a.memory = state.Memory
+	copy(a.waveformRam, state.WaveformRAM)
+	a.tickCounter = state.TickCounter
+	a.lVol, a.rVol = state.LVol, state.RVol
+
+	// Rebuild the generators which were playing when the state was taken
+	generators := [4]func() WaveGenerator{
+		func() WaveGenerator { return Square(squareLimits[(a.memory[0x11]&0b1100_0000)>>6]) },
+		func() WaveGenerator { return Square(squareLimits[(a.memory[0x16]&0b1100_0000)>>6]) },
+		func() WaveGenerator { return Waveform(func(i int) byte { return a.waveformRam[i] }) },
+		Noise,
+	}
+	for i, chn := range a.channels() {
+		chn.restore(state.Channels[i])
+		chn.generator = nil
+		if state.Channels[i].HasGenerator {
+			chn.generator = generators[i]()
+		}
+	}
+	return nil
+}
+
+// Get the four sound channels in order.
+func (a *APU) channels() [4]*Channel {
+	return [4]*Channel{a.chn1, a.chn2, a.chn3, a.chn4}
+}
+
+// Get a snapshot of the channel.
+func (chn *Channel) state() channelState {
+	return channelState{
+		Frequency:          chn.frequency,
+		Time:               chn.time,
+		Amplitude:          chn.amplitude,
+		Duration:           chn.duration,
+		Length:             chn.length,
+		EnvelopeVolume:     chn.envelopeVolume,
+		EnvelopeTime:       chn.envelopeTime,
+		EnvelopeSteps:      chn.envelopeSteps,
+		EnvelopeStepsInit:  chn.envelopeStepsInit,
+		EnvelopeSamples:    chn.envelopeSamples,
+		EnvelopeIncreasing: chn.envelopeIncreasing,
+		SweepTime:          chn.sweepTime,
+		SweepStepLen:       chn.sweepStepLen,
+		SweepSteps:         chn.sweepSteps,
+		SweepStep:          chn.sweepStep,
+		SweepIncrease:      chn.sweepIncrease,
+		OnL:                chn.onL,
+		OnR:                chn.onR,
+		DebugOff:           chn.debugOff,
+		HasGenerator:       chn.generator != nil,
+	}
+}
+
+// Restore the channel from a snapshot. The generator is not restored.
+func (chn *Channel) restore(state channelState) {
+	chn.frequency = state.Frequency
+	chn.time = state.Time
+	chn.amplitude = state.Amplitude
+	chn.duration = state.Duration
+	chn.length = state.Length
+	chn.envelopeVolume = state.EnvelopeVolume
+	chn.envelopeTime = state.EnvelopeTime
+	chn.envelopeSteps = state.EnvelopeSteps
+	chn.envelopeStepsInit = state.EnvelopeStepsInit
+	chn.envelopeSamples = state.EnvelopeSamples
+	chn.envelopeIncreasing = state.EnvelopeIncreasing
+	chn.sweepTime = state.SweepTime
+	chn.sweepStepLen = state.SweepStepLen
+	chn.sweepSteps = state.SweepSteps
+	chn.sweepStep = state.SweepStep
+	chn.sweepIncrease = state.SweepIncrease
+	chn.onL = state.OnL
+	chn.onR = state.OnR
+	chn.debugOff = state.DebugOff
+}
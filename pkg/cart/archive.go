@@ -0,0 +1,213 @@
+package cart
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Errors returned when loading a ROM from an archive.
+var (
+	ErrNoROMInArchive        = errors.New("archive does not contain a rom")
+	ErrMultipleROMsInArchive = errors.New("archive contains more than one rom")
+	ErrEntryNotFound         = errors.New("entry not found in archive")
+	ErrNotArchive            = errors.New("file is not an archive")
+)
+
+// Largest file which is read out of an archive, so that a corrupt or
+// malicious archive cannot use up all of the memory.
+const maxArchiveEntrySize = 64 << 20
+
+// Extensions of the files in an archive which are chosen as the ROM.
+var romExtensions = []string{".gb", ".gbc", ".sgb"}
+
+// A file in an archive, which is only read if it is chosen as the ROM.
+type archiveEntry struct {
+	name string
+	open func() (io.Reader, error)
+}
+
+// Split a filename in the format archive#entry into the archive and the name
+// of the entry. If there is no entry, or the whole name is an existing file,
+// then the entry is empty.
+func splitArchiveEntry(filename string) (string, string) {
+	i := strings.LastIndex(filename, "#")
+	if i < 0 {
+		return filename, ""
+	}
+	if _, err := os.Stat(filename); err == nil {
+		return filename, ""
+	}
+	return filename[:i], filename[i+1:]
+}
+
+// Get the ROM out of some data if it is a zip, gzip or tar archive, which
+// are detected from the start of the data. If an entry is given then that
+// file is read from the archive, otherwise the only .gb, .gbc or .sgb file
+// in it is read. Data which is not an archive is returned unchanged.
+func extractROM(data []byte, entry string) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return extractZIP(data, entry)
+	case bytes.HasPrefix(data, []byte{0x1F, 0x8B}):
+		return extractGZIP(data, entry)
+	case isTar(data):
+		return extractTar(data, entry)
+	}
+	if entry != "" {
+		return nil, fmt.Errorf("%w: cannot read %q", ErrNotArchive, entry)
+	}
+	return data, nil
+}
+
+// Check for the magic bytes in the header of a tar file.
+func isTar(data []byte) bool {
+	return len(data) > 262 && string(data[257:262]) == "ustar"
+}
+
+// Read the ROM out of a zip file.
+func extractZIP(data []byte, entry string) ([]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var entries []archiveEntry
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		f := f
+		entries = append(entries, archiveEntry{
+			name: f.Name,
+			open: func() (io.Reader, error) { return f.Open() },
+		})
+	}
+	return readArchiveEntry(entries, entry)
+}
+
+// Read a gzip file, which may be a single ROM or a tar file of ROMs.
+func extractGZIP(data []byte, entry string) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	data, err = readLimited(reader)
+	if err != nil {
+		return nil, err
+	}
+	if isTar(data) {
+		return extractTar(data, entry)
+	}
+	if entry != "" {
+		return nil, fmt.Errorf("%w: cannot read %q from a gzip file", ErrNotArchive, entry)
+	}
+	return data, nil
+}
+
+// Read the ROM out of a tar file.
+func extractTar(data []byte, entry string) ([]byte, error) {
+	reader := tar.NewReader(bytes.NewReader(data))
+	var entries []archiveEntry
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// The tar is read in order, so read the contents of each entry
+		// now in case it is chosen as the ROM
+		contents, err := readLimited(reader)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, archiveEntry{
+			name: header.Name,
+			open: func() (io.Reader, error) { return bytes.NewReader(contents), nil },
+		})
+	}
+	return readArchiveEntry(entries, entry)
+}
+
+// Choose the ROM from the entries in an archive and read it.
+func readArchiveEntry(entries []archiveEntry, name string) ([]byte, error) {
+	chosen, err := chooseArchiveEntry(entries, name)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := chosen.open()
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	return readLimited(reader)
+}
+
+// Choose the ROM from the entries in an archive. If a name is given then the
+// entry with that name (or base name) is chosen. Otherwise the only entry
+// with a ROM extension is chosen, or the only entry if the archive has a
+// single file in it.
+func chooseArchiveEntry(entries []archiveEntry, name string) (archiveEntry, error) {
+	if name != "" {
+		for _, entry := range entries {
+			if entry.name == name || path.Base(entry.name) == name {
+				return entry, nil
+			}
+		}
+		return archiveEntry{}, fmt.Errorf("%w: %q", ErrEntryNotFound, name)
+	}
+
+	var roms []archiveEntry
+	var names []string
+	for _, entry := range entries {
+		if hasROMExtension(entry.name) {
+			roms = append(roms, entry)
+			names = append(names, entry.name)
+		}
+	}
+	switch {
+	case len(roms) == 1:
+		return roms[0], nil
+	case len(roms) > 1:
+		return archiveEntry{}, fmt.Errorf("%w, choose one with archive#entry: %s", ErrMultipleROMsInArchive, strings.Join(names, ", "))
+	case len(entries) == 1:
+		return entries[0], nil
+	}
+	return archiveEntry{}, ErrNoROMInArchive
+}
+
+// Check if a file has one of the extensions of a ROM.
+func hasROMExtension(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, romExt := range romExtensions {
+		if ext == romExt {
+			return true
+		}
+	}
+	return false
+}
+
+// Read all of the data from a reader, up to the maximum size of an entry.
+func readLimited(reader io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(reader, maxArchiveEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxArchiveEntrySize {
+		return nil, fmt.Errorf("file in archive is larger than %vMB", maxArchiveEntrySize>>20)
+	}
+	return data, nil
+}
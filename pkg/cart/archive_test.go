@@ -0,0 +1,129 @@
+package cart
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A file to write into a test archive.
+type testFile struct {
+	name     string
+	contents string
+}
+
+func makeZIP(t *testing.T, files ...testFile) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, file := range files {
+		f, err := w.Create(file.name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(file.contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func makeTar(t *testing.T, files ...testFile) []byte {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, file := range files {
+		require.NoError(t, w.WriteHeader(&tar.Header{
+			Name:     file.name,
+			Mode:     0644,
+			Size:     int64(len(file.contents)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := w.Write([]byte(file.contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func makeGZIP(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestExtractROM(t *testing.T) {
+	withReadme := []testFile{
+		{"README.txt", "readme"},
+		{"docs/manual.pdf", "manual"},
+		{"game/Game.GBC", "rom"},
+	}
+	twoROMs := []testFile{
+		{"game.gb", "dmg rom"},
+		{"game.gbc", "cgb rom"},
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		entry    string
+		expected string
+		err      error
+	}{
+		{"not an archive", []byte("rom"), "", "rom", nil},
+		{"not an archive with entry", []byte("rom"), "game.gb", "", ErrNotArchive},
+		{"zip with readme", makeZIP(t, withReadme...), "", "rom", nil},
+		{"zip with one file", makeZIP(t, testFile{"game.bin", "rom"}), "", "rom", nil},
+		{"zip with two roms", makeZIP(t, twoROMs...), "", "", ErrMultipleROMsInArchive},
+		{"zip with entry", makeZIP(t, twoROMs...), "game.gbc", "cgb rom", nil},
+		{"zip with entry base name", makeZIP(t, withReadme...), "Game.GBC", "rom", nil},
+		{"zip with missing entry", makeZIP(t, twoROMs...), "game.sgb", "", ErrEntryNotFound},
+		{"zip without rom", makeZIP(t, withReadme[:2]...), "", "", ErrNoROMInArchive},
+		{"gzip", makeGZIP(t, []byte("rom")), "", "rom", nil},
+		{"tar", makeTar(t, withReadme...), "", "rom", nil},
+		{"tar.gz", makeGZIP(t, makeTar(t, withReadme...)), "", "rom", nil},
+		{"tar.gz with entry", makeGZIP(t, makeTar(t, twoROMs...)), "game.gb", "dmg rom", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := extractROM(test.data, test.entry)
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(data))
+		})
+	}
+}
+
+func TestLoadROMFile_Archive(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "roms.dat")
+	require.NoError(t, os.WriteFile(archive, makeZIP(t,
+		testFile{"readme.txt", "readme"},
+		testFile{"game.gb", "dmg rom"},
+		testFile{"game.gbc", "cgb rom"},
+	), 0644))
+
+	// Archives are detected without the extension
+	data, err := LoadROMFile(archive + "#game.gbc")
+	require.NoError(t, err)
+	assert.Equal(t, "cgb rom", string(data))
+
+	_, err = LoadROMFile(archive)
+	assert.ErrorIs(t, err, ErrMultipleROMsInArchive)
+
+	// A file with a # in its name is not split
+	named := filepath.Join(dir, "game#1.gb")
+	require.NoError(t, os.WriteFile(named, []byte("rom"), 0644))
+	data, err = LoadROMFile(named)
+	require.NoError(t, err)
+	assert.Equal(t, "rom", string(data))
+}
@@ -0,0 +1,378 @@
+package cart
+
+import (
+	"image"
+	"image/color"
+)
+
+// NewPocketCamera returns a new Pocket Camera memory controller. The camera
+// sees a blank grey image until an image source is set.
+func NewPocketCamera(data []byte) BankingController {
+	return &PocketCamera{
+		rom:      data,
+		romBanks: romBankCount(data),
+		romBank:  1,
+		ram:      make([]byte, 0x20000),
+	}
+}
+
+// PocketCamera is the cartridge of the Game Boy Camera, which has 128KB of RAM
+// and a M64282FP image sensor. The sensor registers are mapped to
+// 0xA000-0xA07F when bit 4 of the RAM bank register is set:
+//
+//	0xA000     Start capture (bit 0), which reads as 1 until it has finished
+//	0xA001     Edge enhancement mode (bits 5-7) and gain (bits 0-4)
+//	0xA002-3   Exposure time (big endian)
+//	0xA004     Edge enhancement ratio (bits 4-6) and invert (bit 3)
+//	0xA005     Output reference voltage
+//	0xA006-35  4x4 matrix of dithering thresholds, 3 bytes for each pixel
+//
+// A captured image is processed with the exposure, edge enhancement and
+// dithering, and written to RAM bank 0 at 0xA100 as 16x14 tiles. The images
+// are taken from the ImageSource, which could be a static image, a sequence of
+// images or a callback which returns a frame from a real camera.
+type PocketCamera struct {
+	dirtyTracker
+
+	rom      []byte
+	romBanks int
+	romBank  int
+
+	ram        []byte
+	ramBank    int
+	ramEnabled bool
+
+	registers [cameraRegisters]byte
+
+	// Number of clock cycles until the current capture has finished.
+	captureCycles int
+
+	source ImageSource
+}
+
+// ImageSource provides the images which are seen by the camera sensor.
+type ImageSource interface {
+	// Frame returns the image to capture. The image is cropped to the
+	// aspect ratio of the sensor, scaled and converted to greyscale. If it
+	// returns nil then the sensor sees a blank image.
+	Frame() image.Image
+}
+
+// Camera is implemented by banking controllers which have a camera that
+// captures images from an ImageSource.
+type Camera interface {
+	// SetImageSource sets the source of the images which are captured by
+	// the camera.
+	SetImageSource(source ImageSource)
+}
+
+// Size of the image captured by the sensor, and the number of registers.
+const (
+	cameraWidth     = 128
+	cameraHeight    = 112
+	cameraRegisters = 0x36
+)
+
+// Exposure time which leaves the brightness of the image unchanged.
+const cameraUnityExposure = 0x0300
+
+// Edge enhancement ratios, in quarters, selected by bits 4-6 of register 4.
+var cameraEdgeRatios = [8]int{2, 3, 4, 5, 8, 12, 16, 20}
+
+// SetImageSource sets the source of the images which are captured by the
+// camera.
+func (r *PocketCamera) SetImageSource(source ImageSource) {
+	r.source = source
+}
+
+// Read returns a value at a memory address in the ROM, RAM or the sensor
+// registers. The sensor registers are write only apart from the capture
+// register, and the RAM cannot be read while a capture is in progress.
+func (r *PocketCamera) Read(address uint16) byte {
+	switch {
+	case address < 0x8000:
+		bank := r.ROMBank(address)
+		return r.rom[(bank*0x4000+int(address&0x3FFF))%len(r.rom)]
+	case r.ramBank&0x10 != 0:
+		if address&0x7F == 0 {
+			return r.registers[0]
+		}
+		return 0x00
+	case r.captureCycles > 0:
+		return 0x00
+	default:
+		return r.ram[r.ramAddress(address)]
+	}
+}
+
+// Get the index into the RAM of an address in 0xA000-0xBFFF.
+func (r *PocketCamera) ramAddress(address uint16) int {
+	return ((r.ramBank&0xF)*0x2000 + int(address-0xA000)) % len(r.ram)
+}
+
+// ROMBank returns the ROM bank mapped to an address.
+func (r *PocketCamera) ROMBank(address uint16) int {
+	if address < 0x4000 {
+		return 0
+	}
+	return r.romBank & (r.romBanks - 1)
+}
+
+// WriteROM attempts to switch the ROM or RAM bank.
+func (r *PocketCamera) WriteROM(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		r.ramEnabled = value&0xF == 0xA
+	case address < 0x4000:
+		r.romBank = int(value & 0x3F)
+	case address < 0x6000:
+		r.ramBank = int(value & 0x1F)
+	}
+}
+
+// WriteRAM writes data to the RAM if it is enabled, or to the sensor
+// registers.
+func (r *PocketCamera) WriteRAM(address uint16, value byte) {
+	if r.ramBank&0x10 == 0 {
+		if r.ramEnabled && r.captureCycles == 0 {
+			r.ram[r.ramAddress(address)] = value
+			r.markDirty()
+		}
+		return
+	}
+	register := int(address & 0x7F)
+	if register >= cameraRegisters {
+		return
+	}
+	if register != 0 {
+		r.registers[register] = value
+		return
+	}
+	r.registers[0] = value & 0x7
+	if value&0x1 == 0 {
+		// Clearing the bit cancels the capture
+		r.captureCycles = 0
+	} else if r.captureCycles == 0 {
+		r.captureCycles = r.captureTime()
+	}
+}
+
+// Get the number of clock cycles taken to capture an image, which depends
+// on the exposure time and if the N bit is set.
+func (r *PocketCamera) captureTime() int {
+	cycles := 32446 + 16*r.exposure()
+	if r.registers[1]&0x80 == 0 {
+		cycles += 512
+	}
+	return cycles * 4
+}
+
+// Get the exposure time from registers 2 and 3.
+func (r *PocketCamera) exposure() int {
+	return int(r.registers[2])<<8 | int(r.registers[3])
+}
+
+// Tick advances the current capture by a number of clock cycles, and
+// writes the image to the RAM once it has finished.
+func (r *PocketCamera) Tick(cycles int) {
+	if r.captureCycles == 0 {
+		return
+	}
+	r.captureCycles -= cycles
+	if r.captureCycles > 0 {
+		return
+	}
+	r.captureCycles = 0
+	r.registers[0] &^= 0x1
+	r.capture()
+}
+
+// Capture an image from the source, process it and write it to the RAM.
+func (r *PocketCamera) capture() {
+	var frame image.Image
+	if r.source != nil {
+		frame = r.source.Frame()
+	}
+	pixels := sensorImage(frame)
+	r.applyExposure(&pixels)
+	r.applyEdgeEnhancement(&pixels)
+
+	for y := 0; y < cameraHeight; y++ {
+		for x := 0; x < cameraWidth; x++ {
+			shade := r.dither(x, y, pixels[y][x])
+			tile := (y/8)*(cameraWidth/8) + x/8
+			offset := 0x100 + tile*16 + (y%8)*2
+			shift := uint(7 - x%8)
+			r.ram[offset] = r.ram[offset]&^(1<<shift) | (shade&0x1)<<shift
+			r.ram[offset+1] = r.ram[offset+1]&^(1<<shift) | (shade>>1)<<shift
+		}
+	}
+	r.markDirty()
+}
+
+// Get the brightness of each pixel seen by the sensor from a frame. The frame
+// is cropped to the aspect ratio of the sensor around its centre and scaled
+// to the size of the sensor.
+func sensorImage(frame image.Image) [cameraHeight][cameraWidth]int {
+	var pixels [cameraHeight][cameraWidth]int
+	if frame == nil || frame.Bounds().Empty() {
+		for y := range pixels {
+			for x := range pixels[y] {
+				pixels[y][x] = 0x80
+			}
+		}
+		return pixels
+	}
+	bounds := frame.Bounds()
+	scale := float64(bounds.Dx()) / cameraWidth
+	if yScale := float64(bounds.Dy()) / cameraHeight; yScale < scale {
+		scale = yScale
+	}
+	left := bounds.Min.X + (bounds.Dx()-int(scale*cameraWidth))/2
+	top := bounds.Min.Y + (bounds.Dy()-int(scale*cameraHeight))/2
+	for y := range pixels {
+		for x := range pixels[y] {
+			px := left + int((float64(x)+0.5)*scale)
+			py := top + int((float64(y)+0.5)*scale)
+			pixels[y][x] = int(color.GrayModel.Convert(frame.At(px, py)).(color.Gray).Y)
+		}
+	}
+	return pixels
+}
+
+// Scale the brightness of each pixel by the exposure time, and invert the
+// image if bit 3 of register 4 is set.
+func (r *PocketCamera) applyExposure(pixels *[cameraHeight][cameraWidth]int) {
+	exposure := r.exposure()
+	invert := r.registers[4]&0x08 != 0
+	for y := range pixels {
+		for x := range pixels[y] {
+			value := clampByte(pixels[y][x] * exposure / cameraUnityExposure)
+			if invert {
+				value = 0xFF - value
+			}
+			pixels[y][x] = value
+		}
+	}
+}
+
+// Sharpen the image by adding the difference between each pixel and its
+// neighbours, scaled by the edge enhancement ratio. The VH bits of register 1
+// select the directions to enhance, where the N bit limits it to only the
+// horizontal direction.
+func (r *PocketCamera) applyEdgeEnhancement(pixels *[cameraHeight][cameraWidth]int) {
+	horizontal := r.registers[1]&0x40 != 0
+	vertical := r.registers[1]&0x20 != 0 && r.registers[1]&0x80 == 0
+	if !horizontal && !vertical {
+		return
+	}
+	ratio := cameraEdgeRatios[r.registers[4]>>4&0x7]
+	source := *pixels
+	at := func(x, y int) int {
+		x = clampInt(x, 0, cameraWidth-1)
+		y = clampInt(y, 0, cameraHeight-1)
+		return source[y][x]
+	}
+	for y := range pixels {
+		for x := range pixels[y] {
+			value := source[y][x]
+			edge := 0
+			if horizontal {
+				edge += 2*value - at(x-1, y) - at(x+1, y)
+			}
+			if vertical {
+				edge += 2*value - at(x, y-1) - at(x, y+1)
+			}
+			pixels[y][x] = clampByte(value + edge*ratio/4)
+		}
+	}
+}
+
+// Get the shade of a pixel from the dithering matrix, where brighter pixels
+// are lighter shades. Each position in the 4x4 matrix has three thresholds
+// which separate the four shades.
+func (r *PocketCamera) dither(x, y, value int) byte {
+	base := 6 + ((y&3)*4+(x&3))*3
+	switch {
+	case value < int(r.registers[base]):
+		return 3
+	case value < int(r.registers[base+1]):
+		return 2
+	case value < int(r.registers[base+2]):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Clamp a value to the range of a byte.
+func clampByte(value int) int {
+	return clampInt(value, 0, 0xFF)
+}
+
+// Clamp a value to a range.
+func clampInt(value, min, max int) int {
+	switch {
+	case value < min:
+		return min
+	case value > max:
+		return max
+	default:
+		return value
+	}
+}
+
+// GetSaveData returns the save data for this banking controller.
+func (r *PocketCamera) GetSaveData() []byte {
+	data := make([]byte, len(r.ram))
+	copy(data, r.ram)
+	return data
+}
+
+// LoadSaveData loads the save data into the cartridge.
+func (r *PocketCamera) LoadSaveData(data []byte) {
+	copy(r.ram, data)
+}
+
+// Snapshot of the internal state of a Pocket Camera cartridge.
+type cameraState struct {
+	ROMBank       int
+	RAM           []byte
+	RAMBank       int
+	RAMEnabled    bool
+	Registers     [cameraRegisters]byte
+	CaptureCycles int
+}
+
+// MarshalState returns a snapshot of the banking registers, RAM and sensor
+// registers.
+func (r *PocketCamera) MarshalState() ([]byte, error) {
+	return encodeState(cameraState{
+		ROMBank:       r.romBank,
+		RAM:           r.ram,
+		RAMBank:       r.ramBank,
+		RAMEnabled:    r.ramEnabled,
+		Registers:     r.registers,
+		CaptureCycles: r.captureCycles,
+	})
+}
+
+// UnmarshalState restores the banking registers, RAM and sensor registers
+// from a snapshot.
+func (r *PocketCamera) UnmarshalState(data []byte) error {
+	var state cameraState
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	if err := checkStateSize("RAM", state.RAM, r.ram); err != nil {
+		return err
+	}
+	r.romBank = state.ROMBank
+	copy(r.ram, state.RAM)
+	r.ramBank = state.RAMBank
+	r.ramEnabled = state.RAMEnabled
+	r.registers = state.Registers
+	r.captureCycles = state.CaptureCycles
+	r.markDirty()
+	return nil
+}
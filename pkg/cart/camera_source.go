@@ -0,0 +1,71 @@
+package cart
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+)
+
+// ImageSourceFunc is an ImageSource which calls a function to get each
+// frame, such as to capture an image from a webcam.
+type ImageSourceFunc func() image.Image
+
+// Frame returns the image returned by the function.
+func (f ImageSourceFunc) Frame() image.Image {
+	return f()
+}
+
+// NewStaticImageSource returns an ImageSource which always captures the same
+// image.
+func NewStaticImageSource(img image.Image) ImageSource {
+	return ImageSourceFunc(func() image.Image {
+		return img
+	})
+}
+
+// NewImageSequenceSource returns an ImageSource which captures each of the
+// images in turn, starting again from the first image after the last.
+func NewImageSequenceSource(images ...image.Image) ImageSource {
+	next := 0
+	return ImageSourceFunc(func() image.Image {
+		if len(images) == 0 {
+			return nil
+		}
+		img := images[next]
+		next = (next + 1) % len(images)
+		return img
+	})
+}
+
+// LoadPNGImageSource returns an ImageSource from one or more png files. A
+// single file is captured every time, and multiple files are captured as a
+// sequence.
+func LoadPNGImageSource(filenames ...string) (ImageSource, error) {
+	images := make([]image.Image, len(filenames))
+	for i, filename := range filenames {
+		img, err := loadPNG(filename)
+		if err != nil {
+			return nil, err
+		}
+		images[i] = img
+	}
+	if len(images) == 1 {
+		return NewStaticImageSource(images[0]), nil
+	}
+	return NewImageSequenceSource(images...), nil
+}
+
+// Read and decode a png file.
+func loadPNG(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", filename, err)
+	}
+	return img, nil
+}
@@ -0,0 +1,182 @@
+package cart
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create a greyscale image filled with a single brightness.
+func newGrayImage(width, height int, brightness byte) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = brightness
+	}
+	return img
+}
+
+// Create a Pocket Camera with the sensor registers selected, unity exposure
+// and a dithering matrix which splits the brightness into four even shades.
+func newCamera(source ImageSource) *PocketCamera {
+	camera := NewPocketCamera(newBankedROM(64, 0x05, 0x04)).(*PocketCamera)
+	camera.SetImageSource(source)
+	camera.WriteROM(0x4000, 0x10)
+	camera.WriteRAM(0xA002, 0x03)
+	camera.WriteRAM(0xA003, 0x00)
+	for i := uint16(0); i < 16; i++ {
+		camera.WriteRAM(0xA006+i*3, 0x40)
+		camera.WriteRAM(0xA007+i*3, 0x80)
+		camera.WriteRAM(0xA008+i*3, 0xC0)
+	}
+	return camera
+}
+
+// Start a capture and run the camera until it has finished, then select RAM
+// bank 0.
+func capture(t *testing.T, camera *PocketCamera) {
+	camera.WriteROM(0x4000, 0x10)
+	camera.WriteRAM(0xA000, 0x01)
+	require.Equal(t, byte(0x01), camera.Read(0xA000), "capture should be in progress")
+	for i := 0; i < 50000 && camera.Read(0xA000)&0x1 != 0; i++ {
+		camera.Tick(4)
+	}
+	require.Equal(t, byte(0x00), camera.Read(0xA000), "capture should have finished")
+	camera.WriteROM(0x4000, 0x00)
+}
+
+// Get the shade of a pixel from the tiles in RAM bank 0.
+func capturedShade(camera *PocketCamera, x, y int) byte {
+	offset := 0x100 + ((y/8)*16+x/8)*16 + (y%8)*2
+	bit := uint(7 - x%8)
+	return camera.ram[offset]>>bit&0x1 | (camera.ram[offset+1]>>bit&0x1)<<1
+}
+
+func TestPocketCamera_Capture(t *testing.T) {
+	camera := newCamera(NewStaticImageSource(newGrayImage(256, 224, 0x90)))
+	capture(t, camera)
+	assert.Equal(t, byte(1), capturedShade(camera, 0, 0))
+	assert.Equal(t, byte(1), capturedShade(camera, 127, 111))
+	assert.True(t, camera.IsDirty())
+
+	// Halving the exposure should darken the image
+	camera.WriteROM(0x4000, 0x10)
+	camera.WriteRAM(0xA002, 0x01)
+	camera.WriteRAM(0xA003, 0x80)
+	capture(t, camera)
+	assert.Equal(t, byte(2), capturedShade(camera, 0, 0))
+
+	// Inverting the dark image should make it light
+	camera.WriteROM(0x4000, 0x10)
+	camera.WriteRAM(0xA004, 0x08)
+	capture(t, camera)
+	assert.Equal(t, byte(1), capturedShade(camera, 0, 0))
+}
+
+func TestPocketCamera_CaptureTime(t *testing.T) {
+	camera := newCamera(nil)
+	camera.WriteRAM(0xA000, 0x01)
+	camera.Tick((32446+512+16*0x300)*4 - 4)
+	assert.Equal(t, byte(0x01), camera.Read(0xA000))
+	camera.Tick(4)
+	assert.Equal(t, byte(0x00), camera.Read(0xA000))
+
+	camera.WriteRAM(0xA001, 0x80)
+	camera.WriteRAM(0xA000, 0x01)
+	camera.Tick((32446 + 16*0x300) * 4)
+	assert.Equal(t, byte(0x00), camera.Read(0xA000), "N bit should shorten the capture")
+}
+
+func TestPocketCamera_Dithering(t *testing.T) {
+	// Horizontal gradient where each quarter is a different shade
+	gradient := image.NewGray(image.Rect(0, 0, 128, 112))
+	for y := 0; y < 112; y++ {
+		for x := 0; x < 128; x++ {
+			gradient.SetGray(x, y, color.Gray{Y: byte(x * 2)})
+		}
+	}
+	camera := newCamera(NewStaticImageSource(gradient))
+	capture(t, camera)
+	for x, shade := range map[int]byte{0: 3, 40: 2, 80: 1, 120: 0} {
+		assert.Equal(t, shade, capturedShade(camera, x, 50), "pixel %d", x)
+	}
+}
+
+func TestPocketCamera_EdgeEnhancement(t *testing.T) {
+	// Vertical edge between two similar shades
+	edge := newGrayImage(128, 112, 0x70)
+	for y := 0; y < 112; y++ {
+		for x := 64; x < 128; x++ {
+			edge.SetGray(x, y, color.Gray{Y: 0x90})
+		}
+	}
+	camera := newCamera(NewStaticImageSource(edge))
+	capture(t, camera)
+	assert.Equal(t, byte(2), capturedShade(camera, 63, 50))
+	assert.Equal(t, byte(1), capturedShade(camera, 64, 50))
+
+	// Horizontal enhancement at 200% should push the edge apart
+	camera.WriteROM(0x4000, 0x10)
+	camera.WriteRAM(0xA001, 0xC0)
+	camera.WriteRAM(0xA004, 0x40)
+	capture(t, camera)
+	assert.Equal(t, byte(3), capturedShade(camera, 63, 50))
+	assert.Equal(t, byte(0), capturedShade(camera, 64, 50))
+	assert.Equal(t, byte(2), capturedShade(camera, 30, 50), "flat areas should not change")
+}
+
+func TestPocketCamera_RAM(t *testing.T) {
+	camera := newCamera(nil)
+	camera.WriteROM(0x4000, 0x02)
+	camera.WriteRAM(0xA000, 0x12)
+	assert.Equal(t, byte(0x00), camera.Read(0xA000), "writes should be ignored while disabled")
+
+	camera.WriteROM(0x0000, 0x0A)
+	camera.WriteRAM(0xA000, 0x12)
+	assert.Equal(t, byte(0x12), camera.Read(0xA000))
+	assert.Equal(t, byte(0x12), camera.GetSaveData()[0x4000])
+
+	camera.WriteROM(0x4000, 0x10)
+	assert.Equal(t, byte(0x00), camera.Read(0xA001), "sensor registers should be write only")
+}
+
+func TestImageSequenceSource(t *testing.T) {
+	first, second := newGrayImage(1, 1, 0), newGrayImage(1, 1, 1)
+	source := NewImageSequenceSource(first, second)
+	assert.Equal(t, first, source.Frame())
+	assert.Equal(t, second, source.Frame())
+	assert.Equal(t, first, source.Frame())
+
+	assert.Nil(t, NewImageSequenceSource().Frame())
+}
+
+func TestLoadPNGImageSource(t *testing.T) {
+	dir := t.TempDir()
+	var filenames []string
+	for i, name := range []string{"a.png", "b.png"} {
+		filename := filepath.Join(dir, name)
+		f, err := os.Create(filename)
+		require.NoError(t, err)
+		require.NoError(t, png.Encode(f, newGrayImage(4, 4, byte(i))))
+		require.NoError(t, f.Close())
+		filenames = append(filenames, filename)
+	}
+
+	source, err := LoadPNGImageSource(filenames[0])
+	require.NoError(t, err)
+	assert.Equal(t, color.Gray{Y: 0}, source.Frame().At(0, 0))
+	assert.Equal(t, color.Gray{Y: 0}, source.Frame().At(0, 0))
+
+	source, err = LoadPNGImageSource(filenames...)
+	require.NoError(t, err)
+	assert.Equal(t, color.Gray{Y: 0}, source.Frame().At(0, 0))
+	assert.Equal(t, color.Gray{Y: 1}, source.Frame().At(0, 0))
+
+	_, err = LoadPNGImageSource(filepath.Join(dir, "missing.png"))
+	assert.Error(t, err)
+}
@@ -1,12 +1,12 @@
 package cart
 
 import (
-	"archive/zip"
-	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"log/slog"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -46,6 +46,56 @@ type BankingController interface {
 	// LoadSaveData loads some save data into the cartridge. The banking
 	// controller implementation can decide how this data should be loaded.
 	LoadSaveData(data []byte)
+
+	// MarshalState returns a snapshot of the internal state of the banking
+	// controller, including the bank registers, RAM and any additional
+	// hardware on the cartridge such as an RTC.
+	MarshalState() ([]byte, error)
+
+	// UnmarshalState restores the internal state of the banking controller
+	// from a snapshot previously created with MarshalState. If the snapshot
+	// is invalid or its RAM is a different size, an error is returned and
+	// the banking controller is not modified.
+	UnmarshalState(data []byte) error
+
+	// IsDirty returns if the save data has changed since ClearDirty was
+	// last called.
+	IsDirty() bool
+
+	// ClearDirty marks the save data as unchanged. This is called when the
+	// save data has been persisted.
+	ClearDirty()
+}
+
+// ROMBanker is implemented by banking controllers which can switch the ROM
+// bank that is mapped into the address space.
+type ROMBanker interface {
+	// ROMBank returns the index of the ROM bank which is currently mapped
+	// to an address in the range 0x0000-0x7FFF.
+	ROMBank(address uint16) int
+}
+
+// RAMBankWriter is implemented by banking controllers with banked RAM, so
+// that a bank can be written to without it being mapped.
+type RAMBankWriter interface {
+	// WriteRAMBank writes a value to an address in the range 0xA000-0xBFFF
+	// of a RAM bank, even if the RAM is not enabled.
+	WriteRAMBank(bank int, address uint16, value byte)
+}
+
+// Clocked is implemented by banking controllers which have hardware on the
+// cartridge that is driven by the system clock.
+type Clocked interface {
+	// Tick advances the hardware on the cartridge by a number of clock
+	// cycles at normal speed.
+	Tick(cycles int)
+}
+
+// Rumbler is implemented by banking controllers which have a rumble motor.
+type Rumbler interface {
+	// SetRumbleHandler sets a function which is called when the rumble
+	// motor is turned on or off.
+	SetRumbleHandler(handler func(on bool))
 }
 
 // Cart represents a GameBoy cartridge.
@@ -58,7 +108,12 @@ type Cart struct {
 	BankingController
 	title    string
 	filename string
-	mode     Mode
+	header   Header
+
+	store     SaveStore
+	stopSaves chan struct{}
+	savesDone chan struct{}
+	closeOnce sync.Once
 }
 
 // GetName returns the name of the cartridge. This is retrieved from the memory location
@@ -85,51 +140,194 @@ func (c *Cart) GetSaveFilename() string {
 	return c.filename + ".sav"
 }
 
+// GetStateFilename returns the name of the file that save states for the game
+// are written to. If the cartridge was not loaded from a file then this will
+// be empty.
+func (c *Cart) GetStateFilename() string {
+	if c.filename == "" {
+		return ""
+	}
+	return c.filename + ".state"
+}
+
+// GetCheatFilename returns the name of the file that cheats for the game are
+// loaded from. If the cartridge was not loaded from a file then this will be
+// empty.
+func (c *Cart) GetCheatFilename() string {
+	if c.filename == "" {
+		return ""
+	}
+	return c.filename + ".cheats"
+}
+
+// ROMBank returns the index of the ROM bank which is currently mapped to an
+// address in the range 0x0000-0x7FFF.
+func (c *Cart) ROMBank(address uint16) int {
+	if banker, ok := c.BankingController.(ROMBanker); ok {
+		return banker.ROMBank(address)
+	}
+	return int(address / 0x4000)
+}
+
+// SetAcceleration sets the acceleration of the cartridge in each axis, in
+// units of g, if it has an accelerometer. Returns false if the cartridge does
+// not have an accelerometer.
+func (c *Cart) SetAcceleration(x, y float64) bool {
+	if accelerometer, ok := c.BankingController.(Accelerometer); ok {
+		accelerometer.SetAcceleration(x, y)
+		return true
+	}
+	return false
+}
+
+// SetImageSource sets the source of the images which are captured by the
+// cartridge, if it has a camera. Returns false if the cartridge does not have
+// a camera.
+func (c *Cart) SetImageSource(source ImageSource) bool {
+	if camera, ok := c.BankingController.(Camera); ok {
+		camera.SetImageSource(source)
+		return true
+	}
+	return false
+}
+
+// SetRumbleHandler sets a function which is called when the rumble motor of
+// the cartridge is turned on or off. Returns false if the cartridge cannot
+// have a rumble motor.
+func (c *Cart) SetRumbleHandler(handler func(on bool)) bool {
+	if rumbler, ok := c.BankingController.(Rumbler); ok {
+		rumbler.SetRumbleHandler(handler)
+		return true
+	}
+	return false
+}
+
+// WriteRAMBank writes a value to an address in a bank of the cartridge RAM,
+// without switching the bank which is mapped. Returns false if the cartridge
+// does not have banked RAM.
+func (c *Cart) WriteRAMBank(bank int, address uint16, value byte) bool {
+	if writer, ok := c.BankingController.(RAMBankWriter); ok {
+		writer.WriteRAMBank(bank, address, value)
+		return true
+	}
+	return false
+}
+
 // GetMode returns the modes that this cart can run in.
 func (c *Cart) GetMode() Mode {
-	return c.mode
+	return c.header.Mode()
+}
+
+// Header returns the cartridge header of the ROM.
+func (c *Cart) Header() Header {
+	return c.header
 }
 
-// Attempt to load a save game from the expected location.
+// Attempt to load a save game from the save store and start the loop which
+// writes changes to the save data back to the store.
 func (c *Cart) initGameSaves() {
-	saveData, err := ioutil.ReadFile(c.GetSaveFilename())
-	if err == nil {
+	saveData, err := c.store.Load()
+	if err != nil {
+		log.Printf("Error loading cartridge RAM: %v", err)
+	} else if saveData != nil {
 		c.LoadSaveData(saveData)
 	}
-	// Write the RAM to file every second
-	// TODO: improve this behaviour
-	ticker := time.NewTicker(time.Second)
+	c.ClearDirty()
+
+	// Check for changes to the RAM every second until the cart is closed
+	c.stopSaves = make(chan struct{})
+	c.savesDone = make(chan struct{})
+	ticker := time.NewTicker(saveInterval)
 	go func() {
-		for range ticker.C {
-			c.Save()
+		defer close(c.savesDone)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.save(); err != nil {
+					log.Printf("Error saving cartridge RAM: %v", err)
+				}
+			case <-c.stopSaves:
+				return
+			}
 		}
 	}()
 }
 
-// Save dumps the carts RAM to the save location.
+// Save dumps the carts RAM to the save store if it has changed since it
+// was last saved.
 func (c *Cart) Save() {
+	if err := c.save(); err != nil {
+		log.Printf("Error saving cartridge RAM: %v", err)
+	}
+}
+
+// Write the save data to the store if it has changed.
+func (c *Cart) save() error {
+	if c.store == nil || !c.IsDirty() {
+		return nil
+	}
+	// Clear the flag before reading the data so that any writes while
+	// the data is being copied will be picked up by the next save.
+	c.ClearDirty()
 	data := c.BankingController.GetSaveData()
-	if len(data) > 0 {
-		err := ioutil.WriteFile(c.GetSaveFilename(), data, 0644)
-		if err != nil {
-			log.Printf("Error saving cartridge RAM: %v", err)
-		}
+	if len(data) == 0 {
+		return nil
 	}
+	return c.store.Save(data)
+}
+
+// Close stops the save loop and writes any unsaved changes to the save
+// store. It is safe to call Close multiple times.
+func (c *Cart) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		if c.stopSaves != nil {
+			close(c.stopSaves)
+			<-c.savesDone
+		}
+		err = c.save()
+	})
+	return err
 }
 
 // NewCartFromFile loads a cartridge ROM from a file.
 func NewCartFromFile(filename string) (*Cart, error) {
-	rom, err := loadROMData(filename)
+	rom, err := LoadROMFile(filename)
 	if err != nil {
 		return nil, err
 	}
 	return NewCart(rom, filename), nil
 }
 
+// LoadROMFile reads the ROM data from a file. If the file is a zip, gzip or
+// tar archive then the .gb or .gbc file in it is read as the ROM instead, or
+// the entry given in a filename in the format rom.zip#game.gbc. If there is a
+// .bps, .ups or .ips patch file next to the ROM then the patch is applied to
+// the data, and the file is left unchanged.
+func LoadROMFile(filename string) ([]byte, error) {
+	return loadROMData(filename, "")
+}
+
+// LoadPatchedROMFile reads the ROM data from a file in the same way as
+// LoadROMFile, and applies a patch file to it instead of the patch next to
+// the ROM.
+func LoadPatchedROMFile(filename, patch string) ([]byte, error) {
+	return loadROMData(filename, patch)
+}
+
 // NewCart loads a cartridge ROM from a byte array and returns a new cartridge with
 // the correct memory banking controller. If the game supports saves, then the
 // save file for the cartridge will also be loaded, and the saving loop will be
 // started to write the save data back to file.
+func NewCart(rom []byte, filename string) *Cart {
+	return NewCartWithStore(rom, filename, NewFileSaveStore(filename+".sav"))
+}
+
+// NewCartWithStore loads a cartridge ROM from a byte array and returns a new
+// cartridge, in the same way as NewCart. If the game supports saves then the
+// save data will be loaded from and written to the store instead of a file.
+// The store may be nil, in which case the save data is not persisted.
 //
 // The function will use the following list to determine which MBC to use. Not
 // all of the controllers are supported, and the function will only start the
@@ -160,32 +358,50 @@ func NewCartFromFile(filename string) (*Cart, error) {
 //     0x1C  MBC5+RUMBLE
 //     0x1D  MBC5+RUMBLE+RAM
 //     0x1E  MBC5+RUMBLE+RAM+BATTERY
+//     0x20  MBC6+RAM+BATTERY
+//     0x22  MBC7+SENSOR+RUMBLE+RAM+BATTERY
 //     0xFC  POCKET CAMERA
 //     0xFD  BANDAI TAMA5
 //     0xFE  HuC3
 //     0xFF  HuC1+RAM+BATTERY
-func NewCart(rom []byte, filename string) *Cart {
+func NewCartWithStore(rom []byte, filename string, store SaveStore) *Cart {
 	cartridge := Cart{
 		filename: filename,
-	}
-
-	// Check for GB mode
-	switch rom[0x0143] {
-	case 0x80:
-		cartridge.mode = DMG | CGB
-	case 0xC0:
-		cartridge.mode = CGB
-	default:
-		cartridge.mode = DMG
+		header:   parseHeader(rom),
+		store:    store,
 	}
 
 	// Determine cartridge type
-	mbcFlag := rom[0x147]
+	mbcFlag := cartridge.header.CartridgeType
+	if isMMM01(rom) {
+		mbcFlag = rom[len(rom)-0x8000+0x147]
+	}
 	cartType := "Unknown"
 	switch mbcFlag {
-	case 0x00, 0x08, 0x09, 0x0B, 0x0C, 0x0D:
+	case 0x00, 0x08, 0x09:
 		cartType = "ROM"
 		cartridge.BankingController = NewROM(rom)
+	case 0x0B, 0x0C, 0x0D:
+		cartType = "MMM01"
+		cartridge.BankingController = NewMMM01(rom)
+	case 0x20:
+		cartType = "MBC6"
+		cartridge.BankingController = NewMBC6(rom)
+	case 0x22:
+		cartType = "MBC7"
+		cartridge.BankingController = NewMBC7(rom)
+	case 0xFC:
+		cartType = "POCKET CAMERA"
+		cartridge.BankingController = NewPocketCamera(rom)
+	case 0xFD:
+		cartType = "TAMA5"
+		cartridge.BankingController = NewTAMA5(rom)
+	case 0xFE:
+		cartType = "HuC3"
+		cartridge.BankingController = NewHuC3(rom)
+	case 0xFF:
+		cartType = "HuC1"
+		cartridge.BankingController = NewHuC1(rom)
 	default:
 		switch {
 		case mbcFlag <= 0x03:
@@ -213,42 +429,73 @@ func NewCart(rom []byte, filename string) *Cart {
 	slog.Debug("Loaded ROM type", slog.String("type", cartType), slog.Int("mbcFlag", int(mbcFlag)))
 
 	switch mbcFlag {
-	case 0x3, 0x6, 0x9, 0xD, 0xF, 0x10, 0x13, 0x17, 0x1B, 0x1E, 0xFF:
-		cartridge.initGameSaves()
+	case 0x3, 0x6, 0x9, 0xD, 0xF, 0x10, 0x13, 0x17, 0x1B, 0x1E, 0x20, 0x22, 0xFC, 0xFD, 0xFE, 0xFF:
+		if store != nil {
+			cartridge.initGameSaves()
+		}
 	}
 	return &cartridge
 }
 
-// Open the file and load the data out of it as an array of bytes. If the file is
-// a zip file containing one file, then open that as the rom instead.
-func loadROMData(filename string) ([]byte, error) {
-	var data []byte
-	if strings.HasSuffix(filename, ".zip") {
-		return loadZIPData(filename)
+// Get the number of 16KB ROM banks from the ROM size in the cartridge header.
+// If the header is missing or invalid then the size of the data is used
+// instead. The result is always a power of two.
+func romBankCount(data []byte) int {
+	if banks := parseHeader(data).ROMBanks(); banks > 0 {
+		return banks
 	}
-	// Load the file as a rom
-	var err error
-	data, err = ioutil.ReadFile(filename)
-	if err != nil {
-		return nil, err
+	return romBanksForLength(len(data))
+}
+
+// Get the number of 16KB ROM banks needed to hold some ROM data, rounded up to
+// a power of 2.
+func romBanksForLength(length int) int {
+	banks := 2
+	for banks*0x4000 < length {
+		banks *= 2
 	}
-	return data, nil
+	return banks
+}
+
+// Write a value to an address in a 8KB bank of some RAM, wrapping around if the
+// bank is beyond the end. Returns false if there is no RAM.
+func writeRAMBank(ram []byte, bank int, address uint16, value byte) bool {
+	if len(ram) == 0 {
+		return false
+	}
+	ram[(bank*0x2000+int(address&0x1FFF))%len(ram)] = value
+	return true
 }
 
-// Load a zip file with a single rom in it.
-func loadZIPData(filename string) ([]byte, error) {
-	// Load the rom from a zip file
-	reader, err := zip.OpenReader(filename)
+// Get the size of the cartridge RAM in bytes from the RAM size in the
+// cartridge header.
+func ramSize(data []byte) int {
+	return parseHeader(data).RAMSize()
+}
+
+// Open the file and load the data out of it as an array of bytes. If the file
+// is an archive then the rom is read out of it, and an entry in the archive
+// can be chosen with a filename in the format archive#entry.
+func loadROMData(filename, patch string) ([]byte, error) {
+	filename, entry := splitArchiveEntry(filename)
+	data, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	if len(reader.File) != 1 {
-		return nil, errors.New("zip must contain one file")
-	}
-	f := reader.File[0]
-	fo, err := f.Open()
+	data, err = extractROM(data, entry)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("loading %s: %w", filename, err)
+	}
+
+	if patch == "" {
+		patch = FindPatchFile(filename)
 	}
-	return ioutil.ReadAll(fo)
+	if patch != "" {
+		data, err = ApplyPatchFile(data, patch)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Applied patch: %s", patch)
+	}
+	return data, nil
 }
@@ -53,3 +53,31 @@ func TestCart_GetMode(t *testing.T) {
 		assert.Equal(t, rom.GetMode(), DMG)
 	})
 }
+
+func TestNewCartWithStore_BankingController(t *testing.T) {
+	tests := []struct {
+		mbcFlag  byte
+		expected BankingController
+	}{
+		{0x00, &ROM{}},
+		{0x03, &MBC1{}},
+		{0x0D, &MMM01{}},
+		{0x13, &MBC3{}},
+		{0x1B, &MBC5{}},
+		{0x20, &MBC6{}},
+		{0x22, &MBC7{}},
+		{0xFC, &PocketCamera{}},
+		{0xFD, &TAMA5{}},
+		{0xFE, &HuC3{}},
+		{0xFF, &HuC1{}},
+	}
+	for _, test := range tests {
+		rom := newBankedROM(4, 0x01, 0x00)
+		rom[0x147] = test.mbcFlag
+		cart := NewCartWithStore(rom, "", nil)
+		assert.IsType(t, test.expected, cart.BankingController, "type 0x%02X", test.mbcFlag)
+	}
+
+	cart := NewCartWithStore(newMMM01ROM(), "", nil)
+	assert.IsType(t, &MMM01{}, cart.BankingController, "MMM01 header should be read from the end")
+}
@@ -0,0 +1,286 @@
+package cart
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Header is the cartridge header at 0x100-0x14F of a ROM, which describes the
+// game and the hardware on the cartridge.
+type Header struct {
+	// Title of the game in upper case ASCII. This is up to 16 characters on
+	// older cartridges and 15 characters on cartridges with a CGB flag.
+	Title string
+
+	// CGBFlag is 0x80 for games which support CGB functions and 0xC0 for
+	// games which only run on a CGB.
+	CGBFlag byte
+
+	// NewLicenseeCode is the two character publisher code, which is only
+	// used if the old licensee code is 0x33.
+	NewLicenseeCode string
+
+	// SGBFlag is 0x03 for games which support SGB functions.
+	SGBFlag byte
+
+	// CartridgeType is the memory banking controller and any additional
+	// hardware on the cartridge.
+	CartridgeType byte
+
+	// ROMSizeCode and RAMSizeCode are the sizes of the ROM and the
+	// cartridge RAM.
+	ROMSizeCode byte
+	RAMSizeCode byte
+
+	// DestinationCode is 0x00 for games sold in Japan.
+	DestinationCode byte
+
+	// OldLicenseeCode is the publisher code used by older games, where
+	// 0x33 means the new licensee code is used instead.
+	OldLicenseeCode byte
+
+	// Version is the version number of the game.
+	Version byte
+
+	// HeaderChecksum is the checksum of 0x134-0x14C, which is checked by
+	// the boot ROM.
+	HeaderChecksum byte
+
+	// GlobalChecksum is the sum of every byte in the ROM apart from the
+	// checksum itself. It is not checked by the GameBoy.
+	GlobalChecksum uint16
+}
+
+// Errors returned when validating a cartridge header.
+var (
+	ErrHeaderTooSmall = errors.New("rom is too small to contain a cartridge header")
+	ErrInvalidLogo    = errors.New("invalid nintendo logo in cartridge header")
+	ErrHeaderChecksum = errors.New("invalid cartridge header checksum")
+	ErrInvalidROMSize = errors.New("invalid rom size in cartridge header")
+	ErrInvalidRAMSize = errors.New("invalid ram size in cartridge header")
+	ErrTruncatedROM   = errors.New("rom is smaller than the size in the cartridge header")
+)
+
+// End of the cartridge header, which is where the game code starts.
+const headerEnd = 0x150
+
+// The Nintendo logo which is displayed by the boot ROM, and must be present
+// in the cartridge header at 0x104-0x133.
+var nintendoLogo = []byte{
+	0xCE, 0xED, 0x66, 0x66, 0xCC, 0x0D, 0x00, 0x0B, 0x03, 0x73, 0x00, 0x83,
+	0x00, 0x0C, 0x00, 0x0D, 0x00, 0x08, 0x11, 0x1F, 0x88, 0x89, 0x00, 0x0E,
+	0xDC, 0xCC, 0x6E, 0xE6, 0xDD, 0xDD, 0xD9, 0x99, 0xBB, 0xBB, 0x67, 0x63,
+	0x6E, 0x0E, 0xEC, 0xCC, 0xDD, 0xDC, 0x99, 0x9F, 0xBB, 0xB9, 0x33, 0x3E,
+}
+
+// ParseHeader reads the cartridge header from a ROM. The header is not
+// validated, which can be done with Validate.
+func ParseHeader(rom []byte) (Header, error) {
+	if len(rom) < headerEnd {
+		return Header{}, fmt.Errorf("%w (%v bytes)", ErrHeaderTooSmall, len(rom))
+	}
+	return parseHeader(rom), nil
+}
+
+// Read the cartridge header from some ROM data. If the data is too small to
+// contain a header then it is padded with zeros.
+func parseHeader(rom []byte) Header {
+	if len(rom) < headerEnd {
+		padded := make([]byte, headerEnd)
+		copy(padded, rom)
+		rom = padded
+	}
+	titleEnd := 0x144
+	if rom[0x143]&0x80 != 0 {
+		titleEnd = 0x143
+	}
+	title := rom[0x134:titleEnd]
+	if end := bytes.IndexByte(title, 0); end >= 0 {
+		title = title[:end]
+	}
+	return Header{
+		Title:           strings.TrimSpace(string(title)),
+		CGBFlag:         rom[0x143],
+		NewLicenseeCode: string(rom[0x144:0x146]),
+		SGBFlag:         rom[0x146],
+		CartridgeType:   rom[0x147],
+		ROMSizeCode:     rom[0x148],
+		RAMSizeCode:     rom[0x149],
+		DestinationCode: rom[0x14A],
+		OldLicenseeCode: rom[0x14B],
+		Version:         rom[0x14C],
+		HeaderChecksum:  rom[0x14D],
+		GlobalChecksum:  uint16(rom[0x14E])<<8 | uint16(rom[0x14F]),
+	}
+}
+
+// Validate checks that the header matches a ROM in the same way as the boot
+// ROM, and that the sizes in the header are valid. The global checksum is not
+// checked as it is ignored by the GameBoy, but can be checked separately with
+// ComputeGlobalChecksum.
+func (h Header) Validate(rom []byte) error {
+	if len(rom) < headerEnd {
+		return fmt.Errorf("%w (%v bytes)", ErrHeaderTooSmall, len(rom))
+	}
+	if !bytes.Equal(rom[0x104:0x134], nintendoLogo) {
+		return ErrInvalidLogo
+	}
+	if checksum := ComputeHeaderChecksum(rom); checksum != h.HeaderChecksum {
+		return fmt.Errorf("%w: header has 0x%02X but rom has 0x%02X", ErrHeaderChecksum, h.HeaderChecksum, checksum)
+	}
+	if h.ROMSize() == 0 {
+		return fmt.Errorf("%w: 0x%02X", ErrInvalidROMSize, h.ROMSizeCode)
+	}
+	if h.RAMSizeCode > 0x05 {
+		return fmt.Errorf("%w: 0x%02X", ErrInvalidRAMSize, h.RAMSizeCode)
+	}
+	if len(rom) < h.ROMSize() {
+		return fmt.Errorf("%w: header has %v bytes but rom has %v bytes", ErrTruncatedROM, h.ROMSize(), len(rom))
+	}
+	return nil
+}
+
+// ValidateROM parses and validates the cartridge header of a ROM.
+func ValidateROM(rom []byte) error {
+	header, err := ParseHeader(rom)
+	if err != nil {
+		return err
+	}
+	return header.Validate(rom)
+}
+
+// ComputeHeaderChecksum returns the checksum of the cartridge header of a ROM,
+// which should match the value at 0x14D.
+func ComputeHeaderChecksum(rom []byte) byte {
+	var checksum byte
+	for _, value := range rom[0x134:0x14D] {
+		checksum = checksum - value - 1
+	}
+	return checksum
+}
+
+// ComputeGlobalChecksum returns the sum of every byte in a ROM apart from the
+// global checksum at 0x14E-0x14F, which should match the value there.
+func ComputeGlobalChecksum(rom []byte) uint16 {
+	var checksum uint16
+	for i, value := range rom {
+		if i != 0x14E && i != 0x14F {
+			checksum += uint16(value)
+		}
+	}
+	return checksum
+}
+
+// ROMSize returns the size of the ROM in bytes, or 0 if the size is invalid.
+func (h Header) ROMSize() int {
+	return h.ROMBanks() * 0x4000
+}
+
+// ROMBanks returns the number of 16KB ROM banks, or 0 if the size is invalid.
+func (h Header) ROMBanks() int {
+	if h.ROMSizeCode > 0x08 {
+		return 0
+	}
+	return 2 << h.ROMSizeCode
+}
+
+// RAMSize returns the size of the cartridge RAM in bytes. This does not
+// include RAM which is part of the banking controller, such as on a MBC2.
+func (h Header) RAMSize() int {
+	switch h.RAMSizeCode {
+	case 0x01:
+		return 0x800
+	case 0x02:
+		return 0x2000
+	case 0x03:
+		return 0x8000
+	case 0x04:
+		return 0x20000
+	case 0x05:
+		return 0x10000
+	}
+	return 0
+}
+
+// Mode returns the modes that the game can run in.
+func (h Header) Mode() Mode {
+	switch h.CGBFlag {
+	case 0x80:
+		return DMG | CGB
+	case 0xC0:
+		return CGB
+	default:
+		return DMG
+	}
+}
+
+// SupportsSGB returns if the game supports SGB functions.
+func (h Header) SupportsSGB() bool {
+	return h.SGBFlag == 0x03
+}
+
+// Licensee returns the name of the publisher of the game, or an empty string
+// if it is not known.
+func (h Header) Licensee() string {
+	if h.OldLicenseeCode == 0x33 {
+		return newLicensees[h.NewLicenseeCode]
+	}
+	return oldLicensees[h.OldLicenseeCode]
+}
+
+// CartridgeTypeName returns the name of the hardware on the cartridge, or
+// an empty string if the type is not known.
+func (h Header) CartridgeTypeName() string {
+	return cartridgeTypes[h.CartridgeType]
+}
+
+// Names of the hardware on each type of cartridge.
+var cartridgeTypes = map[byte]string{
+	0x00: "ROM ONLY",
+	0x01: "MBC1",
+	0x02: "MBC1+RAM",
+	0x03: "MBC1+RAM+BATTERY",
+	0x05: "MBC2",
+	0x06: "MBC2+BATTERY",
+	0x08: "ROM+RAM",
+	0x09: "ROM+RAM+BATTERY",
+	0x0B: "MMM01",
+	0x0C: "MMM01+RAM",
+	0x0D: "MMM01+RAM+BATTERY",
+	0x0F: "MBC3+TIMER+BATTERY",
+	0x10: "MBC3+TIMER+RAM+BATTERY",
+	0x11: "MBC3",
+	0x12: "MBC3+RAM",
+	0x13: "MBC3+RAM+BATTERY",
+	0x15: "MBC4",
+	0x16: "MBC4+RAM",
+	0x17: "MBC4+RAM+BATTERY",
+	0x19: "MBC5",
+	0x1A: "MBC5+RAM",
+	0x1B: "MBC5+RAM+BATTERY",
+	0x1C: "MBC5+RUMBLE",
+	0x1D: "MBC5+RUMBLE+RAM",
+	0x1E: "MBC5+RUMBLE+RAM+BATTERY",
+	0x20: "MBC6+RAM+BATTERY",
+	0x22: "MBC7+SENSOR+RUMBLE+RAM+BATTERY",
+	0xFC: "POCKET CAMERA",
+	0xFD: "BANDAI TAMA5",
+	0xFE: "HuC3",
+	0xFF: "HuC1+RAM+BATTERY",
+}
+
+// FixHeader writes the Nintendo logo and the header and global checksums into
+// the cartridge header of a ROM, in the same way as rgbfix. This can be used
+// to make a ROM which has been built or patched pass validation.
+func FixHeader(rom []byte) {
+	if len(rom) < headerEnd {
+		return
+	}
+	copy(rom[0x104:], nintendoLogo)
+	rom[0x14D] = ComputeHeaderChecksum(rom)
+	checksum := ComputeGlobalChecksum(rom)
+	rom[0x14E] = byte(checksum >> 8)
+	rom[0x14F] = byte(checksum)
+}
@@ -0,0 +1,124 @@
+package cart
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create a 32KB rom with a valid header.
+func validROM() []byte {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x134:], "TESTROM")
+	FixHeader(rom)
+	return rom
+}
+
+func TestParseHeader(t *testing.T) {
+	rom, err := os.ReadFile("./../../roms/blargg/cpu_instrs.gb")
+	require.NoError(t, err)
+
+	header, err := ParseHeader(rom)
+	require.NoError(t, err)
+	assert.Equal(t, "CPU_INSTRS", header.Title)
+	assert.Equal(t, byte(0x80), header.CGBFlag)
+	assert.Equal(t, DMG|CGB, header.Mode())
+	assert.False(t, header.SupportsSGB())
+	assert.Equal(t, "MBC1", header.CartridgeTypeName())
+	assert.Equal(t, 0x10000, header.ROMSize())
+	assert.Equal(t, 4, header.ROMBanks())
+	assert.Equal(t, 0, header.RAMSize())
+	assert.Equal(t, "None", header.Licensee())
+	assert.Equal(t, byte(0x3B), header.HeaderChecksum)
+	assert.Equal(t, uint16(0xF530), header.GlobalChecksum)
+
+	assert.NoError(t, header.Validate(rom))
+	assert.Equal(t, header.HeaderChecksum, ComputeHeaderChecksum(rom))
+	assert.NotEqual(t, header.GlobalChecksum, ComputeGlobalChecksum(rom), "test rom has an invalid global checksum")
+
+	fixed := append([]byte{}, rom...)
+	FixHeader(fixed)
+	assert.Equal(t, rom[:0x14E], fixed[:0x14E], "only the global checksum should be changed")
+	assert.Equal(t, ComputeGlobalChecksum(rom), parseHeader(fixed).GlobalChecksum)
+
+	_, err = ParseHeader(rom[:0x100])
+	assert.ErrorIs(t, err, ErrHeaderTooSmall)
+}
+
+func TestHeader_Licensee(t *testing.T) {
+	assert.Equal(t, "Capcom", Header{OldLicenseeCode: 0x08}.Licensee())
+	assert.Equal(t, "Konami", Header{OldLicenseeCode: 0x33, NewLicenseeCode: "34"}.Licensee())
+	assert.Equal(t, "", Header{OldLicenseeCode: 0x33, NewLicenseeCode: "ZZ"}.Licensee())
+}
+
+func TestValidateROM(t *testing.T) {
+	assert.NoError(t, ValidateROM(validROM()))
+
+	tests := []struct {
+		name   string
+		modify func(rom []byte) []byte
+		err    error
+	}{
+		{"too small", func(rom []byte) []byte { return rom[:0x14F] }, ErrHeaderTooSmall},
+		{"logo", func(rom []byte) []byte { rom[0x120] ^= 0xFF; return rom }, ErrInvalidLogo},
+		{"header checksum", func(rom []byte) []byte { rom[0x14D]++; return rom }, ErrHeaderChecksum},
+		{"title changed", func(rom []byte) []byte { rom[0x134] = 'X'; return rom }, ErrHeaderChecksum},
+		{"rom size", func(rom []byte) []byte { rom[0x148] = 0x20; FixHeader(rom); return rom }, ErrInvalidROMSize},
+		{"ram size", func(rom []byte) []byte { rom[0x149] = 0x06; FixHeader(rom); return rom }, ErrInvalidRAMSize},
+		{"truncated", func(rom []byte) []byte { rom[0x148] = 0x02; FixHeader(rom); return rom }, ErrTruncatedROM},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.ErrorIs(t, ValidateROM(test.modify(validROM())), test.err)
+		})
+	}
+
+	t.Run("global checksum is ignored", func(t *testing.T) {
+		rom := validROM()
+		rom[0x4000] = 0x12
+		assert.NoError(t, ValidateROM(rom))
+		assert.NotEqual(t, parseHeader(rom).GlobalChecksum, ComputeGlobalChecksum(rom))
+	})
+}
+
+func TestHeader_Sizes(t *testing.T) {
+	tests := []struct {
+		romCode, ramCode byte
+		romBanks         int
+		ramSize          int
+	}{
+		{0x00, 0x00, 2, 0},
+		{0x01, 0x01, 4, 0x800},
+		{0x05, 0x02, 64, 0x2000},
+		{0x06, 0x03, 128, 0x8000},
+		{0x08, 0x04, 512, 0x20000},
+		{0x08, 0x05, 512, 0x10000},
+	}
+	for _, test := range tests {
+		header := Header{ROMSizeCode: test.romCode, RAMSizeCode: test.ramCode}
+		assert.Equal(t, test.romBanks, header.ROMBanks())
+		assert.Equal(t, test.romBanks*0x4000, header.ROMSize())
+		assert.Equal(t, test.ramSize, header.RAMSize())
+	}
+}
+
+func TestNewCart_SizesFromHeader(t *testing.T) {
+	// MBC5+RAM with 8KB of RAM in the header
+	rom := make([]byte, 0x10000)
+	rom[0x147] = 0x1A
+	rom[0x148] = 0x01
+	rom[0x149] = 0x02
+	FixHeader(rom)
+	cart := NewCart(rom, "test")
+	assert.Equal(t, rom[0x147], cart.Header().CartridgeType)
+
+	cart.WriteROM(0x0000, 0x0A)
+	cart.WriteRAM(0xA000, 0x42)
+	assert.Len(t, cart.GetSaveData(), 0x2000)
+
+	// RAM bank 1 wraps around to bank 0
+	cart.WriteROM(0x4000, 0x01)
+	assert.Equal(t, byte(0x42), cart.Read(0xA000))
+}
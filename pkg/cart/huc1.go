@@ -0,0 +1,132 @@
+package cart
+
+// NewHuC1 returns a new HuC1 memory controller.
+func NewHuC1(data []byte) BankingController {
+	return &HuC1{
+		rom:      data,
+		romBanks: romBankCount(data),
+		romBank:  1,
+		ram:      make([]byte, ramSize(data)),
+	}
+}
+
+// HuC1 is a Hudson cartridge which supports rom and ram banking, and has an
+// infrared LED and sensor in place of the RAM when IR mode is selected. The
+// infrared port is not connected to anything, so the sensor never sees any
+// light and the LED is ignored.
+type HuC1 struct {
+	dirtyTracker
+
+	rom      []byte
+	romBanks int
+	romBank  int
+
+	ram     []byte
+	ramBank int
+	irMode  bool
+}
+
+// Value read from the IR sensor when no light is detected.
+const irNoLight = 0xC0
+
+// Read returns a value at a memory address in the ROM, RAM or IR sensor.
+func (r *HuC1) Read(address uint16) byte {
+	switch {
+	case address < 0x8000:
+		bank := r.ROMBank(address)
+		return r.rom[(bank*0x4000+int(address&0x3FFF))%len(r.rom)]
+	case r.irMode:
+		return irNoLight
+	case len(r.ram) == 0:
+		return 0xFF
+	default:
+		return r.ram[r.ramAddress(address)]
+	}
+}
+
+// Get the index into the RAM of an address in 0xA000-0xBFFF.
+func (r *HuC1) ramAddress(address uint16) int {
+	return (r.ramBank*0x2000 + int(address-0xA000)) % len(r.ram)
+}
+
+// ROMBank returns the ROM bank mapped to an address.
+func (r *HuC1) ROMBank(address uint16) int {
+	if address < 0x4000 {
+		return 0
+	}
+	return r.romBank & (r.romBanks - 1)
+}
+
+// WriteROM attempts to switch the ROM or RAM bank, or select IR mode.
+func (r *HuC1) WriteROM(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		// IR mode select, where the RAM is always enabled otherwise
+		r.irMode = value&0xF == 0xE
+	case address < 0x4000:
+		// ROM bank number
+		r.romBank = int(value & 0x3F)
+		if r.romBank == 0 {
+			r.romBank = 1
+		}
+	case address < 0x6000:
+		// RAM bank number
+		r.ramBank = int(value & 0x3)
+	}
+}
+
+// WriteRAM writes data to the ram, or to the IR LED in IR mode.
+func (r *HuC1) WriteRAM(address uint16, value byte) {
+	if r.irMode || len(r.ram) == 0 {
+		return
+	}
+	r.ram[r.ramAddress(address)] = value
+	r.markDirty()
+}
+
+// GetSaveData returns the save data for this banking controller.
+func (r *HuC1) GetSaveData() []byte {
+	data := make([]byte, len(r.ram))
+	copy(data, r.ram)
+	return data
+}
+
+// LoadSaveData loads the save data into the cartridge.
+func (r *HuC1) LoadSaveData(data []byte) {
+	copy(r.ram, data)
+}
+
+// Snapshot of the internal state of a HuC1 cartridge.
+type huc1State struct {
+	ROMBank int
+	RAM     []byte
+	RAMBank int
+	IRMode  bool
+}
+
+// MarshalState returns a snapshot of the banking registers and RAM.
+func (r *HuC1) MarshalState() ([]byte, error) {
+	return encodeState(huc1State{
+		ROMBank: r.romBank,
+		RAM:     r.ram,
+		RAMBank: r.ramBank,
+		IRMode:  r.irMode,
+	})
+}
+
+// UnmarshalState restores the banking registers and RAM from a snapshot.
+func (r *HuC1) UnmarshalState(data []byte) error {
+	var state huc1State
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	if err := checkStateSize("RAM", state.RAM, r.ram); err != nil {
+		return err
+	}
+	r.romBank = state.ROMBank
+	copy(r.ram, state.RAM)
+	r.ramBank = state.RAMBank
+	r.irMode = state.IRMode
+	r.markDirty()
+	return nil
+}
@@ -0,0 +1,299 @@
+package cart
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// NewHuC3 returns a new HuC3 memory controller.
+func NewHuC3(data []byte) BankingController {
+	return &HuC3{
+		rom:      data,
+		romBanks: romBankCount(data),
+		romBank:  1,
+		ram:      make([]byte, ramSize(data)),
+	}
+}
+
+// HuC3 is a Hudson cartridge which supports rom and ram banking, and has a
+// real time clock and an infrared port. The mode register at 0x0000-0x1FFF
+// selects what is mapped to 0xA000-0xBFFF:
+//
+//	0x0  RAM (read only)
+//	0xA  RAM
+//	0xB  RTC command (write only)
+//	0xC  RTC response (read only)
+//	0xD  RTC semaphore, which reads as ready
+//	0xE  IR port
+//
+// The RTC is controlled by writing commands, which read and write a memory of
+// 256 nibbles. The clock is copied to and from the first 6 nibbles of the
+// memory as the minute of the day and the day counter.
+type HuC3 struct {
+	dirtyTracker
+
+	rom      []byte
+	romBanks int
+	romBank  int
+
+	ram     []byte
+	ramBank int
+	mode    byte
+
+	clock    huc3Clock
+	memory   [0x100]byte
+	index    byte
+	command  byte
+	response byte
+}
+
+// Commands which can be written to the HuC3 RTC in the upper nibble.
+const (
+	huc3Read        = 0x1
+	huc3Write       = 0x3
+	huc3SetIndexLow = 0x4
+	huc3SetIndexHi  = 0x5
+	huc3Extended    = 0x6
+)
+
+// Read returns a value at a memory address in the ROM, RAM, RTC or IR port.
+func (r *HuC3) Read(address uint16) byte {
+	if address < 0x8000 {
+		bank := r.ROMBank(address)
+		return r.rom[(bank*0x4000+int(address&0x3FFF))%len(r.rom)]
+	}
+	switch r.mode {
+	case 0x0, 0xA:
+		if len(r.ram) == 0 {
+			return 0xFF
+		}
+		return r.ram[r.ramAddress(address)]
+	case 0xC:
+		return r.command<<4 | r.response
+	case 0xD:
+		return 0xFF
+	case 0xE:
+		return irNoLight
+	}
+	return 0xFF
+}
+
+// Get the index into the RAM of an address in 0xA000-0xBFFF.
+func (r *HuC3) ramAddress(address uint16) int {
+	return (r.ramBank*0x2000 + int(address-0xA000)) % len(r.ram)
+}
+
+// ROMBank returns the ROM bank mapped to an address.
+func (r *HuC3) ROMBank(address uint16) int {
+	if address < 0x4000 {
+		return 0
+	}
+	return r.romBank & (r.romBanks - 1)
+}
+
+// WriteROM attempts to switch the ROM or RAM bank, or select the mode.
+func (r *HuC3) WriteROM(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		r.mode = value & 0xF
+	case address < 0x4000:
+		// ROM bank number
+		r.romBank = int(value & 0x7F)
+		if r.romBank == 0 {
+			r.romBank = 1
+		}
+	case address < 0x6000:
+		// RAM bank number
+		r.ramBank = int(value & 0x3)
+	}
+}
+
+// WriteRAM writes data to the ram or sends a command to the RTC, depending
+// on the mode.
+func (r *HuC3) WriteRAM(address uint16, value byte) {
+	switch r.mode {
+	case 0xA:
+		if len(r.ram) > 0 {
+			r.ram[r.ramAddress(address)] = value
+			r.markDirty()
+		}
+	case 0xB:
+		r.runCommand(value>>4&0x7, value&0xF)
+	}
+}
+
+// Run a command on the RTC with a nibble argument.
+func (r *HuC3) runCommand(command, arg byte) {
+	r.command = command
+	switch command {
+	case huc3Read:
+		r.response = r.memory[r.index]
+		r.index++
+	case huc3Write:
+		r.memory[r.index] = arg
+		r.index++
+		r.markDirty()
+	case huc3SetIndexLow:
+		r.index = r.index&0xF0 | arg
+	case huc3SetIndexHi:
+		r.index = r.index&0x0F | arg<<4
+	case huc3Extended:
+		switch arg {
+		case 0x0:
+			// Copy the clock to the memory
+			putNibbles(r.memory[0:3], r.clock.Minutes)
+			putNibbles(r.memory[3:6], r.clock.Days)
+		case 0x1:
+			// Set the clock from the memory
+			r.clock.Minutes = getNibbles(r.memory[0:3]) % minutesPerDay
+			r.clock.Days = getNibbles(r.memory[3:6])
+			r.clock.Cycles = 0
+			r.markDirty()
+		case 0x2:
+			// Status, which is always ready
+			r.response = 0x1
+		}
+	}
+}
+
+// Write a value into a slice of nibbles, least significant first.
+func putNibbles(nibbles []byte, value int) {
+	for i := range nibbles {
+		nibbles[i] = byte(value>>(4*uint(i))) & 0xF
+	}
+}
+
+// Read a value from a slice of nibbles, least significant first.
+func getNibbles(nibbles []byte) int {
+	value := 0
+	for i := range nibbles {
+		value |= int(nibbles[i]&0xF) << (4 * uint(i))
+	}
+	return value
+}
+
+// Number of minutes in a day, after which the HuC3 day counter increments.
+const minutesPerDay = 24 * 60
+
+// Number of clock cycles in each minute of the HuC3 clock.
+const huc3CyclesPerMinute = 60 * rtcCyclesPerSecond
+
+// huc3Clock is the clock of a HuC3 cartridge, which counts minutes of the
+// day and a 12 bit day counter. It is advanced by the emulated clock cycles,
+// and is only caught up with the wall clock when the save data is loaded.
+type huc3Clock struct {
+	Minutes int
+	Days    int
+
+	// Number of clock cycles since the last minute.
+	Cycles int
+}
+
+// Advance the clock by a number of clock cycles.
+func (c *huc3Clock) update(cycles int) {
+	c.Cycles += cycles
+	if c.Cycles < huc3CyclesPerMinute {
+		return
+	}
+	c.advance(c.Cycles / huc3CyclesPerMinute)
+	c.Cycles %= huc3CyclesPerMinute
+}
+
+// Advance the clock by a number of minutes.
+func (c *huc3Clock) advance(minutes int) {
+	total := c.Minutes + minutes
+	c.Minutes = total % minutesPerDay
+	c.Days = (c.Days + total/minutesPerDay) & 0xFFF
+}
+
+// Tick advances the clock by a number of clock cycles.
+func (r *HuC3) Tick(cycles int) {
+	r.clock.update(cycles)
+}
+
+// Length of the clock data appended to the RAM in the save data: the minute
+// of the day and the day counter as 32 bit values, followed by the 64 bit unix
+// timestamp of the save and the RTC memory.
+const huc3FooterLength = 16 + 0x100
+
+// GetSaveData returns the save data for this banking controller, which is
+// the RAM followed by the clock and the current time.
+func (r *HuC3) GetSaveData() []byte {
+	footer := make([]byte, huc3FooterLength)
+	binary.LittleEndian.PutUint32(footer[0:], uint32(r.clock.Minutes))
+	binary.LittleEndian.PutUint32(footer[4:], uint32(r.clock.Days))
+	binary.LittleEndian.PutUint64(footer[8:], uint64(now().Unix()))
+	copy(footer[16:], r.memory[:])
+
+	data := make([]byte, len(r.ram), len(r.ram)+huc3FooterLength)
+	copy(data, r.ram)
+	return append(data, footer...)
+}
+
+// LoadSaveData loads the save data into the cartridge. The clock is advanced
+// by the time which has passed since it was saved.
+func (r *HuC3) LoadSaveData(data []byte) {
+	copy(r.ram, data)
+	if len(data) != len(r.ram)+huc3FooterLength {
+		return
+	}
+	footer := data[len(r.ram):]
+	r.clock.Minutes = int(binary.LittleEndian.Uint32(footer[0:])) % minutesPerDay
+	r.clock.Days = int(binary.LittleEndian.Uint32(footer[4:])) & 0xFFF
+	r.clock.Cycles = 0
+	saved := time.Unix(int64(binary.LittleEndian.Uint64(footer[8:])), 0)
+	if elapsed := now().Sub(saved); elapsed > 0 {
+		r.clock.update(int(elapsed / time.Second * rtcCyclesPerSecond))
+	}
+	copy(r.memory[:], footer[16:])
+}
+
+// Snapshot of the internal state of a HuC3 cartridge.
+type huc3State struct {
+	ROMBank  int
+	RAM      []byte
+	RAMBank  int
+	Mode     byte
+	Clock    huc3Clock
+	Memory   [0x100]byte
+	Index    byte
+	Command  byte
+	Response byte
+}
+
+// MarshalState returns a snapshot of the banking registers, RAM and RTC.
+func (r *HuC3) MarshalState() ([]byte, error) {
+	return encodeState(huc3State{
+		ROMBank:  r.romBank,
+		RAM:      r.ram,
+		RAMBank:  r.ramBank,
+		Mode:     r.mode,
+		Clock:    r.clock,
+		Memory:   r.memory,
+		Index:    r.index,
+		Command:  r.command,
+		Response: r.response,
+	})
+}
+
+// UnmarshalState restores the banking registers, RAM and RTC from a snapshot.
+func (r *HuC3) UnmarshalState(data []byte) error {
+	var state huc3State
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	if err := checkStateSize("RAM", state.RAM, r.ram); err != nil {
+		return err
+	}
+	r.romBank = state.ROMBank
+	copy(r.ram, state.RAM)
+	r.ramBank = state.RAMBank
+	r.mode = state.Mode
+	r.clock = state.Clock
+	r.memory = state.Memory
+	r.index = state.Index
+	r.command = state.Command
+	r.response = state.Response
+	r.markDirty()
+	return nil
+}
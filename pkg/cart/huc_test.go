@@ -0,0 +1,119 @@
+package cart
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHuC1_Banking(t *testing.T) {
+	data := newBankedROM(64, 0x05, 0x03)
+	data[0x147] = 0xFF
+	mbc := NewHuC1(data)
+	assert.Equal(t, byte(1), mbc.Read(0x4000))
+	mbc.WriteROM(0x2000, 0x00)
+	assert.Equal(t, byte(1), mbc.Read(0x4000))
+	mbc.WriteROM(0x2000, 0x3F)
+	assert.Equal(t, byte(0x3F), mbc.Read(0x4000))
+
+	mbc.WriteROM(0x4000, 0x02)
+	mbc.WriteRAM(0xA010, 0x12)
+	assert.Equal(t, byte(0x12), mbc.Read(0xA010))
+	assert.Equal(t, byte(0x12), mbc.GetSaveData()[0x4010])
+}
+
+func TestHuC1_IRMode(t *testing.T) {
+	mbc := NewHuC1(newBankedROM(4, 0x01, 0x02))
+	mbc.WriteROM(0x0000, 0x0E)
+	assert.Equal(t, byte(irNoLight), mbc.Read(0xA000))
+	mbc.WriteRAM(0xA000, 0x01)
+
+	mbc.WriteROM(0x0000, 0x00)
+	assert.Equal(t, byte(0x00), mbc.Read(0xA000), "LED writes should not change the RAM")
+}
+
+// Create a HuC3 cartridge with 8KB of RAM.
+func newHuC3() *HuC3 {
+	data := newBankedROM(8, 0x02, 0x02)
+	data[0x147] = 0xFE
+	return NewHuC3(data).(*HuC3)
+}
+
+// Send a command to the HuC3 RTC.
+func huc3Command(mbc *HuC3, command, arg byte) {
+	mbc.WriteROM(0x0000, 0x0B)
+	mbc.WriteRAM(0xA000, command<<4|arg)
+}
+
+// Read the clock from the HuC3 RTC memory as minutes and days.
+func readHuC3Clock(mbc *HuC3) (int, int) {
+	huc3Command(mbc, huc3Extended, 0x0)
+	huc3Command(mbc, huc3SetIndexLow, 0x0)
+	huc3Command(mbc, huc3SetIndexHi, 0x0)
+	var nibbles [6]byte
+	for i := range nibbles {
+		huc3Command(mbc, huc3Read, 0)
+		mbc.WriteROM(0x0000, 0x0C)
+		nibbles[i] = mbc.Read(0xA000) & 0xF
+	}
+	return getNibbles(nibbles[0:3]), getNibbles(nibbles[3:6])
+}
+
+func TestHuC3_RAM(t *testing.T) {
+	mbc := newHuC3()
+	mbc.WriteROM(0x0000, 0x0A)
+	mbc.WriteRAM(0xA000, 0x12)
+	assert.Equal(t, byte(0x12), mbc.Read(0xA000))
+
+	mbc.WriteROM(0x0000, 0x00)
+	mbc.WriteRAM(0xA000, 0x34)
+	assert.Equal(t, byte(0x12), mbc.Read(0xA000), "RAM should be read only in mode 0")
+
+	mbc.WriteROM(0x0000, 0x0D)
+	assert.Equal(t, byte(0xFF), mbc.Read(0xA000), "semaphore should read as ready")
+	mbc.WriteROM(0x0000, 0x0E)
+	assert.Equal(t, byte(irNoLight), mbc.Read(0xA000))
+}
+
+func TestHuC3_RTC(t *testing.T) {
+	mbc := newHuC3()
+
+	// Set the clock to day 2 at 23:58
+	huc3Command(mbc, huc3SetIndexLow, 0x0)
+	huc3Command(mbc, huc3SetIndexHi, 0x0)
+	for _, nibble := range []byte{0xE, 0x9, 0x5, 0x2, 0x0, 0x0} {
+		huc3Command(mbc, huc3Write, nibble)
+	}
+	huc3Command(mbc, huc3Extended, 0x1)
+
+	minutes, days := readHuC3Clock(mbc)
+	assert.Equal(t, 23*60+58, minutes)
+	assert.Equal(t, 2, days)
+
+	mbc.Tick(5 * huc3CyclesPerMinute)
+	minutes, days = readHuC3Clock(mbc)
+	assert.Equal(t, 3, minutes)
+	assert.Equal(t, 3, days)
+
+	huc3Command(mbc, huc3Extended, 0x2)
+	mbc.WriteROM(0x0000, 0x0C)
+	assert.Equal(t, byte(huc3Extended<<4|0x1), mbc.Read(0xA000))
+}
+
+func TestHuC3_SaveData(t *testing.T) {
+	clock := setClock(t, time.Unix(1000000, 0))
+	mbc := newHuC3()
+	mbc.clock.Minutes = 100
+	mbc.memory[0x10] = 0x7
+
+	data := mbc.GetSaveData()
+	require.Len(t, data, 0x2000+huc3FooterLength)
+
+	*clock = clock.Add(2 * time.Hour)
+	loaded := newHuC3()
+	loaded.LoadSaveData(data)
+	assert.Equal(t, 220, loaded.clock.Minutes, "clock should advance while saved")
+	assert.Equal(t, byte(0x7), loaded.memory[0x10])
+}
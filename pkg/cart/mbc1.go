@@ -1,36 +1,82 @@
 package cart
 
-// NewMBC1 returns a new MBC1 memory controller.
+import "bytes"
+
+// NewMBC1 returns a new MBC1 memory controller. The size of the ROM and RAM
+// are read from the cartridge header, and MBC1M multicarts are detected from
+// the logo in the header of the second game.
 func NewMBC1(data []byte) BankingController {
 	return &MBC1{
-		rom:     data,
-		romBank: 1,
-		ram:     make([]byte, 0x8000),
+		rom:       data,
+		romBanks:  romBankCount(data),
+		ram:       make([]byte, ramSize(data)),
+		bank1:     1,
+		multicart: isMBC1Multicart(data),
 	}
 }
 
 // MBC1 is a GameBoy cartridge that supports rom and ram banking.
+//
+// The bank is selected by two registers: BANK1 holds the lower 5 bits of the
+// ROM bank, and BANK2 holds 2 more bits which are used as the upper bits of the
+// ROM bank. In mode 1, BANK2 also selects the RAM bank and the ROM bank mapped
+// to 0x0000-0x3FFF. On a multicart, BANK1 only provides 4 bits of the bank so
+// BANK2 selects which of the games is mapped.
 type MBC1 struct {
-	rom     []byte
-	romBank uint32
+	dirtyTracker
+
+	rom      []byte
+	romBanks int
 
 	ram        []byte
-	ramBank    uint32
 	ramEnabled bool
 
-	romBanking bool
+	bank1     byte
+	bank2     byte
+	mode      bool
+	multicart bool
 }
 
-// Read returns a value at a memory address in the ROM or RAM.
+// Read returns a value at a memory address in the ROM or RAM. Reading from
+// the RAM while it is disabled returns 0xFF.
 func (r *MBC1) Read(address uint16) byte {
 	switch {
-	case address < 0x4000:
-		return r.rom[address] // Bank 0 is fixed
 	case address < 0x8000:
-		return r.rom[uint32(address-0x4000)+(r.romBank*0x4000)] // Use selected rom bank
+		bank := r.ROMBank(address)
+		return r.rom[(bank*0x4000+int(address&0x3FFF))%len(r.rom)]
 	default:
-		return r.ram[(0x2000*r.ramBank)+uint32(address-0xA000)] // Use selected ram bank
+		if !r.ramEnabled || len(r.ram) == 0 {
+			return 0xFF
+		}
+		return r.ram[r.ramAddress(address)]
+	}
+}
+
+// ROMBank returns the ROM bank mapped to an address.
+func (r *MBC1) ROMBank(address uint16) int {
+	shift := uint(5)
+	bank1 := int(r.bank1)
+	if r.multicart {
+		shift = 4
+		bank1 &= 0xF
+	}
+	bank := int(r.bank2) << shift
+	if address >= 0x4000 {
+		bank |= bank1
+	} else if !r.mode {
+		bank = 0
 	}
+	return bank & (r.romBanks - 1)
+}
+
+// Get the index into the RAM of an address in 0xA000-0xBFFF. The RAM bank
+// is only selected by BANK2 in mode 1, and smaller RAM sizes are mirrored.
+func (r *MBC1) ramAddress(address uint16) int {
+	bank := 0
+	if r.mode {
+		bank = int(r.bank2)
+	}
+	return (bank*0x2000 + int(address-0xA000)) % len(r.ram)
 }
 
 // WriteROM attempts to switch the ROM or RAM bank.
@@ -38,45 +84,34 @@ func (r *MBC1) WriteROM(address uint16, value byte) {
 	switch {
 	case address < 0x2000:
 		// RAM enable
-		if value&0xF == 0xA {
-			r.ramEnabled = true
-		} else if value&0xF == 0x0 {
-			r.ramEnabled = false
-		}
+		r.ramEnabled = value&0xF == 0xA
 	case address < 0x4000:
-		// ROM bank number (lower 5)
-		r.romBank = (r.romBank & 0xe0) | uint32(value&0x1f)
-		r.updateRomBankIfZero()
-	case address < 0x6000:
-		// ROM/RAM banking
-		if r.romBanking {
-			r.romBank = (r.romBank & 0x1F) | uint32(value&0xe0)
-			r.updateRomBankIfZero()
-		} else {
-			r.ramBank = uint32(value & 0x3)
+		// ROM bank number (lower 5), where a bank of 0 is treated as 1
+		r.bank1 = value & 0x1F
+		if r.bank1 == 0 {
+			r.bank1 = 1
 		}
+	case address < 0x6000:
+		// ROM bank number (upper 2) or RAM bank number
+		r.bank2 = value & 0x3
 	case address < 0x8000:
-		// ROM/RAM select mode
-		r.romBanking = value&0x1 == 0x00
-		if r.romBanking {
-			r.ramBank = 0
-		} else {
-			r.romBank = r.romBank & 0x1F
-		}
+		// ROM/RAM banking mode select
+		r.mode = value&0x1 == 0x1
 	}
 }
 
-// Update the romBank if it is on a value which cannot be used.
-func (r *MBC1) updateRomBankIfZero() {
-	if r.romBank == 0x00 || r.romBank == 0x20 || r.romBank == 0x40 || r.romBank == 0x60 {
-		r.romBank++
+// WriteRAM writes data to the ram if it is enabled.
+func (r *MBC1) WriteRAM(address uint16, value byte) {
+	if r.ramEnabled && len(r.ram) > 0 {
+		r.ram[r.ramAddress(address)] = value
+		r.markDirty()
 	}
 }
 
-// WriteRAM writes data to the ram if it is enabled.
-func (r *MBC1) WriteRAM(address uint16, value byte) {
-	if r.ramEnabled {
-		r.ram[(0x2000*r.ramBank)+uint32(address-0xA000)] = value
+// WriteRAMBank writes a value to a RAM bank without switching to it.
+func (r *MBC1) WriteRAMBank(bank int, address uint16, value byte) {
+	if writeRAMBank(r.ram, bank, address, value) {
+		r.markDirty()
 	}
 }
 
@@ -89,5 +124,54 @@ func (r *MBC1) GetSaveData() []byte {
 
 // LoadSaveData loads the save data into the cartridge.
 func (r *MBC1) LoadSaveData(data []byte) {
-	r.ram = data
+	copy(r.ram, data)
+}
+
+// Snapshot of the internal state of a MBC1 cartridge.
+type mbc1State struct {
+	RAM        []byte
+	RAMEnabled bool
+	Bank1      byte
+	Bank2      byte
+	Mode       bool
+}
+
+// MarshalState returns a snapshot of the banking registers and RAM.
+func (r *MBC1) MarshalState() ([]byte, error) {
+	return encodeState(mbc1State{
+		RAM:        r.ram,
+		RAMEnabled: r.ramEnabled,
+		Bank1:      r.bank1,
+		Bank2:      r.bank2,
+		Mode:       r.mode,
+	})
+}
+
+// UnmarshalState restores the banking registers and RAM from a snapshot.
+func (r *MBC1) UnmarshalState(data []byte) error {
+	var state mbc1State
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	if err := checkStateSize("RAM", state.RAM, r.ram); err != nil {
+		return err
+	}
+	copy(r.ram, state.RAM)
+	r.ramEnabled = state.RAMEnabled
+	r.bank1 = state.Bank1
+	r.bank2 = state.Bank2
+	r.mode = state.Mode
+	r.markDirty()
+	return nil
+}
+
+// Check if a ROM is an MBC1M multicart. These are 8Mbit carts made up of
+// four 2Mbit games, which are detected by the Nintendo logo in the header
+// of the game starting at bank 0x10.
+func isMBC1Multicart(data []byte) bool {
+	const second = 0x10 * 0x4000
+	if len(data) != 0x100000 {
+		return false
+	}
+	return bytes.Equal(nintendoLogo, data[second+0x104:second+0x134])
 }
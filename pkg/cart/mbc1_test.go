@@ -0,0 +1,137 @@
+package cart
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Create a ROM with a number of banks where the first byte of each bank is
+// the index of the bank, and the header has the given ROM and RAM sizes.
+func newBankedROM(banks int, romSize, ramSize byte) []byte {
+	data := make([]byte, banks*0x4000)
+	for i := 0; i < banks; i++ {
+		data[i*0x4000] = byte(i)
+	}
+	data[0x147] = 0x03
+	data[0x148] = romSize
+	data[0x149] = ramSize
+	return data
+}
+
+func TestMBC1_ROMBanking(t *testing.T) {
+	mbc := NewMBC1(newBankedROM(128, 0x06, 0x00))
+	assert.Equal(t, byte(1), mbc.Read(0x4000), "bank 1 should be mapped by default")
+
+	mbc.WriteROM(0x2000, 0x00)
+	assert.Equal(t, byte(1), mbc.Read(0x4000), "bank 0 should map bank 1")
+	mbc.WriteROM(0x2000, 0x25)
+	assert.Equal(t, byte(5), mbc.Read(0x4000), "only the lower 5 bits should be used")
+
+	mbc.WriteROM(0x4000, 0x02)
+	assert.Equal(t, byte(0x45), mbc.Read(0x4000))
+	assert.Equal(t, byte(0), mbc.Read(0x0000), "bank 0 should be mapped in mode 0")
+	mbc.WriteROM(0x2000, 0x00)
+	assert.Equal(t, byte(0x41), mbc.Read(0x4000), "bank 0x40 should map bank 0x41")
+
+	mbc.WriteROM(0x6000, 0x01)
+	assert.Equal(t, byte(0x40), mbc.Read(0x0000), "BANK2 should apply to 0x0000 in mode 1")
+	assert.Equal(t, byte(0x41), mbc.Read(0x4000))
+}
+
+func TestMBC1_ROMMasking(t *testing.T) {
+	mbc := NewMBC1(newBankedROM(16, 0x03, 0x00))
+	mbc.WriteROM(0x2000, 0x13)
+	assert.Equal(t, byte(3), mbc.Read(0x4000), "bank should be masked to the ROM size")
+	mbc.WriteROM(0x2000, 0x10)
+	assert.Equal(t, byte(0), mbc.Read(0x4000), "masked bank 0 should be readable")
+
+	mbc.WriteROM(0x4000, 0x03)
+	mbc.WriteROM(0x6000, 0x01)
+	assert.Equal(t, byte(0), mbc.Read(0x0000))
+}
+
+func TestMBC1_RAMEnable(t *testing.T) {
+	mbc := NewMBC1(newBankedROM(4, 0x01, 0x02))
+	mbc.WriteRAM(0xA000, 0x12)
+	assert.Equal(t, byte(0xFF), mbc.Read(0xA000), "RAM should read 0xFF while disabled")
+
+	mbc.WriteROM(0x0000, 0x1A)
+	assert.Equal(t, byte(0x00), mbc.Read(0xA000), "writes should be ignored while disabled")
+	mbc.WriteRAM(0xA000, 0x12)
+	assert.Equal(t, byte(0x12), mbc.Read(0xA000))
+
+	mbc.WriteROM(0x0000, 0x0B)
+	assert.Equal(t, byte(0xFF), mbc.Read(0xA000))
+}
+
+func TestMBC1_RAMBanking(t *testing.T) {
+	mbc := NewMBC1(newBankedROM(4, 0x01, 0x03))
+	mbc.WriteROM(0x0000, 0x0A)
+	mbc.WriteROM(0x4000, 0x02)
+	mbc.WriteRAM(0xA000, 0x12)
+
+	mbc.WriteROM(0x6000, 0x01)
+	mbc.WriteRAM(0xA000, 0x34)
+	assert.Equal(t, byte(0x34), mbc.Read(0xA000))
+	mbc.WriteROM(0x6000, 0x00)
+	assert.Equal(t, byte(0x12), mbc.Read(0xA000), "RAM bank 0 should be used in mode 0")
+
+	data := mbc.GetSaveData()
+	assert.Len(t, data, 0x8000, "save data should be sized from the header")
+	assert.Equal(t, byte(0x34), data[0x4000])
+}
+
+func TestMBC1_SmallRAM(t *testing.T) {
+	mbc := NewMBC1(newBankedROM(4, 0x01, 0x01))
+	mbc.WriteROM(0x0000, 0x0A)
+	mbc.WriteRAM(0xA000, 0x12)
+	assert.Equal(t, byte(0x12), mbc.Read(0xA800), "2KB RAM should be mirrored")
+	assert.Len(t, mbc.GetSaveData(), 0x800)
+
+	mbc = NewMBC1(newBankedROM(4, 0x01, 0x00))
+	mbc.WriteROM(0x0000, 0x0A)
+	mbc.WriteRAM(0xA000, 0x12)
+	assert.Equal(t, byte(0xFF), mbc.Read(0xA000), "carts without RAM should read 0xFF")
+}
+
+func TestMBC1_Multicart(t *testing.T) {
+	data := newBankedROM(64, 0x05, 0x00)
+	copy(data[0x104:], nintendoLogo)
+	copy(data[0x10*0x4000+0x104:], nintendoLogo)
+	mbc := NewMBC1(data)
+
+	mbc.WriteROM(0x2000, 0x12)
+	assert.Equal(t, byte(0x02), mbc.Read(0x4000), "only 4 bits of BANK1 should be used")
+	mbc.WriteROM(0x4000, 0x01)
+	assert.Equal(t, byte(0x12), mbc.Read(0x4000))
+	assert.Equal(t, byte(0x00), mbc.Read(0x0000))
+
+	mbc.WriteROM(0x6000, 0x01)
+	assert.Equal(t, byte(0x10), mbc.Read(0x0000), "BANK2 should select the game in mode 1")
+
+	mbc.WriteROM(0x2000, 0x10)
+	assert.Equal(t, byte(0x10), mbc.Read(0x4000), "bank 0x10 should not be mapped to 0x11")
+}
+
+func TestMBC1_NotMulticart(t *testing.T) {
+	data := newBankedROM(64, 0x05, 0x00)
+	mbc := NewMBC1(data)
+	mbc.WriteROM(0x2000, 0x12)
+	assert.Equal(t, byte(0x12), mbc.Read(0x4000))
+}
+
+func TestMBC1_UnmarshalStateRAMSize(t *testing.T) {
+	large := NewMBC1(newBankedROM(4, 0x01, 0x03))
+	state, err := large.MarshalState()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	mbc := NewMBC1(newBankedROM(4, 0x01, 0x02))
+	mbc.WriteROM(0x0000, 0x0A)
+	mbc.WriteRAM(0xA000, 0x42)
+	assert.ErrorContains(t, mbc.UnmarshalState(state), "bytes of RAM")
+	assert.Equal(t, byte(0x42), mbc.Read(0xA000), "RAM should not be modified")
+	assert.Len(t, mbc.GetSaveData(), 0x2000, "RAM should not be resized")
+}
@@ -3,16 +3,20 @@ package cart
 // NewMBC2 returns a new MBC2 memory controller.
 func NewMBC2(data []byte) BankingController {
 	return &MBC2{
-		rom:     data,
-		romBank: 1,
-		ram:     make([]byte, 0x2000),
+		rom:      data,
+		romBanks: romBankCount(data),
+		romBank:  1,
+		ram:      make([]byte, 0x2000),
 	}
 }
 
 // MBC2 is a basic Gameboy cartridge.
 type MBC2 struct {
-	rom     []byte
-	romBank uint32
+	dirtyTracker
+
+	rom      []byte
+	romBanks int
+	romBank  uint32
 
 	ram        []byte
 	ramEnabled bool
@@ -21,15 +25,22 @@ type MBC2 struct {
 // Read returns a value at a memory address in the ROM or RAM.
 func (r *MBC2) Read(address uint16) byte {
 	switch {
-	case address < 0x4000:
-		return r.rom[address] // Bank 0 is fixed
 	case address < 0x8000:
-		return r.rom[uint32(address-0x4000)+(r.romBank*0x4000)] // Use selected rom bank
+		bank := r.ROMBank(address)
+		return r.rom[(bank*0x4000+int(address&0x3FFF))%len(r.rom)]
 	default:
 		return r.ram[address-0xA000] // Use ram
 	}
 }
 
+// ROMBank returns the ROM bank mapped to an address.
+func (r *MBC2) ROMBank(address uint16) int {
+	if address < 0x4000 {
+		return 0
+	}
+	return int(r.romBank) & (r.romBanks - 1)
+}
+
 // WriteROM attempts to switch the ROM or RAM bank.
 func (r *MBC2) WriteROM(address uint16, value byte) {
 	switch {
@@ -59,6 +70,7 @@ func (r *MBC2) WriteROM(address uint16, value byte) {
 func (r *MBC2) WriteRAM(address uint16, value byte) {
 	if r.ramEnabled {
 		r.ram[address-0xA000] = value & 0xF
+		r.markDirty()
 	}
 }
 
@@ -71,5 +83,37 @@ func (r *MBC2) GetSaveData() []byte {
 
 // LoadSaveData loads the save data into the cartridge.
 func (r *MBC2) LoadSaveData(data []byte) {
-	r.ram = data
+	copy(r.ram, data)
+}
+
+// Snapshot of the internal state of a MBC2 cartridge.
+type mbc2State struct {
+	ROMBank    uint32
+	RAM        []byte
+	RAMEnabled bool
+}
+
+// MarshalState returns a snapshot of the banking registers and RAM.
+func (r *MBC2) MarshalState() ([]byte, error) {
+	return encodeState(mbc2State{
+		ROMBank:    r.romBank,
+		RAM:        r.ram,
+		RAMEnabled: r.ramEnabled,
+	})
+}
+
+// UnmarshalState restores the banking registers and RAM from a snapshot.
+func (r *MBC2) UnmarshalState(data []byte) error {
+	var state mbc2State
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	if err := checkStateSize("RAM", state.RAM, r.ram); err != nil {
+		return err
+	}
+	r.romBank = state.ROMBank
+	copy(r.ram, state.RAM)
+	r.ramEnabled = state.RAMEnabled
+	r.markDirty()
+	return nil
 }
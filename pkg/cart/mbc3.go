@@ -1,55 +1,79 @@
 package cart
 
-// NewMBC3 returns a new MBC3 memory controller.
+// NewMBC3 returns a new MBC3 memory controller. The size of the RAM is read
+// from the cartridge header, and the cartridge type selects if the cartridge
+// has a real time clock.
 func NewMBC3(data []byte) BankingController {
 	return &MBC3{
-		rom:        data,
-		romBank:    1,
-		ram:        make([]byte, 0x8000),
-		rtc:        make([]byte, 0x10),
-		latchedRtc: make([]byte, 0x10),
+		rom:      data,
+		romBanks: romBankCount(data),
+		romBank:  1,
+		ram:      make([]byte, ramSize(data)),
+		hasTimer: data[0x147] == 0x0F || data[0x147] == 0x10,
 	}
 }
 
 // MBC3 is a GameBoy cartridge that supports rom and ram banking and possibly
 // a real time clock (RTC).
 type MBC3 struct {
-	rom     []byte
-	romBank uint32
+	dirtyTracker
+
+	rom      []byte
+	romBanks int
+	romBank  uint32
 
 	ram        []byte
 	ramBank    uint32
 	ramEnabled bool
 
-	rtc        []byte
-	latchedRtc []byte
-	latched    bool
+	// The clock is copied to the latched clock when 0x00 and then 0x01 are
+	// written to 0x6000-0x7FFF, and the latched registers are the ones
+	// which are read.
+	hasTimer   bool
+	rtc        rtc
+	latchedRtc rtc
+	latchValue byte
 }
 
-// Read returns a value at a memory address in the ROM.
+// Read returns a value at a memory address in the ROM, RAM or RTC registers.
 func (r *MBC3) Read(address uint16) byte {
 	switch {
-	case address < 0x4000:
-		return r.rom[address] // Bank 0 is fixed
 	case address < 0x8000:
-		return r.rom[uint32(address-0x4000)+(r.romBank*0x4000)] // Use selected rom bank
+		bank := r.ROMBank(address)
+		return r.rom[(bank*0x4000+int(address&0x3FFF))%len(r.rom)]
 	default:
-		if r.ramBank >= 0x4 {
-			if r.latched {
-				return r.latchedRtc[r.ramBank]
-			}
-			return r.rtc[r.ramBank]
+		if !r.ramEnabled {
+			return 0xFF
+		}
+		if r.ramBank >= 0x08 && r.ramBank <= 0x0C && r.hasTimer {
+			return r.latchedRtc.read(byte(r.ramBank))
+		}
+		if r.ramBank > 0x03 || len(r.ram) == 0 {
+			return 0xFF
 		}
-		return r.ram[(0x2000*r.ramBank)+uint32(address-0xA000)] // Use selected ram bank
+		return r.ram[r.ramAddress(address)] // Use selected ram bank
+	}
+}
+
+// Get the index into the RAM of an address in 0xA000-0xBFFF.
+func (r *MBC3) ramAddress(address uint16) int {
+	return (0x2000*int(r.ramBank) + int(address-0xA000)) % len(r.ram)
+}
+
+// ROMBank returns the ROM bank mapped to an address.
+func (r *MBC3) ROMBank(address uint16) int {
+	if address < 0x4000 {
+		return 0
 	}
+	return int(r.romBank) & (r.romBanks - 1)
 }
 
-// WriteROM attempts to switch the ROM or RAM bank.
+// WriteROM attempts to switch the ROM or RAM bank, or latch the RTC.
 func (r *MBC3) WriteROM(address uint16, value byte) {
 	switch {
 	case address < 0x2000:
-		// RAM enable
-		r.ramEnabled = (value & 0xA) != 0
+		// RAM and RTC enable
+		r.ramEnabled = value&0xF == 0xA
 	case address < 0x4000:
 		// ROM bank number (lower 5)
 		r.romBank = uint32(value & 0x7F)
@@ -57,36 +81,107 @@ func (r *MBC3) WriteROM(address uint16, value byte) {
 			r.romBank++
 		}
 	case address < 0x6000:
+		// RAM bank number or RTC register select
 		r.ramBank = uint32(value)
 	case address < 0x8000:
-		if value == 0x1 {
-			r.latched = false
-		} else if value == 0x0 {
-			r.latched = true
-			copy(r.rtc, r.latchedRtc)
+		// Latch the clock on a write of 0x00 followed by 0x01
+		if r.latchValue == 0x00 && value == 0x01 {
+			r.latchedRtc = r.rtc
 		}
+		r.latchValue = value
 	}
 }
 
 // WriteRAM writes data to the ram or RTC if it is enabled.
 func (r *MBC3) WriteRAM(address uint16, value byte) {
-	if r.ramEnabled {
-		if r.ramBank >= 0x4 {
-			r.rtc[r.ramBank] = value
-		} else {
-			r.ram[(0x2000*r.ramBank)+uint32(address-0xA000)] = value
-		}
+	if !r.ramEnabled {
+		return
+	}
+	switch {
+	case r.ramBank >= 0x08 && r.ramBank <= 0x0C && r.hasTimer:
+		r.rtc.write(byte(r.ramBank), value)
+		r.markDirty()
+	case r.ramBank <= 0x03 && len(r.ram) > 0:
+		r.ram[r.ramAddress(address)] = value
+		r.markDirty()
+	}
+}
+
+// WriteRAMBank writes a value to a RAM bank without switching to it.
+func (r *MBC3) WriteRAMBank(bank int, address uint16, value byte) {
+	if writeRAMBank(r.ram, bank, address, value) {
+		r.markDirty()
+	}
+}
+
+// Tick advances the RTC by a number of clock cycles.
+func (r *MBC3) Tick(cycles int) {
+	if r.hasTimer {
+		r.rtc.update(cycles)
 	}
 }
 
-// GetSaveData returns the save data for this banking controller.
+// GetSaveData returns the save data for this banking controller. If the
+// cartridge has a RTC then the clock is appended to the RAM.
 func (r *MBC3) GetSaveData() []byte {
 	data := make([]byte, len(r.ram))
 	copy(data, r.ram)
+	if r.hasTimer {
+		data = appendRTCFooter(data, &r.rtc, &r.latchedRtc)
+	}
 	return data
 }
 
-// LoadSaveData loads the save data into the cartridge.
+// LoadSaveData loads the save data into the cartridge. If the data contains
+// a RTC footer, then the clock is loaded and advanced by the time which has
+// passed since it was saved.
 func (r *MBC3) LoadSaveData(data []byte) {
-	r.ram = data
+	copy(r.ram, data)
+	if r.hasTimer && len(data) > len(r.ram) {
+		readRTCFooter(data, len(r.ram), &r.rtc, &r.latchedRtc)
+	}
+}
+
+// Snapshot of the internal state of a MBC3 cartridge.
+type mbc3State struct {
+	ROMBank    uint32
+	RAM        []byte
+	RAMBank    uint32
+	RAMEnabled bool
+	RTC        rtc
+	LatchedRTC rtc
+	LatchValue byte
+}
+
+// MarshalState returns a snapshot of the banking registers, RAM and RTC.
+func (r *MBC3) MarshalState() ([]byte, error) {
+	return encodeState(mbc3State{
+		ROMBank:    r.romBank,
+		RAM:        r.ram,
+		RAMBank:    r.ramBank,
+		RAMEnabled: r.ramEnabled,
+		RTC:        r.rtc,
+		LatchedRTC: r.latchedRtc,
+		LatchValue: r.latchValue,
+	})
+}
+
+// UnmarshalState restores the banking registers, RAM and RTC from a snapshot.
+func (r *MBC3) UnmarshalState(data []byte) error {
+	var state mbc3State
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	if err := checkStateSize("RAM", state.RAM, r.ram); err != nil {
+		return err
+	}
+	r.romBank = state.ROMBank
+	copy(r.ram, state.RAM)
+	r.ramBank = state.RAMBank
+	r.ramEnabled = state.RAMEnabled
+	r.rtc = state.RTC
+	r.latchedRtc = state.LatchedRTC
+	r.latchValue = state.LatchValue
+	r.markDirty()
+	return nil
 }
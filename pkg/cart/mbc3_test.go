@@ -0,0 +1,163 @@
+package cart
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Replace the wall clock used when saving and loading the RTC for the
+// duration of a test.
+func setClock(t *testing.T, start time.Time) *time.Time {
+	current := start
+	now = func() time.Time { return current }
+	t.Cleanup(func() { now = time.Now })
+	return &current
+}
+
+// Create a MBC3+TIMER+RAM+BATTERY cartridge with 8KB of RAM and enable the
+// RAM and RTC.
+func newTimerMBC3() *MBC3 {
+	data := make([]byte, 0x8000)
+	data[0x147] = 0x10
+	data[0x149] = 0x02
+	mbc := NewMBC3(data).(*MBC3)
+	mbc.WriteROM(0x0000, 0x0A)
+	return mbc
+}
+
+// Latch the clock and read one of the RTC registers.
+func readRTC(mbc *MBC3, register byte) byte {
+	mbc.WriteROM(0x6000, 0x00)
+	mbc.WriteROM(0x6000, 0x01)
+	mbc.WriteROM(0x4000, register)
+	return mbc.Read(0xA000)
+}
+
+// Write to one of the RTC registers.
+func writeRTC(mbc *MBC3, register, value byte) {
+	mbc.WriteROM(0x4000, register)
+	mbc.WriteRAM(0xA000, value)
+}
+
+// Advance the RTC by a number of seconds of clock cycles.
+func tickRTC(mbc *MBC3, seconds int) {
+	mbc.Tick(seconds * rtcCyclesPerSecond)
+}
+
+func TestMBC3_RTCTicks(t *testing.T) {
+	mbc := newTimerMBC3()
+	assert.Equal(t, byte(0), readRTC(mbc, 0x08))
+
+	mbc.Tick(rtcCyclesPerSecond - 4)
+	assert.Equal(t, byte(0), readRTC(mbc, 0x08))
+	mbc.Tick(4)
+	assert.Equal(t, byte(1), readRTC(mbc, 0x08))
+
+	tickRTC(mbc, 3*3600+25*60+6)
+	mbc.Tick(rtcCyclesPerSecond / 2)
+	assert.Equal(t, byte(7), readRTC(mbc, 0x08))
+	assert.Equal(t, byte(25), readRTC(mbc, 0x09))
+	assert.Equal(t, byte(3), readRTC(mbc, 0x0A))
+
+	tickRTC(mbc, 300*86400)
+	assert.Equal(t, byte(300&0xFF), readRTC(mbc, 0x0B))
+	assert.Equal(t, byte(0x01), readRTC(mbc, 0x0C), "day bit 8 should be set")
+
+	tickRTC(mbc, 300*86400)
+	assert.Equal(t, byte(600-512), readRTC(mbc, 0x0B))
+	assert.Equal(t, byte(0x80), readRTC(mbc, 0x0C), "day carry should be set")
+}
+
+func TestMBC3_RTCLatch(t *testing.T) {
+	mbc := newTimerMBC3()
+	assert.Equal(t, byte(0), readRTC(mbc, 0x08))
+
+	tickRTC(mbc, 5)
+	assert.Equal(t, byte(0), mbc.Read(0xA000), "registers should not change until latched")
+	mbc.WriteROM(0x6000, 0x01)
+	assert.Equal(t, byte(0), mbc.Read(0xA000), "writing 0x01 without 0x00 should not latch")
+	mbc.WriteROM(0x6000, 0x00)
+	mbc.WriteROM(0x6000, 0x01)
+	assert.Equal(t, byte(5), mbc.Read(0xA000))
+}
+
+func TestMBC3_RTCHalt(t *testing.T) {
+	mbc := newTimerMBC3()
+	writeRTC(mbc, 0x0C, 0x40)
+	writeRTC(mbc, 0x08, 30)
+
+	tickRTC(mbc, 60)
+	assert.Equal(t, byte(30), readRTC(mbc, 0x08), "clock should not advance while halted")
+	assert.Equal(t, byte(0x40), readRTC(mbc, 0x0C))
+
+	writeRTC(mbc, 0x0C, 0x00)
+	tickRTC(mbc, 2)
+	assert.Equal(t, byte(32), readRTC(mbc, 0x08))
+}
+
+func TestMBC3_RTCOutOfRange(t *testing.T) {
+	mbc := newTimerMBC3()
+	writeRTC(mbc, 0x08, 62)
+
+	tickRTC(mbc, 2)
+	assert.Equal(t, byte(0), readRTC(mbc, 0x08), "seconds should overflow at 64")
+	assert.Equal(t, byte(0), readRTC(mbc, 0x09), "overflow should not carry to the minutes")
+
+	tickRTC(mbc, 61)
+	assert.Equal(t, byte(1), readRTC(mbc, 0x08))
+	assert.Equal(t, byte(1), readRTC(mbc, 0x09))
+}
+
+func TestMBC3_RTCSaveData(t *testing.T) {
+	clock := setClock(t, time.Unix(1000, 0))
+	mbc := newTimerMBC3()
+	mbc.WriteROM(0x4000, 0x00)
+	mbc.WriteRAM(0xA000, 0x42)
+	writeRTC(mbc, 0x0A, 5)
+	writeRTC(mbc, 0x0C, 0x01)
+
+	data := mbc.GetSaveData()
+	require.Len(t, data, 0x2000+rtcFooterLength)
+	assert.Equal(t, byte(0x42), data[0])
+	assert.Equal(t, byte(5), data[0x2000+8], "hours should be in the footer")
+	assert.Equal(t, byte(1), data[0x2000+16], "day high should be in the footer")
+	assert.Equal(t, byte(1000&0xFF), data[0x2000+40], "timestamp should be in the footer")
+
+	// Loading the save data an hour later should catch the clock up
+	*clock = clock.Add(time.Hour)
+	loaded := newTimerMBC3()
+	loaded.LoadSaveData(data)
+	assert.Equal(t, byte(0x42), loaded.Read(0xA000))
+	assert.Equal(t, byte(6), readRTC(loaded, 0x0A))
+	assert.Equal(t, byte(0x01), readRTC(loaded, 0x0C))
+
+	// Time passing while the game is running should not change the clock
+	*clock = clock.Add(time.Hour)
+	assert.Equal(t, byte(6), readRTC(loaded, 0x0A))
+}
+
+func TestMBC3_RTCShortFooter(t *testing.T) {
+	setClock(t, time.Unix(1000, 0))
+	data := make([]byte, 0x2000+rtcShortFooterLength)
+	data[0x2000] = 10      // Seconds
+	data[0x2000+40] = 0xE0 // Timestamp of 992
+	data[0x2000+41] = 0x03
+	mbc := newTimerMBC3()
+	mbc.LoadSaveData(data)
+	assert.Equal(t, byte(18), readRTC(mbc, 0x08))
+}
+
+func TestMBC3_NoTimer(t *testing.T) {
+	data := make([]byte, 0x8000)
+	data[0x147] = 0x13
+	data[0x149] = 0x03
+	mbc := NewMBC3(data)
+	assert.Len(t, mbc.GetSaveData(), 0x8000, "carts without a RTC should not have a footer")
+
+	mbc.WriteROM(0x0000, 0x0A)
+	mbc.WriteROM(0x4000, 0x08)
+	assert.Equal(t, byte(0xFF), mbc.Read(0xA000))
+}
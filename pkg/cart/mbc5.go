@@ -1,34 +1,78 @@
 package cart
 
-// NewMBC5 returns a new MBC5 memory controller.
+// NewMBC5 returns a new MBC5 memory controller. The size of the RAM is read
+// from the cartridge header, and the cartridge type selects if the cartridge
+// has a rumble motor.
 func NewMBC5(data []byte) BankingController {
 	return &MBC5{
-		rom:     data,
-		romBank: 1,
-		ram:     make([]byte, 0x20000),
+		rom:       data,
+		romBanks:  romBankCount(data),
+		romBank:   1,
+		ram:       make([]byte, ramSize(data)),
+		hasRumble: data[0x147] >= 0x1C && data[0x147] <= 0x1E,
 	}
 }
 
-// MBC5 is a GameBoy cartridge that supports rom and ram banking.
+// MBC5 is a GameBoy cartridge that supports rom and ram banking and possibly
+// a rumble motor. On cartridges with a rumble motor, bit 3 of the RAM bank
+// register turns the motor on instead of selecting the bank.
 type MBC5 struct {
-	rom     []byte
-	romBank uint32
+	dirtyTracker
+
+	rom      []byte
+	romBanks int
+	romBank  uint32
 
 	ram        []byte
 	ramBank    uint32
 	ramEnabled bool
+
+	hasRumble     bool
+	rumble        bool
+	rumbleHandler func(on bool)
+}
+
+// SetRumbleHandler sets a function which is called when the rumble motor is
+// turned on or off.
+func (r *MBC5) SetRumbleHandler(handler func(on bool)) {
+	r.rumbleHandler = handler
+}
+
+// Turn the rumble motor on or off, and call the handler if it has changed.
+func (r *MBC5) setRumble(on bool) {
+	if on == r.rumble {
+		return
+	}
+	r.rumble = on
+	if r.rumbleHandler != nil {
+		r.rumbleHandler(on)
+	}
 }
 
 // Read returns a value at a memory address in the ROM.
 func (r *MBC5) Read(address uint16) byte {
 	switch {
-	case address < 0x4000:
-		return r.rom[address] // Bank 0 is fixed
 	case address < 0x8000:
-		return r.rom[uint32(address-0x4000)+(r.romBank*0x4000)] // Use selected rom bank
+		bank := r.ROMBank(address)
+		return r.rom[(bank*0x4000+int(address&0x3FFF))%len(r.rom)]
+	case len(r.ram) == 0:
+		return 0xFF
 	default:
-		return r.ram[(0x2000*r.ramBank)+uint32(address-0xA000)] // Use selected ram bank
+		return r.ram[r.ramAddress(address)] // Use selected ram bank
+	}
+}
+
+// ROMBank returns the ROM bank mapped to an address.
+func (r *MBC5) ROMBank(address uint16) int {
+	if address < 0x4000 {
+		return 0
 	}
+	return int(r.romBank) & (r.romBanks - 1)
+}
+
+// Get the index into the RAM of an address in 0xA000-0xBFFF.
+func (r *MBC5) ramAddress(address uint16) int {
+	return (0x2000*int(r.ramBank) + int(address-0xA000)) % len(r.ram)
 }
 
 // WriteROM attempts to switch the ROM or RAM bank.
@@ -48,14 +92,27 @@ func (r *MBC5) WriteROM(address uint16, value byte) {
 		// ROM/RAM banking
 		r.romBank = (r.romBank & 0xFF) | uint32(value&0x01)<<8
 	case address < 0x6000:
-		r.ramBank = uint32(value & 0xF)
+		if r.hasRumble {
+			r.ramBank = uint32(value & 0x7)
+			r.setRumble(value&0x08 != 0)
+		} else {
+			r.ramBank = uint32(value & 0xF)
+		}
 	}
 }
 
 // WriteRAM writes data to the ram if it is enabled.
 func (r *MBC5) WriteRAM(address uint16, value byte) {
-	if r.ramEnabled {
-		r.ram[(0x2000*r.ramBank)+uint32(address-0xA000)] = value
+	if r.ramEnabled && len(r.ram) > 0 {
+		r.ram[r.ramAddress(address)] = value
+		r.markDirty()
+	}
+}
+
+// WriteRAMBank writes a value to a RAM bank without switching to it.
+func (r *MBC5) WriteRAMBank(bank int, address uint16, value byte) {
+	if writeRAMBank(r.ram, bank, address, value) {
+		r.markDirty()
 	}
 }
 
@@ -68,5 +125,45 @@ func (r *MBC5) GetSaveData() []byte {
 
 // LoadSaveData loads the save data into the cartridge.
 func (r *MBC5) LoadSaveData(data []byte) {
-	r.ram = data
+	copy(r.ram, data)
+}
+
+// Snapshot of the internal state of a MBC5 cartridge.
+type mbc5State struct {
+	ROMBank    uint32
+	RAM        []byte
+	RAMBank    uint32
+	RAMEnabled bool
+	Rumble     bool
+}
+
+// MarshalState returns a snapshot of the banking registers, RAM and rumble
+// motor.
+func (r *MBC5) MarshalState() ([]byte, error) {
+	return encodeState(mbc5State{
+		ROMBank:    r.romBank,
+		RAM:        r.ram,
+		RAMBank:    r.ramBank,
+		RAMEnabled: r.ramEnabled,
+		Rumble:     r.rumble,
+	})
+}
+
+// UnmarshalState restores the banking registers, RAM and rumble motor from a
+// snapshot.
+func (r *MBC5) UnmarshalState(data []byte) error {
+	var state mbc5State
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	if err := checkStateSize("RAM", state.RAM, r.ram); err != nil {
+		return err
+	}
+	r.romBank = state.ROMBank
+	copy(r.ram, state.RAM)
+	r.ramBank = state.RAMBank
+	r.ramEnabled = state.RAMEnabled
+	r.setRumble(state.Rumble)
+	r.markDirty()
+	return nil
 }
@@ -0,0 +1,47 @@
+package cart
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMBC5_RAMBanking(t *testing.T) {
+	data := newBankedROM(4, 0x01, 0x04)
+	data[0x147] = 0x1B
+	mbc := NewMBC5(data)
+	mbc.WriteROM(0x0000, 0x0A)
+	mbc.WriteROM(0x4000, 0x0F)
+	mbc.WriteRAM(0xA000, 0x12)
+	assert.Equal(t, byte(0x12), mbc.GetSaveData()[0xF*0x2000], "bit 3 should select the bank")
+}
+
+func TestMBC5_Rumble(t *testing.T) {
+	data := newBankedROM(4, 0x01, 0x04)
+	data[0x147] = 0x1E
+	mbc := NewMBC5(data)
+
+	var events []bool
+	cart := &Cart{BankingController: mbc}
+	require.True(t, cart.SetRumbleHandler(func(on bool) {
+		events = append(events, on)
+	}))
+
+	mbc.WriteROM(0x0000, 0x0A)
+	mbc.WriteROM(0x4000, 0x0B)
+	mbc.WriteRAM(0xA000, 0x12)
+	assert.Equal(t, byte(0x12), mbc.GetSaveData()[0x3*0x2000], "bit 3 should not select the bank")
+
+	mbc.WriteROM(0x4000, 0x08)
+	mbc.WriteROM(0x4000, 0x00)
+	mbc.WriteROM(0x4000, 0x00)
+	assert.Equal(t, []bool{true, false}, events, "handler should only be called on changes")
+
+	mbc.WriteROM(0x4000, 0x08)
+	state, err := mbc.MarshalState()
+	require.NoError(t, err)
+	mbc.WriteROM(0x4000, 0x00)
+	require.NoError(t, mbc.UnmarshalState(state))
+	assert.Equal(t, []bool{true, false, true, false, true}, events, "loading a state should restore the rumble")
+}
@@ -0,0 +1,280 @@
+package cart
+
+// NewMBC6 returns a new MBC6 memory controller. The cartridge has 32KB of
+// RAM and 1MB of flash memory, which starts erased.
+func NewMBC6(data []byte) BankingController {
+	mbc := &MBC6{
+		rom:   data,
+		ram:   make([]byte, 0x8000),
+		flash: make([]byte, 0x100000),
+	}
+	for i := range mbc.flash {
+		mbc.flash[i] = 0xFF
+	}
+	mbc.romBank[0], mbc.romBank[1] = 2, 3
+	return mbc
+}
+
+// MBC6 is a GameBoy cartridge with two independently switched 8KB ROM areas
+// at 0x4000-0x5FFF and 0x6000-0x7FFF, which can each map either the ROM or
+// the flash memory, and two independently switched 4KB RAM areas at
+// 0xA000-0xAFFF and 0xB000-0xBFFF.
+type MBC6 struct {
+	dirtyTracker
+
+	rom   []byte
+	ram   []byte
+	flash []byte
+
+	// Registers for each of the two ROM and RAM areas.
+	romBank [2]int
+	isFlash [2]bool
+	ramBank [2]int
+
+	ramEnabled   bool
+	flashEnabled bool
+	flashWrite   bool
+	flashState   flashState
+}
+
+// State of the flash command state machine. Commands are sent by writing
+// 0xAA to 0x5555 and 0x55 to 0x2AAA in the flash address space, followed by
+// the command byte.
+type flashState int
+
+const (
+	flashIdle flashState = iota
+	flashUnlock1
+	flashUnlock2
+	flashProgram
+	flashEraseSetup
+	flashEraseUnlock1
+	flashEraseUnlock2
+	flashID
+)
+
+// Size of a sector of the flash memory which is erased by a sector erase.
+const flashSectorSize = 0x20000
+
+// Read returns a value at a memory address in the ROM, flash or RAM.
+func (r *MBC6) Read(address uint16) byte {
+	switch {
+	case address < 0x4000:
+		return r.rom[int(address)%len(r.rom)]
+	case address < 0x8000:
+		area := int(address-0x4000) / 0x2000
+		offset := r.romBank[area]*0x2000 + int(address&0x1FFF)
+		if !r.isFlash[area] {
+			return r.rom[offset%len(r.rom)]
+		}
+		if !r.flashEnabled {
+			return 0xFF
+		}
+		if r.flashState == flashID {
+			// Manufacturer and device ID
+			return [2]byte{0xC2, 0x81}[offset&0x1]
+		}
+		return r.flash[offset%len(r.flash)]
+	case !r.ramEnabled:
+		return 0xFF
+	default:
+		return r.ram[r.ramAddress(address)]
+	}
+}
+
+// Get the index into the RAM of an address in 0xA000-0xBFFF.
+func (r *MBC6) ramAddress(address uint16) int {
+	area := int(address-0xA000) / 0x1000
+	return (r.ramBank[area]*0x1000 + int(address&0xFFF)) % len(r.ram)
+}
+
+// ROMBank returns the 16KB ROM bank mapped to an address, which is based on
+// the 8KB bank of the area.
+func (r *MBC6) ROMBank(address uint16) int {
+	if address < 0x4000 {
+		return 0
+	}
+	return r.romBank[(address-0x4000)/0x2000] / 2
+}
+
+// WriteROM writes to one of the banking registers, or to the flash memory
+// if it is mapped and enabled.
+func (r *MBC6) WriteROM(address uint16, value byte) {
+	switch {
+	case address < 0x0400:
+		r.ramEnabled = value&0xF == 0xA
+	case address < 0x0800:
+		r.ramBank[0] = int(value & 0x7)
+	case address < 0x0C00:
+		r.ramBank[1] = int(value & 0x7)
+	case address < 0x1000:
+		r.flashEnabled = value&0x1 != 0
+	case address < 0x2000:
+		if address == 0x1000 {
+			r.flashWrite = value&0x1 != 0
+		}
+	case address < 0x2800:
+		r.romBank[0] = int(value & 0x7F)
+	case address < 0x3000:
+		r.isFlash[0] = value&0x08 != 0
+	case address < 0x3800:
+		r.romBank[1] = int(value & 0x7F)
+	case address < 0x4000:
+		r.isFlash[1] = value&0x08 != 0
+	default:
+		area := int(address-0x4000) / 0x2000
+		if r.isFlash[area] && r.flashEnabled {
+			r.writeFlash(r.romBank[area]*0x2000+int(address&0x1FFF), value)
+		}
+	}
+}
+
+// Run the flash command state machine for a write to an address in the flash.
+func (r *MBC6) writeFlash(address int, value byte) {
+	address %= len(r.flash)
+	if value == 0xF0 {
+		// Reset, which can be sent at any time
+		r.flashState = flashIdle
+		return
+	}
+	switch r.flashState {
+	case flashIdle, flashID:
+		if address&0xFFFF == 0x5555 && value == 0xAA {
+			r.flashState = flashUnlock1
+		}
+	case flashUnlock1:
+		r.flashState = flashIdle
+		if address&0xFFFF == 0x2AAA && value == 0x55 {
+			r.flashState = flashUnlock2
+		}
+	case flashUnlock2:
+		r.flashState = flashIdle
+		if address&0xFFFF != 0x5555 {
+			return
+		}
+		switch value {
+		case 0x80:
+			r.flashState = flashEraseSetup
+		case 0x90:
+			r.flashState = flashID
+		case 0xA0:
+			r.flashState = flashProgram
+		}
+	case flashProgram:
+		// Programming can only clear bits, which are set by an erase
+		r.flashState = flashIdle
+		if r.flashWrite {
+			r.flash[address] &= value
+			r.markDirty()
+		}
+	case flashEraseSetup:
+		r.flashState = flashIdle
+		if address&0xFFFF == 0x5555 && value == 0xAA {
+			r.flashState = flashEraseUnlock1
+		}
+	case flashEraseUnlock1:
+		r.flashState = flashIdle
+		if address&0xFFFF == 0x2AAA && value == 0x55 {
+			r.flashState = flashEraseUnlock2
+		}
+	case flashEraseUnlock2:
+		r.flashState = flashIdle
+		switch {
+		case !r.flashWrite:
+		case value == 0x10:
+			r.eraseFlash(0, len(r.flash))
+		case value == 0x30:
+			start := address &^ (flashSectorSize - 1)
+			r.eraseFlash(start, start+flashSectorSize)
+		}
+	}
+}
+
+// Erase a range of the flash memory.
+func (r *MBC6) eraseFlash(start, end int) {
+	for i := start; i < end; i++ {
+		r.flash[i] = 0xFF
+	}
+	r.markDirty()
+}
+
+// WriteRAM writes data to the ram if it is enabled.
+func (r *MBC6) WriteRAM(address uint16, value byte) {
+	if !r.ramEnabled {
+		return
+	}
+	r.ram[r.ramAddress(address)] = value
+	r.markDirty()
+}
+
+// GetSaveData returns the save data for this banking controller, which is
+// the RAM followed by the flash memory.
+func (r *MBC6) GetSaveData() []byte {
+	data := make([]byte, len(r.ram)+len(r.flash))
+	copy(data, r.ram)
+	copy(data[len(r.ram):], r.flash)
+	return data
+}
+
+// LoadSaveData loads the save data into the cartridge. The flash memory is
+// only loaded if it is present in the data.
+func (r *MBC6) LoadSaveData(data []byte) {
+	copy(r.ram, data)
+	if len(data) > len(r.ram) {
+		copy(r.flash, data[len(r.ram):])
+	}
+}
+
+// Snapshot of the internal state of a MBC6 cartridge.
+type mbc6State struct {
+	RAM          []byte
+	Flash        []byte
+	ROMBank      [2]int
+	IsFlash      [2]bool
+	RAMBank      [2]int
+	RAMEnabled   bool
+	FlashEnabled bool
+	FlashWrite   bool
+	FlashState   flashState
+}
+
+// MarshalState returns a snapshot of the banking registers, RAM and flash.
+func (r *MBC6) MarshalState() ([]byte, error) {
+	return encodeState(mbc6State{
+		RAM:          r.ram,
+		Flash:        r.flash,
+		ROMBank:      r.romBank,
+		IsFlash:      r.isFlash,
+		RAMBank:      r.ramBank,
+		RAMEnabled:   r.ramEnabled,
+		FlashEnabled: r.flashEnabled,
+		FlashWrite:   r.flashWrite,
+		FlashState:   r.flashState,
+	})
+}
+
+// UnmarshalState restores the banking registers, RAM and flash from a
+// snapshot.
+func (r *MBC6) UnmarshalState(data []byte) error {
+	var state mbc6State
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	if err := checkStateSize("RAM", state.RAM, r.ram); err != nil {
+		return err
+	}
+	if err := checkStateSize("flash", state.Flash, r.flash); err != nil {
+		return err
+	}
+	copy(r.ram, state.RAM)
+	copy(r.flash, state.Flash)
+	r.romBank = state.ROMBank
+	r.isFlash = state.IsFlash
+	r.ramBank = state.RAMBank
+	r.ramEnabled = state.RAMEnabled
+	r.flashEnabled = state.FlashEnabled
+	r.flashWrite = state.FlashWrite
+	r.flashState = state.FlashState
+	r.markDirty()
+	return nil
+}
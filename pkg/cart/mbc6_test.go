@@ -0,0 +1,73 @@
+package cart
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Send a command to the MBC6 flash through ROM area A.
+func flashCommand(mbc BankingController, command byte) {
+	mbc.WriteROM(0x2000, 0x02)
+	mbc.WriteROM(0x5555, 0xAA)
+	mbc.WriteROM(0x2000, 0x01)
+	mbc.WriteROM(0x4AAA, 0x55)
+	mbc.WriteROM(0x2000, 0x02)
+	mbc.WriteROM(0x5555, command)
+}
+
+func TestMBC6_ROMBanking(t *testing.T) {
+	mbc := NewMBC6(newBankedROM(8, 0x02, 0x00))
+	assert.Equal(t, byte(1), mbc.Read(0x4000), "8KB bank 2 should be mapped to area A")
+	assert.Equal(t, byte(0), mbc.Read(0x6000), "8KB bank 3 should be mapped to area B")
+
+	mbc.WriteROM(0x2000, 0x06)
+	mbc.WriteROM(0x3000, 0x0A)
+	assert.Equal(t, byte(3), mbc.Read(0x4000))
+	assert.Equal(t, byte(5), mbc.Read(0x6000))
+	assert.Equal(t, 5, mbc.(ROMBanker).ROMBank(0x6000))
+}
+
+func TestMBC6_RAMBanking(t *testing.T) {
+	mbc := NewMBC6(newBankedROM(8, 0x02, 0x00))
+	mbc.WriteROM(0x0000, 0x0A)
+	mbc.WriteROM(0x0400, 0x01)
+	mbc.WriteROM(0x0800, 0x05)
+	mbc.WriteRAM(0xA000, 0x12)
+	mbc.WriteRAM(0xB000, 0x34)
+
+	data := mbc.GetSaveData()
+	assert.Equal(t, byte(0x12), data[0x1000])
+	assert.Equal(t, byte(0x34), data[0x5000])
+	assert.Len(t, data, 0x8000+0x100000, "save data should contain the RAM and flash")
+}
+
+func TestMBC6_Flash(t *testing.T) {
+	mbc := NewMBC6(newBankedROM(8, 0x02, 0x00))
+	mbc.WriteROM(0x0C00, 0x01)
+	mbc.WriteROM(0x1000, 0x01)
+	mbc.WriteROM(0x2800, 0x08)
+	mbc.WriteROM(0x3000, 0x04)
+	mbc.WriteROM(0x3800, 0x08)
+	assert.Equal(t, byte(0xFF), mbc.Read(0x6000), "flash should start erased")
+
+	mbc.WriteROM(0x6000, 0x12)
+	assert.Equal(t, byte(0xFF), mbc.Read(0x6000), "writes without a command should be ignored")
+
+	flashCommand(mbc, 0xA0)
+	mbc.WriteROM(0x6000, 0x12)
+	assert.Equal(t, byte(0x12), mbc.Read(0x6000))
+	assert.True(t, mbc.IsDirty())
+
+	flashCommand(mbc, 0x90)
+	assert.Equal(t, byte(0xC2), mbc.Read(0x6000), "ID mode should read the manufacturer")
+	mbc.WriteROM(0x6000, 0xF0)
+	assert.Equal(t, byte(0x12), mbc.Read(0x6000))
+
+	flashCommand(mbc, 0x80)
+	flashCommand(mbc, 0x10)
+	assert.Equal(t, byte(0xFF), mbc.Read(0x6000), "chip erase should erase the flash")
+
+	mbc.WriteROM(0x0C00, 0x00)
+	assert.Equal(t, byte(0xFF), mbc.Read(0x4000))
+}
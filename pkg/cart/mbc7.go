@@ -0,0 +1,342 @@
+package cart
+
+import "math"
+
+// NewMBC7 returns a new MBC7 memory controller.
+func NewMBC7(data []byte) BankingController {
+	mbc := &MBC7{
+		rom:      data,
+		romBanks: romBankCount(data),
+		romBank:  1,
+	}
+	mbc.SetAcceleration(0, 0)
+	mbc.latchedX, mbc.latchedY = mbc.accelX, mbc.accelY
+	for i := range mbc.eeprom.Data {
+		mbc.eeprom.Data[i] = 0xFF
+	}
+	return mbc
+}
+
+// MBC7 is a GameBoy cartridge with rom banking, a two axis accelerometer and a
+// 93LC56 serial EEPROM in place of the RAM. The accelerometer and EEPROM are
+// mapped to registers in 0xA000-0xA0FF when both RAM enable registers are set.
+type MBC7 struct {
+	dirtyTracker
+
+	rom      []byte
+	romBanks int
+	romBank  int
+
+	ramEnabled1 bool
+	ramEnabled2 bool
+
+	// Current acceleration and the values which were last latched by the
+	// game. The latch is reset by writing 0x55 to 0xA00x, and then latched
+	// by writing 0xAA to 0xA01x.
+	accelX, accelY     uint16
+	latchedX, latchedY uint16
+	latchErased        bool
+
+	eeprom eeprom93LC56
+}
+
+// Accelerometer is implemented by banking controllers which have an
+// accelerometer that can be tilted.
+type Accelerometer interface {
+	// SetAcceleration sets the acceleration of the cartridge in each axis,
+	// in units of g. Positive x is tilting right and positive y is tilting
+	// towards the player.
+	SetAcceleration(x, y float64)
+}
+
+// Accelerometer value when the cartridge is level, and the change in value
+// for an acceleration of 1g.
+const (
+	accelCentre = 0x81D0
+	accelPerG   = 0x70
+)
+
+// SetAcceleration sets the acceleration of the cartridge in each axis, in
+// units of g.
+func (r *MBC7) SetAcceleration(x, y float64) {
+	r.accelX = accelValue(-x)
+	r.accelY = accelValue(y)
+}
+
+// Convert an acceleration in g to the value read from the accelerometer.
+func accelValue(g float64) uint16 {
+	value := math.Round(accelCentre + g*accelPerG)
+	return uint16(math.Max(0, math.Min(0xFFFF, value)))
+}
+
+// Read returns a value at a memory address in the ROM or the accelerometer
+// and EEPROM registers.
+func (r *MBC7) Read(address uint16) byte {
+	switch {
+	case address < 0x8000:
+		bank := r.ROMBank(address)
+		return r.rom[(bank*0x4000+int(address&0x3FFF))%len(r.rom)]
+	case !r.ramEnabled1 || !r.ramEnabled2 || address >= 0xB000:
+		return 0xFF
+	}
+	switch address & 0xF0 {
+	case 0x20:
+		return byte(r.latchedX)
+	case 0x30:
+		return byte(r.latchedX >> 8)
+	case 0x40:
+		return byte(r.latchedY)
+	case 0x50:
+		return byte(r.latchedY >> 8)
+	case 0x60:
+		return 0x00
+	case 0x80:
+		return r.eeprom.read()
+	}
+	return 0xFF
+}
+
+// ROMBank returns the ROM bank mapped to an address.
+func (r *MBC7) ROMBank(address uint16) int {
+	if address < 0x4000 {
+		return 0
+	}
+	return r.romBank & (r.romBanks - 1)
+}
+
+// WriteROM attempts to switch the ROM bank or enable the RAM registers.
+func (r *MBC7) WriteROM(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		r.ramEnabled1 = value&0xF == 0xA
+	case address < 0x4000:
+		r.romBank = int(value & 0x7F)
+	case address < 0x6000:
+		r.ramEnabled2 = value == 0x40
+	}
+}
+
+// WriteRAM writes to the accelerometer latch or the EEPROM.
+func (r *MBC7) WriteRAM(address uint16, value byte) {
+	if !r.ramEnabled1 || !r.ramEnabled2 || address >= 0xB000 {
+		return
+	}
+	switch address & 0xF0 {
+	case 0x00:
+		if value == 0x55 {
+			r.latchErased = true
+			r.latchedX, r.latchedY = 0x8000, 0x8000
+		}
+	case 0x10:
+		if value == 0xAA && r.latchErased {
+			r.latchErased = false
+			r.latchedX, r.latchedY = r.accelX, r.accelY
+		}
+	case 0x80:
+		if r.eeprom.write(value) {
+			r.markDirty()
+		}
+	}
+}
+
+// GetSaveData returns the contents of the EEPROM.
+func (r *MBC7) GetSaveData() []byte {
+	data := make([]byte, len(r.eeprom.Data))
+	copy(data, r.eeprom.Data[:])
+	return data
+}
+
+// LoadSaveData loads the contents of the EEPROM.
+func (r *MBC7) LoadSaveData(data []byte) {
+	copy(r.eeprom.Data[:], data)
+}
+
+// Snapshot of the internal state of a MBC7 cartridge.
+type mbc7State struct {
+	ROMBank     int
+	RAMEnabled1 bool
+	RAMEnabled2 bool
+	LatchedX    uint16
+	LatchedY    uint16
+	LatchErased bool
+	EEPROM      eeprom93LC56
+}
+
+// MarshalState returns a snapshot of the registers, accelerometer latch
+// and EEPROM.
+func (r *MBC7) MarshalState() ([]byte, error) {
+	return encodeState(mbc7State{
+		ROMBank:     r.romBank,
+		RAMEnabled1: r.ramEnabled1,
+		RAMEnabled2: r.ramEnabled2,
+		LatchedX:    r.latchedX,
+		LatchedY:    r.latchedY,
+		LatchErased: r.latchErased,
+		EEPROM:      r.eeprom,
+	})
+}
+
+// UnmarshalState restores the registers, accelerometer latch and EEPROM
+// from a snapshot.
+func (r *MBC7) UnmarshalState(data []byte) error {
+	var state mbc7State
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	r.romBank = state.ROMBank
+	r.ramEnabled1 = state.RAMEnabled1
+	r.ramEnabled2 = state.RAMEnabled2
+	r.latchedX = state.LatchedX
+	r.latchedY = state.LatchedY
+	r.latchErased = state.LatchErased
+	r.eeprom = state.EEPROM
+	r.markDirty()
+	return nil
+}
+
+// Bits of the EEPROM register at 0xA08x, where bit 0 reads the data out line.
+const (
+	eepromCS  = 0x80
+	eepromCLK = 0x40
+	eepromDI  = 0x02
+)
+
+// eeprom93LC56 is a 256 byte serial EEPROM organised as 128 16 bit words. It
+// is driven by toggling the chip select, clock and data in lines, and commands
+// are shifted in one bit on each rising edge of the clock: a start bit, a two
+// bit opcode and an 8 bit address, followed by 16 bits of data for writes.
+// Writes complete immediately, so the chip always reports that it is ready.
+type eeprom93LC56 struct {
+	Data [0x100]byte
+
+	CS, CLK, DO bool
+
+	// Bits which have been shifted in for the current command, and the
+	// number of bits.
+	Shift uint32
+	Bits  int
+
+	// Data being shifted out by a read, and the number of bits remaining.
+	Out     uint16
+	OutBits int
+
+	WriteEnabled bool
+}
+
+// Number of bits in the start bit, opcode and address of a command, and in a
+// command which is followed by a data word.
+const (
+	eepromHeaderBits = 11
+	eepromDataBits   = eepromHeaderBits + 16
+)
+
+// Read the EEPROM register, which has the current state of the lines.
+func (e *eeprom93LC56) read() byte {
+	return boolBit(e.CS, 7) | boolBit(e.CLK, 6) | boolBit(e.DO, 0)
+}
+
+// Write to the EEPROM register. Returns true if the contents of the EEPROM
+// were changed.
+func (e *eeprom93LC56) write(value byte) bool {
+	cs := value&eepromCS != 0
+	clk := value&eepromCLK != 0
+	di := value&eepromDI != 0
+
+	changed := false
+	if !cs {
+		// Deselecting the chip cancels the command
+		e.Shift, e.Bits, e.OutBits = 0, 0, 0
+		e.DO = true
+	} else if clk && !e.CLK {
+		changed = e.clock(di)
+	}
+	e.CS, e.CLK = cs, clk
+	return changed
+}
+
+// Shift a bit in on a rising edge of the clock. Returns true if the contents
+// of the EEPROM were changed.
+func (e *eeprom93LC56) clock(di bool) bool {
+	if e.OutBits > 0 {
+		// Shift out the next bit of a read
+		e.OutBits--
+		e.DO = e.Out&(1<<uint(e.OutBits)) != 0
+		return false
+	}
+	if e.Bits == 0 && !di {
+		// Wait for the start bit
+		return false
+	}
+	e.Shift = e.Shift<<1 | uint32(boolBit(di, 0))
+	e.Bits++
+	if e.Bits < eepromHeaderBits {
+		return false
+	}
+
+	header := e.Shift >> uint(e.Bits-eepromHeaderBits)
+	address := int(header&0x7F) * 2
+	switch header >> 8 & 0x3 {
+	case 0x0:
+		// Commands which are selected by the top bits of the address
+		return e.special(header >> 6 & 0x3)
+	case 0x1:
+		// WRITE
+		if e.Bits < eepromDataBits {
+			return false
+		}
+		data := uint16(e.Shift)
+		e.Shift, e.Bits = 0, 0
+		return e.program(address, address+2, data)
+	case 0x2:
+		// READ, which shifts out a dummy zero bit followed by the word
+		e.Out = uint16(e.Data[address]) | uint16(e.Data[address+1])<<8
+		e.OutBits = 16
+		e.DO = false
+	case 0x3:
+		// ERASE
+		e.Shift, e.Bits = 0, 0
+		return e.program(address, address+2, 0xFFFF)
+	}
+	e.Shift, e.Bits = 0, 0
+	return false
+}
+
+// Run one of the commands with the opcode 0. Returns true if the contents of
+// the EEPROM were changed.
+func (e *eeprom93LC56) special(command uint32) bool {
+	switch command {
+	case 0x0:
+		// EWDS
+		e.WriteEnabled = false
+	case 0x1:
+		// WRAL
+		if e.Bits < eepromDataBits {
+			return false
+		}
+		data := uint16(e.Shift)
+		e.Shift, e.Bits = 0, 0
+		return e.program(0, len(e.Data), data)
+	case 0x2:
+		// ERAL
+		e.Shift, e.Bits = 0, 0
+		return e.program(0, len(e.Data), 0xFFFF)
+	case 0x3:
+		// EWEN
+		e.WriteEnabled = true
+	}
+	e.Shift, e.Bits = 0, 0
+	return false
+}
+
+// Write a word to a range of the EEPROM if writes are enabled. Returns true
+// if the contents were changed.
+func (e *eeprom93LC56) program(start, end int, value uint16) bool {
+	if !e.WriteEnabled {
+		return false
+	}
+	for i := start; i < end; i += 2 {
+		e.Data[i] = byte(value)
+		e.Data[i+1] = byte(value >> 8)
+	}
+	return true
+}
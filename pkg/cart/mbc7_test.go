@@ -0,0 +1,134 @@
+package cart
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Create a MBC7 cartridge with the RAM registers enabled.
+func newEnabledMBC7() *MBC7 {
+	data := newBankedROM(8, 0x02, 0x00)
+	data[0x147] = 0x22
+	mbc := NewMBC7(data).(*MBC7)
+	mbc.WriteROM(0x0000, 0x0A)
+	mbc.WriteROM(0x4000, 0x40)
+	return mbc
+}
+
+// Clock a sequence of bits into the EEPROM and return the bits which were
+// read back on each clock.
+func clockEEPROM(mbc *MBC7, bits ...byte) []byte {
+	var out []byte
+	for _, bit := range bits {
+		mbc.WriteRAM(0xA080, eepromCS|bit<<1)
+		mbc.WriteRAM(0xA080, eepromCS|eepromCLK|bit<<1)
+		out = append(out, mbc.Read(0xA080)&0x1)
+	}
+	return out
+}
+
+// Get the bits of a value, most significant first.
+func bits(value uint32, count int) []byte {
+	out := make([]byte, count)
+	for i := range out {
+		out[i] = byte(value>>uint(count-1-i)) & 0x1
+	}
+	return out
+}
+
+// Send a command to the EEPROM, followed by deselecting the chip.
+func eepromCommand(mbc *MBC7, command uint32, count int) []byte {
+	out := clockEEPROM(mbc, bits(command, count)...)
+	mbc.WriteRAM(0xA080, 0x00)
+	return out
+}
+
+func TestMBC7_ROMBanking(t *testing.T) {
+	mbc := newEnabledMBC7()
+	assert.Equal(t, byte(1), mbc.Read(0x4000))
+	mbc.WriteROM(0x2000, 0x05)
+	assert.Equal(t, byte(5), mbc.Read(0x4000))
+	assert.Equal(t, byte(0), mbc.Read(0x0000))
+}
+
+func TestMBC7_RAMEnable(t *testing.T) {
+	mbc := newEnabledMBC7()
+	assert.Equal(t, byte(0x00), mbc.Read(0xA060))
+
+	mbc.WriteROM(0x4000, 0x00)
+	assert.Equal(t, byte(0xFF), mbc.Read(0xA060), "both enable registers should be needed")
+	mbc.WriteROM(0x4000, 0x40)
+	mbc.WriteROM(0x0000, 0x00)
+	assert.Equal(t, byte(0xFF), mbc.Read(0xA060), "both enable registers should be needed")
+}
+
+func TestMBC7_Accelerometer(t *testing.T) {
+	mbc := newEnabledMBC7()
+	readAxes := func() (uint16, uint16) {
+		x := uint16(mbc.Read(0xA030))<<8 | uint16(mbc.Read(0xA020))
+		y := uint16(mbc.Read(0xA050))<<8 | uint16(mbc.Read(0xA040))
+		return x, y
+	}
+
+	cart := &Cart{BankingController: mbc}
+	assert.True(t, cart.SetAcceleration(0.5, -1))
+	x, y := readAxes()
+	assert.Equal(t, uint16(0x81D0), x, "values should not change until latched")
+	assert.Equal(t, uint16(0x81D0), y)
+
+	mbc.WriteRAM(0xA000, 0x55)
+	x, y = readAxes()
+	assert.Equal(t, uint16(0x8000), x, "erasing the latch should reset the values")
+	assert.Equal(t, uint16(0x8000), y)
+
+	mbc.WriteRAM(0xA010, 0xAA)
+	x, y = readAxes()
+	assert.Equal(t, uint16(0x81D0-0x38), x)
+	assert.Equal(t, uint16(0x81D0-0x70), y)
+
+	mbc.SetAcceleration(0, 0)
+	mbc.WriteRAM(0xA010, 0xAA)
+	x, _ = readAxes()
+	assert.Equal(t, uint16(0x81D0-0x38), x, "latch should need to be erased first")
+}
+
+func TestMBC7_EEPROM(t *testing.T) {
+	mbc := newEnabledMBC7()
+
+	// WRITE is ignored until EWEN
+	eepromCommand(mbc, 0x5<<24|0x03<<16|0x1234, 27)
+	assert.Equal(t, byte(0xFF), mbc.GetSaveData()[6])
+	assert.False(t, mbc.IsDirty())
+
+	eepromCommand(mbc, 0x4C0, 11)
+	eepromCommand(mbc, 0x5<<24|0x03<<16|0x1234, 27)
+	data := mbc.GetSaveData()
+	assert.Equal(t, byte(0x34), data[6])
+	assert.Equal(t, byte(0x12), data[7])
+	assert.True(t, mbc.IsDirty())
+
+	// READ shifts out a dummy zero followed by the word
+	out := eepromCommand(mbc, 0x603<<16, 28)
+	assert.Equal(t, append([]byte{0}, bits(0x1234, 16)...), out[11:])
+
+	// ERASE
+	eepromCommand(mbc, 0x703, 11)
+	assert.Equal(t, byte(0xFF), mbc.GetSaveData()[6])
+
+	// WRAL and EWDS
+	eepromCommand(mbc, 0x440<<16|0xABCD, 27)
+	eepromCommand(mbc, 0x400, 11)
+	eepromCommand(mbc, 0x480, 11)
+	data = mbc.GetSaveData()
+	assert.Equal(t, byte(0xCD), data[0])
+	assert.Equal(t, byte(0xAB), data[0xFF], "ERAL should be ignored after EWDS")
+}
+
+func TestMBC7_LoadSaveData(t *testing.T) {
+	mbc := newEnabledMBC7()
+	data := make([]byte, 0x100)
+	data[0x10] = 0x42
+	mbc.LoadSaveData(data)
+	assert.Equal(t, data, mbc.GetSaveData())
+}
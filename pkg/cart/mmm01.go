@@ -0,0 +1,218 @@
+package cart
+
+// NewMMM01 returns a new MMM01 memory controller. The size of the RAM is read
+// from the header of the menu, which is usually in the last 32KB of the ROM.
+func NewMMM01(data []byte) BankingController {
+	header := data
+	if isMMM01(data) {
+		header = data[len(data)-0x8000:]
+	}
+	return &MMM01{
+		rom:      data,
+		romBanks: romBanksForLength(len(data)),
+		ram:      make([]byte, ramSize(header)),
+	}
+}
+
+// Check if a ROM has a MMM01 cartridge header in the last 32KB, which is
+// where the menu is mapped at power on. The header at the start of these ROMs
+// is the header of the first game.
+func isMMM01(data []byte) bool {
+	offset := len(data) - 0x8000
+	if offset < 0 {
+		return false
+	}
+	mbcFlag := data[offset+0x147]
+	return mbcFlag >= 0x0B && mbcFlag <= 0x0D
+}
+
+// MMM01 is a multicart controller which is used by a few collections of games.
+// It starts up unmapped with the last 32KB of the ROM visible, so that the
+// menu can select a game. The menu then writes the outer bank bits and the
+// masks which select how many of the bank bits the game can change, and maps
+// the game by setting bit 6 of 0x0000-0x1FFF. Once mapped, the outer bank bits
+// are locked and the controller behaves like a MBC1.
+type MMM01 struct {
+	dirtyTracker
+
+	rom      []byte
+	romBanks int
+	ram      []byte
+
+	mapped     bool
+	ramEnabled bool
+	mode       bool
+
+	// Bank number registers, which are combined as romHigh:romMid:romLow
+	// for the ROM bank and ramHigh:ramLow for the RAM bank.
+	romLow  byte
+	romMid  byte
+	romHigh byte
+	ramLow  byte
+	ramHigh byte
+
+	// Bits of romLow and ramLow which are fixed after mapping, and if the
+	// mode register is locked.
+	romMask    byte
+	ramMask    byte
+	modeLocked bool
+}
+
+// Read returns a value at a memory address in the ROM or RAM.
+func (r *MMM01) Read(address uint16) byte {
+	switch {
+	case address < 0x8000:
+		bank := r.ROMBank(address)
+		return r.rom[(bank*0x4000+int(address&0x3FFF))%len(r.rom)]
+	case !r.ramEnabled || len(r.ram) == 0:
+		return 0xFF
+	default:
+		return r.ram[r.ramAddress(address)]
+	}
+}
+
+// Get the index into the RAM of an address in 0xA000-0xBFFF.
+func (r *MMM01) ramAddress(address uint16) int {
+	bank := int(r.ramHigh) << 2
+	if r.mode {
+		bank |= int(r.ramLow)
+	}
+	return (bank*0x2000 + int(address-0xA000)) % len(r.ram)
+}
+
+// ROMBank returns the ROM bank mapped to an address.
+func (r *MMM01) ROMBank(address uint16) int {
+	if !r.mapped {
+		// The last 32KB is mapped until a game is selected
+		if address < 0x4000 {
+			return (r.romBanks - 2) & (r.romBanks - 1)
+		}
+		return r.romBanks - 1
+	}
+	outer := int(r.romHigh)<<7 | int(r.romMid)<<5
+	if address < 0x4000 {
+		return (outer | int(r.romLow&r.romMask)) & (r.romBanks - 1)
+	}
+	low := r.romLow
+	if low&^r.romMask == 0 {
+		// Bank 0 is replaced with bank 1 based only on the unmasked bits
+		low |= 1
+	}
+	return (outer | int(low)) & (r.romBanks - 1)
+}
+
+// WriteROM writes to one of the banking registers. The outer bank bits and
+// the masks can only be written before the game is mapped.
+func (r *MMM01) WriteROM(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		r.ramEnabled = value&0xF == 0xA
+		if !r.mapped {
+			r.ramMask = value >> 4 & 0x3
+			r.mapped = value&0x40 != 0
+		}
+	case address < 0x4000:
+		if r.mapped {
+			r.romLow = r.romLow&r.romMask | value&0x1F&^r.romMask
+		} else {
+			r.romLow = value & 0x1F
+			r.romMid = value >> 5 & 0x3
+		}
+	case address < 0x6000:
+		if r.mapped {
+			r.ramLow = r.ramLow&r.ramMask | value&0x3&^r.ramMask
+		} else {
+			r.ramLow = value & 0x3
+			r.ramHigh = value >> 2 & 0x3
+			r.romHigh = value >> 4 & 0x3
+			r.modeLocked = value&0x40 != 0
+		}
+	default:
+		if !r.modeLocked {
+			r.mode = value&0x1 != 0
+		}
+		if !r.mapped {
+			r.romMask = value & 0x3C >> 1
+		}
+	}
+}
+
+// WriteRAM writes data to the ram if it is enabled.
+func (r *MMM01) WriteRAM(address uint16, value byte) {
+	if !r.ramEnabled || len(r.ram) == 0 {
+		return
+	}
+	r.ram[r.ramAddress(address)] = value
+	r.markDirty()
+}
+
+// GetSaveData returns the save data for this banking controller.
+func (r *MMM01) GetSaveData() []byte {
+	data := make([]byte, len(r.ram))
+	copy(data, r.ram)
+	return data
+}
+
+// LoadSaveData loads the save data into the cartridge.
+func (r *MMM01) LoadSaveData(data []byte) {
+	copy(r.ram, data)
+}
+
+// Snapshot of the internal state of a MMM01 cartridge.
+type mmm01State struct {
+	RAM        []byte
+	Mapped     bool
+	RAMEnabled bool
+	Mode       bool
+	ROMLow     byte
+	ROMMid     byte
+	ROMHigh    byte
+	RAMLow     byte
+	RAMHigh    byte
+	ROMMask    byte
+	RAMMask    byte
+	ModeLocked bool
+}
+
+// MarshalState returns a snapshot of the banking registers and RAM.
+func (r *MMM01) MarshalState() ([]byte, error) {
+	return encodeState(mmm01State{
+		RAM:        r.ram,
+		Mapped:     r.mapped,
+		RAMEnabled: r.ramEnabled,
+		Mode:       r.mode,
+		ROMLow:     r.romLow,
+		ROMMid:     r.romMid,
+		ROMHigh:    r.romHigh,
+		RAMLow:     r.ramLow,
+		RAMHigh:    r.ramHigh,
+		ROMMask:    r.romMask,
+		RAMMask:    r.ramMask,
+		ModeLocked: r.modeLocked,
+	})
+}
+
+// UnmarshalState restores the banking registers and RAM from a snapshot.
+func (r *MMM01) UnmarshalState(data []byte) error {
+	var state mmm01State
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	if err := checkStateSize("RAM", state.RAM, r.ram); err != nil {
+		return err
+	}
+	copy(r.ram, state.RAM)
+	r.mapped = state.Mapped
+	r.ramEnabled = state.RAMEnabled
+	r.mode = state.Mode
+	r.romLow = state.ROMLow
+	r.romMid = state.ROMMid
+	r.romHigh = state.ROMHigh
+	r.ramLow = state.RAMLow
+	r.ramHigh = state.RAMHigh
+	r.romMask = state.ROMMask
+	r.ramMask = state.RAMMask
+	r.modeLocked = state.ModeLocked
+	r.markDirty()
+	return nil
+}
@@ -0,0 +1,62 @@
+package cart
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Create a 512KB MMM01 ROM with the menu header in the last 32KB.
+func newMMM01ROM() []byte {
+	data := newBankedROM(32, 0x00, 0x00)
+	data[0x147] = 0x01
+	data[len(data)-0x8000+0x147] = 0x0D
+	data[len(data)-0x8000+0x149] = 0x03
+	return data
+}
+
+func TestMMM01_Unmapped(t *testing.T) {
+	rom := newMMM01ROM()
+	assert.True(t, isMMM01(rom))
+	mbc := NewMMM01(rom)
+	assert.Equal(t, byte(30), mbc.Read(0x0000), "second to last bank should be mapped at 0x0000")
+	assert.Equal(t, byte(31), mbc.Read(0x4000), "last bank should be mapped at 0x4000")
+
+	mbc.WriteROM(0x2000, 0x03)
+	assert.Equal(t, byte(31), mbc.Read(0x4000), "bank should not change until mapped")
+}
+
+func TestMMM01_MapGame(t *testing.T) {
+	mbc := NewMMM01(newMMM01ROM())
+
+	// Select a 4 bank game starting at bank 0x10, where the upper 3 bits
+	// of the low bank register are fixed by the mask
+	mbc.WriteROM(0x2000, 0x10)
+	mbc.WriteROM(0x6000, 0x38)
+	mbc.WriteROM(0x0000, 0x40)
+	assert.Equal(t, byte(0x10), mbc.Read(0x0000))
+	assert.Equal(t, byte(0x11), mbc.Read(0x4000), "unmasked bank 0 should map bank 1")
+
+	mbc.WriteROM(0x2000, 0x03)
+	assert.Equal(t, byte(0x13), mbc.Read(0x4000))
+	mbc.WriteROM(0x2000, 0x1E)
+	assert.Equal(t, byte(0x12), mbc.Read(0x4000), "masked bits should be locked")
+
+	mbc.WriteROM(0x6000, 0x00)
+	mbc.WriteROM(0x2000, 0x01)
+	assert.Equal(t, byte(0x11), mbc.Read(0x4000), "mask should be locked")
+}
+
+func TestMMM01_RAM(t *testing.T) {
+	mbc := NewMMM01(newMMM01ROM())
+	assert.Len(t, mbc.GetSaveData(), 0x8000, "RAM size should be read from the menu header")
+
+	mbc.WriteRAM(0xA000, 0x12)
+	assert.Equal(t, byte(0xFF), mbc.Read(0xA000), "RAM should read 0xFF while disabled")
+
+	mbc.WriteROM(0x4000, 0x02)
+	mbc.WriteROM(0x6000, 0x01)
+	mbc.WriteROM(0x0000, 0x4A)
+	mbc.WriteRAM(0xA000, 0x34)
+	assert.Equal(t, byte(0x34), mbc.GetSaveData()[0x4000])
+}
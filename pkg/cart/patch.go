@@ -0,0 +1,339 @@
+package cart
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Errors returned when applying a patch to a ROM.
+var (
+	ErrUnknownPatch  = errors.New("unknown patch format")
+	ErrInvalidPatch  = errors.New("invalid patch")
+	ErrPatchChecksum = errors.New("patch checksum does not match")
+)
+
+// Magic bytes at the start of each of the supported patch formats.
+const (
+	ipsMagic = "PATCH"
+	upsMagic = "UPS1"
+	bpsMagic = "BPS1"
+)
+
+// Extensions of the patch files which are applied automatically when they
+// are next to a ROM, in the order that they are looked for.
+var patchExtensions = []string{".bps", ".ups", ".ips"}
+
+// ApplyPatch applies an IPS, UPS or BPS patch to a ROM and returns the
+// patched ROM. The format is detected from the start of the patch, and the
+// original ROM is not modified. The checksums in UPS and BPS patches are
+// verified, so a patch for a different ROM returns ErrPatchChecksum.
+func ApplyPatch(rom, patch []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(patch, []byte(ipsMagic)):
+		return applyIPS(rom, patch)
+	case bytes.HasPrefix(patch, []byte(upsMagic)):
+		return applyUPS(rom, patch)
+	case bytes.HasPrefix(patch, []byte(bpsMagic)):
+		return applyBPS(rom, patch)
+	}
+	return nil, ErrUnknownPatch
+}
+
+// ApplyPatchFile reads a patch file and applies it to a ROM.
+func ApplyPatchFile(rom []byte, filename string) ([]byte, error) {
+	patch, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := ApplyPatch(rom, patch)
+	if err != nil {
+		return nil, fmt.Errorf("applying %s: %w", filename, err)
+	}
+	return patched, nil
+}
+
+// FindPatchFile returns the patch file next to a ROM file, which has the same
+// name as the ROM with a .bps, .ups or .ips extension. An empty string is
+// returned if there is no patch file.
+func FindPatchFile(filename string) string {
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	for _, ext := range patchExtensions {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext
+		}
+	}
+	return ""
+}
+
+// Reader for the contents of a patch, which records an error instead of
+// panicking if the patch ends early.
+type patchReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// Read a single byte.
+func (r *patchReader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.err = fmt.Errorf("%w: unexpected end of patch", ErrInvalidPatch)
+		return 0
+	}
+	value := r.data[r.pos]
+	r.pos++
+	return value
+}
+
+// Read a number of bytes.
+func (r *patchReader) bytes(n int) []byte {
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = fmt.Errorf("%w: unexpected end of patch", ErrInvalidPatch)
+		r.pos = len(r.data)
+		return nil
+	}
+	value := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return value
+}
+
+// Read a big endian number of a number of bytes, as used by IPS.
+func (r *patchReader) bigEndian(n int) int {
+	value := 0
+	for _, b := range r.bytes(n) {
+		value = value<<8 | int(b)
+	}
+	return value
+}
+
+// Read a variable length number, as used by UPS and BPS. Each byte holds 7
+// bits of the number with the high bit set on the last byte, and one is
+// added for each following byte so that every number has one encoding.
+func (r *patchReader) varint() int {
+	value, shift := 0, 1
+	for r.err == nil {
+		b := r.byte()
+		value += int(b&0x7F) * shift
+		if b&0x80 != 0 {
+			break
+		}
+		shift <<= 7
+		value += shift
+		if shift > 1<<49 {
+			r.err = fmt.Errorf("%w: number is too large", ErrInvalidPatch)
+		}
+	}
+	return value
+}
+
+// Read a signed variable length number, where the lowest bit is the sign.
+func (r *patchReader) signedVarint() int {
+	value := r.varint()
+	if value&1 != 0 {
+		return -(value >> 1)
+	}
+	return value >> 1
+}
+
+// Apply an IPS patch. The patch is a list of records which each write some
+// data or a run of a single byte to an offset, and the ROM is extended if a
+// record is beyond its end. An optional size after the EOF marker truncates
+// the ROM.
+func applyIPS(rom, patch []byte) ([]byte, error) {
+	out := append([]byte{}, rom...)
+	r := &patchReader{data: patch, pos: len(ipsMagic)}
+	for {
+		if bytes.HasPrefix(r.data[r.pos:], []byte("EOF")) {
+			r.pos += 3
+			break
+		}
+		offset := r.bigEndian(3)
+		size := r.bigEndian(2)
+		var data []byte
+		if size == 0 {
+			size = r.bigEndian(2)
+			data = bytes.Repeat([]byte{r.byte()}, size)
+		} else {
+			data = r.bytes(size)
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		if end := offset + size; end > len(out) {
+			out = append(out, make([]byte, end-len(out))...)
+		}
+		copy(out[offset:], data)
+	}
+	if len(r.data)-r.pos >= 3 {
+		if size := r.bigEndian(3); size < len(out) {
+			out = out[:size]
+		}
+	}
+	return out, nil
+}
+
+// Size of the checksums at the end of UPS and BPS patches.
+const patchFooterSize = 12
+
+// Largest ROM which a UPS or BPS patch can create, which is the largest size
+// in a cartridge header.
+const maxPatchedSize = 0x800000
+
+// Checksums of the source ROM, target ROM and the patch at the end of a UPS
+// or BPS patch.
+type patchFooter struct {
+	source, target, patch uint32
+}
+
+// Read the footer of a UPS or BPS patch and check the checksum of the patch
+// itself and of the ROM it is being applied to.
+func readPatchFooter(rom, patch []byte) (patchFooter, error) {
+	if len(patch) < len(upsMagic)+patchFooterSize {
+		return patchFooter{}, fmt.Errorf("%w: patch is too small", ErrInvalidPatch)
+	}
+	footer := patch[len(patch)-patchFooterSize:]
+	checksums := patchFooter{
+		source: binary.LittleEndian.Uint32(footer[0:]),
+		target: binary.LittleEndian.Uint32(footer[4:]),
+		patch:  binary.LittleEndian.Uint32(footer[8:]),
+	}
+	if crc32.ChecksumIEEE(patch[:len(patch)-4]) != checksums.patch {
+		return checksums, fmt.Errorf("%w: patch is corrupted", ErrPatchChecksum)
+	}
+	if crc32.ChecksumIEEE(rom) != checksums.source {
+		return checksums, fmt.Errorf("%w: patch is for a different rom", ErrPatchChecksum)
+	}
+	return checksums, nil
+}
+
+// Check the checksum of a patched ROM.
+func checkPatchTarget(out []byte, checksums patchFooter) ([]byte, error) {
+	if crc32.ChecksumIEEE(out) != checksums.target {
+		return nil, fmt.Errorf("%w: patched rom is incorrect", ErrPatchChecksum)
+	}
+	return out, nil
+}
+
+// Apply a UPS patch. The patch is a list of hunks which each skip a number of
+// bytes and then XOR the ROM with the data up to a zero byte.
+func applyUPS(rom, patch []byte) ([]byte, error) {
+	checksums, err := readPatchFooter(rom, patch)
+	if err != nil {
+		return nil, err
+	}
+	r := &patchReader{data: patch[:len(patch)-patchFooterSize], pos: len(upsMagic)}
+	sourceSize := r.varint()
+	targetSize := r.varint()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if sourceSize != len(rom) {
+		return nil, fmt.Errorf("%w: patch is for a rom of %v bytes", ErrInvalidPatch, sourceSize)
+	}
+	if targetSize > maxPatchedSize {
+		return nil, fmt.Errorf("%w: patched rom is too large (%v bytes)", ErrInvalidPatch, targetSize)
+	}
+
+	out := make([]byte, targetSize)
+	copy(out, rom)
+	offset := 0
+	for r.pos < len(r.data) && r.err == nil {
+		offset += r.varint()
+		for r.err == nil {
+			value := r.byte()
+			if value == 0 {
+				offset++
+				break
+			}
+			if offset >= len(out) {
+				return nil, fmt.Errorf("%w: hunk is beyond the end of the rom", ErrInvalidPatch)
+			}
+			out[offset] ^= value
+			offset++
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return checkPatchTarget(out, checksums)
+}
+
+// Actions in a BPS patch, which each write a number of bytes to the output.
+const (
+	bpsSourceRead = iota
+	bpsTargetRead
+	bpsSourceCopy
+	bpsTargetCopy
+)
+
+// Apply a BPS patch. The patch is a list of actions which build the output
+// by copying from the ROM at the same offset, from the patch, or from a
+// relative offset in the ROM or in the output written so far.
+func applyBPS(rom, patch []byte) ([]byte, error) {
+	checksums, err := readPatchFooter(rom, patch)
+	if err != nil {
+		return nil, err
+	}
+	r := &patchReader{data: patch[:len(patch)-patchFooterSize], pos: len(bpsMagic)}
+	sourceSize := r.varint()
+	targetSize := r.varint()
+	r.bytes(r.varint()) // Metadata
+	if r.err != nil {
+		return nil, r.err
+	}
+	if sourceSize != len(rom) {
+		return nil, fmt.Errorf("%w: patch is for a rom of %v bytes", ErrInvalidPatch, sourceSize)
+	}
+	if targetSize > maxPatchedSize {
+		return nil, fmt.Errorf("%w: patched rom is too large (%v bytes)", ErrInvalidPatch, targetSize)
+	}
+
+	out := make([]byte, 0, targetSize)
+	sourceOffset, targetOffset := 0, 0
+	for r.pos < len(r.data) && r.err == nil {
+		data := r.varint()
+		length := data>>2 + 1
+		if len(out)+length > targetSize {
+			return nil, fmt.Errorf("%w: action is beyond the end of the rom", ErrInvalidPatch)
+		}
+		switch data & 0x3 {
+		case bpsSourceRead:
+			if len(out)+length > len(rom) {
+				return nil, fmt.Errorf("%w: read is beyond the end of the source", ErrInvalidPatch)
+			}
+			out = append(out, rom[len(out):len(out)+length]...)
+		case bpsTargetRead:
+			out = append(out, r.bytes(length)...)
+		case bpsSourceCopy:
+			sourceOffset += r.signedVarint()
+			if sourceOffset < 0 || sourceOffset+length > len(rom) {
+				return nil, fmt.Errorf("%w: copy is beyond the end of the source", ErrInvalidPatch)
+			}
+			out = append(out, rom[sourceOffset:sourceOffset+length]...)
+			sourceOffset += length
+		case bpsTargetCopy:
+			targetOffset += r.signedVarint()
+			if targetOffset < 0 || targetOffset >= len(out) {
+				return nil, fmt.Errorf("%w: copy is beyond the end of the target", ErrInvalidPatch)
+			}
+			// The copy can overlap the bytes it is writing, so that a run
+			// of bytes can be repeated
+			for i := 0; i < length; i++ {
+				out = append(out, out[targetOffset])
+				targetOffset++
+			}
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(out) != targetSize {
+		return nil, fmt.Errorf("%w: patched rom is %v bytes instead of %v", ErrInvalidPatch, len(out), targetSize)
+	}
+	return checkPatchTarget(out, checksums)
+}
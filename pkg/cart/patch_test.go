@@ -0,0 +1,165 @@
+package cart
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Encode a variable length number as used by UPS and BPS patches.
+func encodeVarint(value int) []byte {
+	var out []byte
+	for {
+		b := byte(value & 0x7F)
+		value >>= 7
+		if value == 0 {
+			return append(out, b|0x80)
+		}
+		out = append(out, b)
+		value--
+	}
+}
+
+// Add the checksums to the end of a UPS or BPS patch.
+func appendPatchFooter(patch, source, target []byte) []byte {
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(source))
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(target))
+	return binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(patch))
+}
+
+func TestPatchReader_Varint(t *testing.T) {
+	for _, value := range []int{0, 1, 0x7F, 0x80, 0x3FFF, 0x4000, 0x123456} {
+		r := &patchReader{data: encodeVarint(value)}
+		assert.Equal(t, value, r.varint())
+		assert.NoError(t, r.err)
+		assert.Equal(t, len(r.data), r.pos)
+	}
+
+	r := &patchReader{data: []byte{0x01}}
+	r.varint()
+	assert.ErrorIs(t, r.err, ErrInvalidPatch)
+}
+
+func TestApplyPatch_IPS(t *testing.T) {
+	rom := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	patch := appendBytes(
+		[]byte("PATCH"),
+		[]byte{0x00, 0x00, 0x02, 0x00, 0x02, 0xAA, 0xBB},       // Write AA BB to 2
+		[]byte{0x00, 0x00, 0x06, 0x00, 0x00, 0x00, 0x04, 0xCC}, // Write 4 CCs to 6
+		[]byte("EOF"),
+	)
+	out, err := ApplyPatch(rom, patch)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 0xAA, 0xBB, 4, 5, 0xCC, 0xCC, 0xCC, 0xCC}, out)
+	assert.Equal(t, []byte{0, 1, 2, 3, 4, 5, 6, 7}, rom, "rom should not be modified")
+
+	// Truncate the rom after the EOF marker
+	out, err = ApplyPatch(rom, appendBytes([]byte("PATCH"), []byte("EOF"), []byte{0x00, 0x00, 0x04}))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 2, 3}, out)
+
+	_, err = ApplyPatch(rom, []byte("PATCH\x00\x00\x02\x00\x05\xAA"))
+	assert.ErrorIs(t, err, ErrInvalidPatch)
+}
+
+func TestApplyPatch_UPS(t *testing.T) {
+	rom := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	target := []byte{0, 1, 0xAA, 3, 4, 5, 6, 7, 0, 0x11}
+	patch := appendBytes(
+		[]byte("UPS1"),
+		encodeVarint(len(rom)),
+		encodeVarint(len(target)),
+		encodeVarint(2), []byte{2 ^ 0xAA, 0x00}, // Skip 2 and XOR one byte
+		encodeVarint(5), []byte{0x11, 0x00}, // Skip 5 and XOR past the end
+	)
+	patch = appendPatchFooter(patch, rom, target)
+
+	out, err := ApplyPatch(rom, patch)
+	require.NoError(t, err)
+	assert.Equal(t, target, out)
+
+	_, err = ApplyPatch([]byte{9, 1, 2, 3, 4, 5, 6, 7}, patch)
+	assert.ErrorIs(t, err, ErrPatchChecksum, "source checksum should be checked")
+
+	patch[6] ^= 0xFF
+	_, err = ApplyPatch(rom, patch)
+	assert.ErrorIs(t, err, ErrPatchChecksum, "patch checksum should be checked")
+}
+
+func TestApplyPatch_BPS(t *testing.T) {
+	rom := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	target := []byte{0, 1, 2, 0xAA, 0xBB, 0xBB, 0xBB, 0xBB, 6, 7, 4, 5}
+	action := func(command, length int) []byte {
+		return encodeVarint((length-1)<<2 | command)
+	}
+	patch := appendBytes(
+		[]byte("BPS1"),
+		encodeVarint(len(rom)),
+		encodeVarint(len(target)),
+		encodeVarint(4), []byte("meta"),
+		action(bpsSourceRead, 3),
+		action(bpsTargetRead, 2), []byte{0xAA, 0xBB},
+		action(bpsTargetCopy, 3), encodeVarint(4<<1), // Repeat the BB
+		action(bpsSourceCopy, 2), encodeVarint(6<<1),
+		action(bpsSourceCopy, 2), encodeVarint(4<<1|1), // Back from 8 to 4
+	)
+	patch = appendPatchFooter(patch, rom, target)
+
+	out, err := ApplyPatch(rom, patch)
+	require.NoError(t, err)
+	assert.Equal(t, target, out)
+
+	_, err = ApplyPatch(rom[:7], patch)
+	assert.ErrorIs(t, err, ErrPatchChecksum)
+
+	// Patch which has the correct checksums for an incorrect target
+	bad := appendBytes(patch[:len(patch)-12])
+	bad = appendPatchFooter(bad, rom, rom)
+	_, err = ApplyPatch(rom, bad)
+	assert.ErrorIs(t, err, ErrPatchChecksum, "target checksum should be checked")
+}
+
+func TestApplyPatch_Unknown(t *testing.T) {
+	_, err := ApplyPatch([]byte{0}, []byte("NOTAPATCH"))
+	assert.ErrorIs(t, err, ErrUnknownPatch)
+}
+
+func TestLoadROMFile_Patch(t *testing.T) {
+	dir := t.TempDir()
+	rom := []byte{0, 1, 2, 3}
+	ips := appendBytes([]byte("PATCH"), []byte{0x00, 0x00, 0x01, 0x00, 0x01, 0xAA}, []byte("EOF"))
+
+	// Write a zip file with the rom and a patch next to it
+	zipFile := filepath.Join(dir, "game.zip")
+	f, err := os.Create(zipFile)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	entry, err := w.Create("game.gb")
+	require.NoError(t, err)
+	_, err = entry.Write(rom)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "game.ips"), ips, 0644))
+
+	data, err := LoadROMFile(zipFile)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0xAA, 2, 3}, data, "patch next to the rom should be applied")
+
+	// An explicit patch is used instead of the patch next to the rom
+	other := filepath.Join(dir, "other.ips")
+	ips = appendBytes([]byte("PATCH"), []byte{0x00, 0x00, 0x02, 0x00, 0x01, 0xBB}, []byte("EOF"))
+	require.NoError(t, os.WriteFile(other, ips, 0644))
+	data, err = LoadPatchedROMFile(zipFile, other)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 0xBB, 3}, data)
+
+	_, err = LoadPatchedROMFile(zipFile, filepath.Join(dir, "missing.ips"))
+	assert.Error(t, err)
+}
@@ -1,37 +1,81 @@
 package cart
 
-// NewROM returns a new ROM cartridge.
+// NewROM returns a new ROM cartridge. The size of the RAM is read from the
+// cartridge header.
 func NewROM(data []byte) BankingController {
 	return &ROM{
 		rom: data,
+		ram: make([]byte, ramSize(data)),
 	}
 }
 
 // ROM is a basic Gameboy cartridge that contains a fixed rom and no
-// banking or RAM.
+// banking. It may also have up to 8KB of RAM, which is always enabled.
 type ROM struct {
+	dirtyTracker
+
 	rom []byte
+	ram []byte
 }
 
-// Read returns a value at a memory address in the ROM.
+// Read returns a value at a memory address in the ROM or RAM.
 func (r *ROM) Read(address uint16) byte {
-	return r.rom[address]
+	switch {
+	case address < 0x8000:
+		return r.rom[int(address)%len(r.rom)]
+	case len(r.ram) == 0:
+		return 0xFF
+	default:
+		return r.ram[int(address-0xA000)%len(r.ram)]
+	}
 }
 
 // WriteROM would switch between cartridge banks, however a ROM cart does
 // not support banking.
 func (r *ROM) WriteROM(address uint16, value byte) {}
 
-// WriteRAM would write data to the cartridge RAM, however a ROM cart does
-// not contain RAM so this is a noop.
-func (r *ROM) WriteRAM(address uint16, value byte) {}
+// WriteRAM writes data to the cartridge RAM, if the cartridge has RAM.
+func (r *ROM) WriteRAM(address uint16, value byte) {
+	if len(r.ram) == 0 {
+		return
+	}
+	r.ram[int(address-0xA000)%len(r.ram)] = value
+	r.markDirty()
+}
 
-// GetSaveData returns the save data for this banking controller. As RAM is
-// not supported on this memory controller, this is a noop.
+// GetSaveData returns the save data for this banking controller, which is
+// empty if the cartridge does not have RAM.
 func (r *ROM) GetSaveData() []byte {
-	return []byte{}
+	data := make([]byte, len(r.ram))
+	copy(data, r.ram)
+	return data
 }
 
-// LoadSaveData loads the save data into the cartridge. As RAM is not supported
-// on this memory controller, this is a noop.
-func (r *ROM) LoadSaveData([]byte) {}
+// LoadSaveData loads the save data into the cartridge.
+func (r *ROM) LoadSaveData(data []byte) {
+	copy(r.ram, data)
+}
+
+// Snapshot of the internal state of a ROM cartridge.
+type romState struct {
+	RAM []byte
+}
+
+// MarshalState returns a snapshot of the RAM.
+func (r *ROM) MarshalState() ([]byte, error) {
+	return encodeState(romState{RAM: r.ram})
+}
+
+// UnmarshalState restores the RAM from a snapshot.
+func (r *ROM) UnmarshalState(data []byte) error {
+	var state romState
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	if err := checkStateSize("RAM", state.RAM, r.ram); err != nil {
+		return err
+	}
+	copy(r.ram, state.RAM)
+	r.markDirty()
+	return nil
+}
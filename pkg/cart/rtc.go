@@ -0,0 +1,186 @@
+package cart
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// Function used to get the current wall clock time when the RTC is saved and
+// loaded, which can be replaced in tests.
+var now = time.Now
+
+// Number of clock cycles in each second of the RTC.
+const rtcCyclesPerSecond = 4194304
+
+// Length of the RTC data appended to the end of the save data. This is the
+// format used by VBA-M and BGB: the five clock registers, the five latched
+// registers (each as a 32 bit value) and a 64 bit unix timestamp of when the
+// data was saved. Some emulators use a 32 bit timestamp instead.
+const (
+	rtcFooterLength      = 48
+	rtcShortFooterLength = 44
+)
+
+// rtc is the real time clock of a MBC3 cartridge. It counts seconds, minutes,
+// hours and a 9 bit day counter, which sets the carry bit when it overflows.
+// The clock is advanced by the emulated clock cycles, unless it is halted,
+// and is only caught up with the wall clock when the save data is loaded.
+type rtc struct {
+	Seconds byte
+	Minutes byte
+	Hours   byte
+	Days    uint16
+	Halt    bool
+	Carry   bool
+
+	// Number of clock cycles since the last second.
+	Cycles int
+}
+
+// Advance the clock by a number of clock cycles.
+func (c *rtc) update(cycles int) {
+	if c.Halt {
+		return
+	}
+	c.Cycles += cycles
+	if c.Cycles < rtcCyclesPerSecond {
+		return
+	}
+	c.advance(int64(c.Cycles / rtcCyclesPerSecond))
+	c.Cycles %= rtcCyclesPerSecond
+}
+
+// Advance the clock by a number of seconds.
+func (c *rtc) advance(seconds int64) {
+	// Registers which have been set to values out of their normal range
+	// count up until they overflow without carrying, so step a second at a
+	// time until they are back in range.
+	for ; seconds > 0 && !c.inRange(); seconds-- {
+		c.tick()
+	}
+	if seconds == 0 {
+		return
+	}
+	total := int64(c.Seconds) + int64(c.Minutes)*60 + int64(c.Hours)*3600 +
+		int64(c.Days)*86400 + seconds
+	c.Seconds = byte(total % 60)
+	total /= 60
+	c.Minutes = byte(total % 60)
+	total /= 60
+	c.Hours = byte(total % 24)
+	total /= 24
+	if total > 0x1FF {
+		c.Carry = true
+	}
+	c.Days = uint16(total & 0x1FF)
+}
+
+// Check if all of the registers are within their normal range.
+func (c *rtc) inRange() bool {
+	return c.Seconds < 60 && c.Minutes < 60 && c.Hours < 24
+}
+
+// Advance the clock by a single second.
+func (c *rtc) tick() {
+	c.Seconds = (c.Seconds + 1) & 0x3F
+	if c.Seconds != 60 {
+		return
+	}
+	c.Seconds = 0
+	c.Minutes = (c.Minutes + 1) & 0x3F
+	if c.Minutes != 60 {
+		return
+	}
+	c.Minutes = 0
+	c.Hours = (c.Hours + 1) & 0x1F
+	if c.Hours != 24 {
+		return
+	}
+	c.Hours = 0
+	c.Days = (c.Days + 1) & 0x1FF
+	if c.Days == 0 {
+		c.Carry = true
+	}
+}
+
+// Read one of the clock registers, which are selected by the RAM bank
+// 0x08-0x0C.
+func (c *rtc) read(register byte) byte {
+	switch register {
+	case 0x08:
+		return c.Seconds
+	case 0x09:
+		return c.Minutes
+	case 0x0A:
+		return c.Hours
+	case 0x0B:
+		return byte(c.Days)
+	case 0x0C:
+		return byte(c.Days>>8) | boolBit(c.Halt, 6) | boolBit(c.Carry, 7)
+	}
+	return 0xFF
+}
+
+// Write to one of the clock registers. Writing to the seconds register also
+// resets the time until the next second.
+func (c *rtc) write(register byte, value byte) {
+	switch register {
+	case 0x08:
+		c.Seconds = value & 0x3F
+		c.Cycles = 0
+	case 0x09:
+		c.Minutes = value & 0x3F
+	case 0x0A:
+		c.Hours = value & 0x1F
+	case 0x0B:
+		c.Days = c.Days&0x100 | uint16(value)
+	case 0x0C:
+		c.Days = c.Days&0xFF | uint16(value&0x1)<<8
+		c.Halt = value&0x40 != 0
+		c.Carry = value&0x80 != 0
+	}
+}
+
+// Append the clock and latched clock registers to save data in the RTC
+// footer format, with the current time as the time it was saved.
+func appendRTCFooter(data []byte, clock, latched *rtc) []byte {
+	footer := make([]byte, rtcFooterLength)
+	for i := byte(0); i < 5; i++ {
+		binary.LittleEndian.PutUint32(footer[i*4:], uint32(clock.read(0x08+i)))
+		binary.LittleEndian.PutUint32(footer[20+i*4:], uint32(latched.read(0x08+i)))
+	}
+	binary.LittleEndian.PutUint64(footer[40:], uint64(now().Unix()))
+	return append(data, footer...)
+}
+
+// Read the clock and latched clock registers from the RTC footer at the end
+// of some save data. The clock is advanced by the time since the data was
+// saved. Returns false if the data is not the expected length.
+func readRTCFooter(data []byte, ramLength int, clock, latched *rtc) bool {
+	footer := data[ramLength:]
+	if len(footer) != rtcFooterLength && len(footer) != rtcShortFooterLength {
+		return false
+	}
+	for i := byte(0); i < 5; i++ {
+		clock.write(0x08+i, byte(binary.LittleEndian.Uint32(footer[i*4:])))
+		latched.write(0x08+i, byte(binary.LittleEndian.Uint32(footer[20+i*4:])))
+	}
+	var saved int64
+	if len(footer) == rtcFooterLength {
+		saved = int64(binary.LittleEndian.Uint64(footer[40:]))
+	} else {
+		saved = int64(binary.LittleEndian.Uint32(footer[40:]))
+	}
+	if elapsed := int64(now().Sub(time.Unix(saved, 0)) / time.Second); elapsed > 0 && !clock.Halt {
+		clock.advance(elapsed)
+	}
+	return true
+}
+
+// Get a byte with a single bit set if a value is true.
+func boolBit(value bool, bit uint) byte {
+	if value {
+		return 1 << bit
+	}
+	return 0
+}
@@ -0,0 +1,138 @@
+package cart
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How often the save data is checked for changes and written to the store.
+const saveInterval = time.Second
+
+// SaveStore persists the battery backed save data of a cartridge between
+// sessions. Implementations may store the data anywhere, for example in a
+// file, in memory or over the network.
+type SaveStore interface {
+	// Load returns the previously stored save data. If there is no save
+	// data then nil should be returned with no error.
+	Load() ([]byte, error)
+
+	// Save stores the save data, replacing any previously stored data.
+	Save(data []byte) error
+}
+
+// NewFileSaveStore returns a SaveStore which stores save data in a file.
+func NewFileSaveStore(filename string) *FileSaveStore {
+	return &FileSaveStore{filename: filename}
+}
+
+// FileSaveStore is a SaveStore which reads and writes save data to a file.
+type FileSaveStore struct {
+	filename string
+}
+
+// Load reads the save data from the file. If the file does not exist then
+// no data is returned.
+func (s *FileSaveStore) Load() ([]byte, error) {
+	data, err := ioutil.ReadFile(s.filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Save writes the save data to a temporary file and then renames it over the
+// save file, so that the save file is never left partially written.
+func (s *FileSaveStore) Save(data []byte) error {
+	dir, base := filepath.Split(s.filename)
+	tmp, err := ioutil.TempFile(dir, base+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.filename)
+}
+
+// NewMemorySaveStore returns a SaveStore which keeps the save data in
+// memory, starting with some initial data which may be nil.
+func NewMemorySaveStore(data []byte) *MemorySaveStore {
+	return &MemorySaveStore{data: data}
+}
+
+// MemorySaveStore is a SaveStore which keeps the save data in memory. It is
+// safe to read the data while the cartridge is saving.
+type MemorySaveStore struct {
+	mu    sync.Mutex
+	data  []byte
+	saves int
+}
+
+// Load returns a copy of the save data.
+func (s *MemorySaveStore) Load() ([]byte, error) {
+	return s.Data(), nil
+}
+
+// Save stores a copy of the save data.
+func (s *MemorySaveStore) Save(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = append([]byte(nil), data...)
+	s.saves++
+	return nil
+}
+
+// Data returns a copy of the currently stored save data.
+func (s *MemorySaveStore) Data() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		return nil
+	}
+	return append([]byte(nil), s.data...)
+}
+
+// Saves returns the number of times the save data has been written.
+func (s *MemorySaveStore) Saves() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saves
+}
+
+// Tracks whether the save data of a banking controller has changed since
+// it was last saved. The flag is read from the save loop, so is atomic.
+type dirtyTracker struct {
+	dirty atomic.Bool
+}
+
+// Mark the save data as changed.
+func (d *dirtyTracker) markDirty() {
+	d.dirty.Store(true)
+}
+
+// IsDirty returns if the save data has changed since it was last saved.
+func (d *dirtyTracker) IsDirty() bool {
+	return d.dirty.Load()
+}
+
+// ClearDirty marks the save data as saved.
+func (d *dirtyTracker) ClearDirty() {
+	d.dirty.Store(false)
+}
@@ -0,0 +1,75 @@
+package cart
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Make a MBC1+RAM+BATTERY rom with 32KB of RAM.
+func batteryROM() []byte {
+	rom := make([]byte, 0x8000)
+	rom[0x147] = 0x03
+	rom[0x149] = 0x03
+	return rom
+}
+
+func TestCart_SaveDirtyTracking(t *testing.T) {
+	store := NewMemorySaveStore(nil)
+	cart := NewCartWithStore(batteryROM(), "test", store)
+
+	// Nothing has been written so nothing should be saved
+	cart.Save()
+	assert.Equal(t, 0, store.Saves())
+
+	cart.WriteROM(0x0000, 0x0A) // Enable RAM
+	cart.WriteRAM(0xA001, 0x42)
+	cart.Save()
+	assert.Equal(t, 1, store.Saves())
+	assert.Equal(t, byte(0x42), store.Data()[1])
+
+	// No further changes
+	cart.Save()
+	assert.Equal(t, 1, store.Saves())
+
+	// Closing flushes any unsaved writes and stops the save loop
+	cart.WriteRAM(0xA002, 0x43)
+	require.NoError(t, cart.Close())
+	assert.Equal(t, 2, store.Saves())
+	assert.Equal(t, byte(0x43), store.Data()[2])
+	require.NoError(t, cart.Close())
+}
+
+func TestCart_LoadsSaveStore(t *testing.T) {
+	store := NewMemorySaveStore(bytes.Repeat([]byte{0x11}, 0x8000))
+	cart := NewCartWithStore(batteryROM(), "test", store)
+	defer cart.Close()
+
+	cart.WriteROM(0x0000, 0x0A) // Enable RAM
+	assert.Equal(t, byte(0x11), cart.Read(0xA000))
+	assert.False(t, cart.IsDirty(), "loading save data should not mark it dirty")
+}
+
+func TestFileSaveStore(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "game.gb.sav")
+	store := NewFileSaveStore(filename)
+
+	data, err := store.Load()
+	require.NoError(t, err)
+	assert.Nil(t, data, "expected no data when the file does not exist")
+
+	require.NoError(t, store.Save([]byte{1, 2, 3}))
+	require.NoError(t, store.Save([]byte{4, 5, 6}))
+	data, err = store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{4, 5, 6}, data)
+
+	// The temporary files should have been renamed over the save file
+	files, err := os.ReadDir(filepath.Dir(filename))
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
@@ -0,0 +1,30 @@
+package cart
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// Encode a banking controller state struct into bytes.
+func encodeState(state interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode bytes created by encodeState back into a state struct.
+func decodeState(data []byte, state interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(state)
+}
+
+// Check that memory in a state struct is the same size as the memory of the
+// banking controller which it will be copied into.
+func checkStateSize(name string, state, memory []byte) error {
+	if len(state) != len(memory) {
+		return fmt.Errorf("state has %v bytes of %s but cartridge has %v", len(state), name, len(memory))
+	}
+	return nil
+}
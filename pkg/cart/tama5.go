@@ -0,0 +1,152 @@
+package cart
+
+// NewTAMA5 returns a new Bandai TAMA5 memory controller.
+func NewTAMA5(data []byte) BankingController {
+	return &TAMA5{
+		rom:      data,
+		romBanks: romBankCount(data),
+		romBank:  1,
+	}
+}
+
+// TAMA5 is a Bandai cartridge which is accessed through a set of nibble
+// registers instead of being mapped into memory. A register is selected by
+// writing its index to 0xA001, and then written or read through 0xA000:
+//
+//	0x0  ROM bank (low nibble)
+//	0x1  ROM bank (high bit)
+//	0x4  Data to write (low nibble)
+//	0x5  Data to write (high nibble)
+//	0x6  Command and address (bit 4)
+//	0x7  Address (low nibble), which runs the command
+//	0xA  Ready flag, which reads as 1
+//	0xC  Data read (low nibble)
+//	0xD  Data read (high nibble)
+//
+// The cartridge has 32 bytes of battery backed RAM, which is read and written
+// by the commands.
+type TAMA5 struct {
+	dirtyTracker
+
+	rom      []byte
+	romBanks int
+	romBank  int
+
+	ram       [0x20]byte
+	registers [0x10]byte
+	selected  byte
+	output    byte
+}
+
+// Commands which can be run on the TAMA5 by writing the address.
+const (
+	tama5WriteRAM = 0x0
+	tama5ReadRAM  = 0x1
+)
+
+// Read returns a value at a memory address in the ROM or from the selected
+// register.
+func (r *TAMA5) Read(address uint16) byte {
+	if address < 0x8000 {
+		bank := r.ROMBank(address)
+		return r.rom[(bank*0x4000+int(address&0x3FFF))%len(r.rom)]
+	}
+	if address&0x1 != 0 {
+		return 0xFF
+	}
+	switch r.selected {
+	case 0xA:
+		return 0xF1
+	case 0xC:
+		return 0xF0 | r.output&0xF
+	case 0xD:
+		return 0xF0 | r.output>>4
+	}
+	return 0xFF
+}
+
+// ROMBank returns the ROM bank mapped to an address.
+func (r *TAMA5) ROMBank(address uint16) int {
+	if address < 0x4000 {
+		return 0
+	}
+	return r.romBank & (r.romBanks - 1)
+}
+
+// WriteROM does nothing, as all of the registers are accessed through the
+// RAM area.
+func (r *TAMA5) WriteROM(address uint16, value byte) {}
+
+// WriteRAM selects a register, or writes a nibble to the selected register.
+func (r *TAMA5) WriteRAM(address uint16, value byte) {
+	if address&0x1 != 0 {
+		r.selected = value & 0xF
+		return
+	}
+	r.registers[r.selected] = value & 0xF
+	switch r.selected {
+	case 0x0, 0x1:
+		r.romBank = int(r.registers[1]&0x1)<<4 | int(r.registers[0])
+	case 0x7:
+		r.runCommand()
+	}
+}
+
+// Run the command in register 6 on the address in registers 6 and 7.
+func (r *TAMA5) runCommand() {
+	address := int(r.registers[6]&0x1)<<4 | int(r.registers[7])
+	switch r.registers[6] >> 1 {
+	case tama5WriteRAM:
+		r.ram[address] = r.registers[5]<<4 | r.registers[4]
+		r.markDirty()
+	case tama5ReadRAM:
+		r.output = r.ram[address]
+	}
+}
+
+// GetSaveData returns the save data for this banking controller.
+func (r *TAMA5) GetSaveData() []byte {
+	data := make([]byte, len(r.ram))
+	copy(data, r.ram[:])
+	return data
+}
+
+// LoadSaveData loads the save data into the cartridge.
+func (r *TAMA5) LoadSaveData(data []byte) {
+	copy(r.ram[:], data)
+}
+
+// Snapshot of the internal state of a TAMA5 cartridge.
+type tama5State struct {
+	ROMBank   int
+	RAM       [0x20]byte
+	Registers [0x10]byte
+	Selected  byte
+	Output    byte
+}
+
+// MarshalState returns a snapshot of the registers and RAM.
+func (r *TAMA5) MarshalState() ([]byte, error) {
+	return encodeState(tama5State{
+		ROMBank:   r.romBank,
+		RAM:       r.ram,
+		Registers: r.registers,
+		Selected:  r.selected,
+		Output:    r.output,
+	})
+}
+
+// UnmarshalState restores the registers and RAM from a snapshot.
+func (r *TAMA5) UnmarshalState(data []byte) error {
+	var state tama5State
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	r.romBank = state.ROMBank
+	r.ram = state.RAM
+	r.registers = state.Registers
+	r.selected = state.Selected
+	r.output = state.Output
+	r.markDirty()
+	return nil
+}
@@ -0,0 +1,46 @@
+package cart
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Write a nibble to one of the TAMA5 registers.
+func writeTAMA5(mbc BankingController, register, value byte) {
+	mbc.WriteRAM(0xA001, register)
+	mbc.WriteRAM(0xA000, value)
+}
+
+// Read a nibble from one of the TAMA5 registers.
+func readTAMA5(mbc BankingController, register byte) byte {
+	mbc.WriteRAM(0xA001, register)
+	return mbc.Read(0xA000)
+}
+
+func TestTAMA5_ROMBanking(t *testing.T) {
+	mbc := NewTAMA5(newBankedROM(32, 0x04, 0x00))
+	writeTAMA5(mbc, 0x0, 0x3)
+	writeTAMA5(mbc, 0x1, 0x1)
+	assert.Equal(t, byte(0x13), mbc.Read(0x4000))
+	assert.Equal(t, byte(0), mbc.Read(0x0000))
+}
+
+func TestTAMA5_RAM(t *testing.T) {
+	mbc := NewTAMA5(newBankedROM(32, 0x04, 0x00))
+	assert.Equal(t, byte(0xF1), readTAMA5(mbc, 0xA))
+
+	// Write 0x5A to address 0x13
+	writeTAMA5(mbc, 0x4, 0xA)
+	writeTAMA5(mbc, 0x5, 0x5)
+	writeTAMA5(mbc, 0x6, tama5WriteRAM<<1|0x1)
+	writeTAMA5(mbc, 0x7, 0x3)
+	assert.Equal(t, byte(0x5A), mbc.GetSaveData()[0x13])
+	assert.True(t, mbc.IsDirty())
+
+	// Read it back
+	writeTAMA5(mbc, 0x6, tama5ReadRAM<<1|0x1)
+	writeTAMA5(mbc, 0x7, 0x3)
+	assert.Equal(t, byte(0xFA), readTAMA5(mbc, 0xC))
+	assert.Equal(t, byte(0xF5), readTAMA5(mbc, 0xD))
+}
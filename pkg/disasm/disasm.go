@@ -0,0 +1,258 @@
+// Package disasm disassembles Gameboy (SM83) machine code into mnemonics,
+// with support for resolving addresses to labels from symbol files.
+package disasm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ReadFunc reads a byte of memory at an address.
+type ReadFunc func(address uint16) byte
+
+// Operand types which an instruction template can contain.
+const (
+	// 8 bit immediate value.
+	opD8 = "d8"
+	// 16 bit immediate value.
+	opD16 = "d16"
+	// 16 bit address.
+	opA16 = "a16"
+	// 8 bit address offset from 0xFF00.
+	opA8 = "a8"
+	// 8 bit signed relative jump.
+	opR8 = "r8"
+	// 8 bit signed value added to SP.
+	opE8 = "e8"
+)
+
+// Instruction is a single decoded instruction.
+type Instruction struct {
+	// Address of the first byte of the instruction.
+	Address uint16
+	// Bytes of the instruction, including the opcode and operands.
+	Bytes []byte
+	// Target is the address referenced by the instruction operand if
+	// HasTarget is true. For jumps and calls this is the destination,
+	// otherwise it is the memory address which is accessed.
+	Target    uint16
+	HasTarget bool
+
+	// Mnemonic with a %s in place of the operand.
+	format  string
+	operand string
+}
+
+// String returns the mnemonic of the instruction with its operands.
+func (ins Instruction) String() string {
+	if ins.format == "" {
+		return ""
+	}
+	if !strings.Contains(ins.format, "%s") {
+		return ins.format
+	}
+	return fmt.Sprintf(ins.format, ins.operand)
+}
+
+// Len returns the length of the instruction in bytes.
+func (ins Instruction) Len() int {
+	return len(ins.Bytes)
+}
+
+// Decode decodes the instruction at an address.
+func Decode(read ReadFunc, address uint16) Instruction {
+	opcode := read(address)
+	ins := Instruction{Address: address, Bytes: []byte{opcode}}
+	if opcode == 0xCB {
+		next := read(address + 1)
+		ins.Bytes = append(ins.Bytes, next)
+		ins.format = cbTemplates[next]
+		return ins
+	}
+	if opcode == 0x10 {
+		// STOP is followed by a padding byte which is skipped
+		ins.Bytes = append(ins.Bytes, read(address+1))
+	}
+
+	template := templates[opcode]
+	var operand string
+	for _, op := range []string{opD16, opA16, opD8, opA8, opR8, opE8} {
+		if strings.Contains(template, op) {
+			operand = op
+			template = strings.Replace(template, op, "%s", 1)
+			break
+		}
+	}
+	ins.format = template
+
+	switch operand {
+	case opD16, opA16:
+		lo, hi := read(address+1), read(address+2)
+		ins.Bytes = append(ins.Bytes, lo, hi)
+		value := uint16(hi)<<8 | uint16(lo)
+		ins.operand = fmt.Sprintf("$%04X", value)
+		if operand == opA16 {
+			ins.Target, ins.HasTarget = value, true
+		}
+	case opD8:
+		value := read(address + 1)
+		ins.Bytes = append(ins.Bytes, value)
+		ins.operand = fmt.Sprintf("$%02X", value)
+	case opA8:
+		value := read(address + 1)
+		ins.Bytes = append(ins.Bytes, value)
+		ins.Target, ins.HasTarget = 0xFF00+uint16(value), true
+		ins.operand = fmt.Sprintf("$%04X", ins.Target)
+	case opR8:
+		value := read(address + 1)
+		ins.Bytes = append(ins.Bytes, value)
+		ins.Target, ins.HasTarget = address+2+uint16(int8(value)), true
+		ins.operand = fmt.Sprintf("$%04X", ins.Target)
+	case opE8:
+		value := int8(read(address + 1))
+		ins.Bytes = append(ins.Bytes, byte(value))
+		if value < 0 {
+			ins.operand = fmt.Sprintf("-$%02X", -int(value))
+		} else {
+			ins.operand = fmt.Sprintf("+$%02X", value)
+		}
+	}
+	return ins
+}
+
+// Range decodes all of the instructions which start between the start and
+// end addresses (inclusive).
+func Range(read ReadFunc, start, end uint16) []Instruction {
+	var instructions []Instruction
+	for address := uint32(start); address <= uint32(end); {
+		ins := Decode(read, uint16(address))
+		instructions = append(instructions, ins)
+		address += uint32(ins.Len())
+	}
+	return instructions
+}
+
+// ROMReader returns a ReadFunc which reads from a ROM as if a bank was
+// mapped into the switchable ROM area at 0x4000-0x7FFF. Addresses outside
+// of the ROM read as 0xFF.
+func ROMReader(rom []byte, bank int) ReadFunc {
+	return func(address uint16) byte {
+		offset := int(address)
+		switch {
+		case address >= 0x8000:
+			return 0xFF
+		case address >= 0x4000:
+			offset = bank*0x4000 + int(address-0x4000)
+		}
+		if offset >= len(rom) {
+			return 0xFF
+		}
+		return rom[offset]
+	}
+}
+
+// Instruction templates for the opcodes, built using the init function.
+var templates [0x100]string
+
+// Instruction templates for the CB prefixed opcodes.
+var cbTemplates [0x100]string
+
+func init() {
+	// Opcodes are decoded from their bit pattern xxyyyzzz
+	regs := []string{"B", "C", "D", "E", "H", "L", "(HL)", "A"}
+	pairs := []string{"BC", "DE", "HL", "SP"}
+	stackPairs := []string{"BC", "DE", "HL", "AF"}
+	conds := []string{"NZ", "Z", "NC", "C"}
+	alu := []string{"ADD A,", "ADC A,", "SUB ", "SBC A,", "AND ", "XOR ", "OR ", "CP "}
+	indirect := []string{"(BC)", "(DE)", "(HL+)", "(HL-)"}
+	misc := []string{"RLCA", "RRCA", "RLA", "RRA", "DAA", "CPL", "SCF", "CCF"}
+
+	for i := 0; i < 0x100; i++ {
+		x, y, z := i>>6, (i>>3)&7, i&7
+		p, q := y>>1, y&1
+		var t string
+		switch x {
+		case 0:
+			switch z {
+			case 0:
+				t = []string{"NOP", "LD (a16),SP", "STOP", "JR r8"}[min(y, 3)]
+				if y >= 4 {
+					t = "JR " + conds[y-4] + ",r8"
+				}
+			case 1:
+				t = "LD " + pairs[p] + ",d16"
+				if q == 1 {
+					t = "ADD HL," + pairs[p]
+				}
+			case 2:
+				t = "LD " + indirect[p] + ",A"
+				if q == 1 {
+					t = "LD A," + indirect[p]
+				}
+			case 3:
+				t = []string{"INC ", "DEC "}[q] + pairs[p]
+			case 4:
+				t = "INC " + regs[y]
+			case 5:
+				t = "DEC " + regs[y]
+			case 6:
+				t = "LD " + regs[y] + ",d8"
+			case 7:
+				t = misc[y]
+			}
+		case 1:
+			t = "LD " + regs[y] + "," + regs[z]
+			if i == 0x76 {
+				t = "HALT"
+			}
+		case 2:
+			t = alu[y] + regs[z]
+		case 3:
+			switch z {
+			case 0:
+				if y < 4 {
+					t = "RET " + conds[y]
+				} else {
+					t = []string{"LDH (a8),A", "ADD SP,e8", "LDH A,(a8)", "LD HL,SPe8"}[y-4]
+				}
+			case 1:
+				t = "POP " + stackPairs[p]
+				if q == 1 {
+					t = []string{"RET", "RETI", "JP HL", "LD SP,HL"}[p]
+				}
+			case 2:
+				if y < 4 {
+					t = "JP " + conds[y] + ",a16"
+				} else {
+					t = []string{"LD (C),A", "LD (a16),A", "LD A,(C)", "LD A,(a16)"}[y-4]
+				}
+			case 3:
+				t = []string{"JP a16", "PREFIX CB", "", "", "", "", "DI", "EI"}[y]
+			case 4:
+				if y < 4 {
+					t = "CALL " + conds[y] + ",a16"
+				}
+			case 5:
+				t = "PUSH " + stackPairs[p]
+				if q == 1 {
+					t = []string{"CALL a16", "", "", ""}[p]
+				}
+			case 6:
+				t = alu[y] + "d8"
+			case 7:
+				t = fmt.Sprintf("RST $%02X", y*8)
+			}
+		}
+		if t == "" {
+			// Opcodes which do not exist on the SM83
+			t = fmt.Sprintf("DB $%02X", i)
+		}
+		templates[i] = t
+
+		cb := []string{"RLC ", "RRC ", "RL ", "RR ", "SLA ", "SRA ", "SWAP ", "SRL "}[y] + regs[z]
+		if x > 0 {
+			cb = fmt.Sprintf("%s %v,%s", []string{"BIT", "RES", "SET"}[x-1], y, regs[z])
+		}
+		cbTemplates[i] = cb
+	}
+}
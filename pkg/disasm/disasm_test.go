@@ -0,0 +1,118 @@
+package disasm
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Get a ReadFunc for some bytes starting at an address.
+func readBytes(address uint16, data ...byte) ReadFunc {
+	return func(addr uint16) byte {
+		if addr < address || int(addr-address) >= len(data) {
+			return 0
+		}
+		return data[addr-address]
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		expected string
+		length   int
+	}{
+		{[]byte{0x00}, "NOP", 1},
+		{[]byte{0x01, 0x34, 0x12}, "LD BC,$1234", 3},
+		{[]byte{0x08, 0x00, 0xC0}, "LD ($C000),SP", 3},
+		{[]byte{0x10, 0x00}, "STOP", 2},
+		{[]byte{0x18, 0xFE}, "JR $0200", 2},
+		{[]byte{0x20, 0x05}, "JR NZ,$0207", 2},
+		{[]byte{0x22}, "LD (HL+),A", 1},
+		{[]byte{0x3E, 0x42}, "LD A,$42", 2},
+		{[]byte{0x76}, "HALT", 1},
+		{[]byte{0x7E}, "LD A,(HL)", 1},
+		{[]byte{0xAF}, "XOR A", 1},
+		{[]byte{0xC3, 0x50, 0x01}, "JP $0150", 3},
+		{[]byte{0xCD, 0x0C, 0x4C}, "CALL $4C0C", 3},
+		{[]byte{0xD3}, "DB $D3", 1},
+		{[]byte{0xE0, 0x40}, "LDH ($FF40),A", 2},
+		{[]byte{0xE8, 0xFE}, "ADD SP,-$02", 2},
+		{[]byte{0xEA, 0x00, 0xC0}, "LD ($C000),A", 3},
+		{[]byte{0xF8, 0x05}, "LD HL,SP+$05", 2},
+		{[]byte{0xFE, 0x90}, "CP $90", 2},
+		{[]byte{0xFF}, "RST $38", 1},
+		{[]byte{0xCB, 0x37}, "SWAP A", 2},
+		{[]byte{0xCB, 0x7E}, "BIT 7,(HL)", 2},
+		{[]byte{0xCB, 0xC1}, "SET 0,C", 2},
+	}
+	for _, test := range tests {
+		ins := Decode(readBytes(0x200, test.data...), 0x200)
+		assert.Equal(t, test.expected, ins.String(), "opcode %02X", test.data)
+		assert.Equal(t, test.length, ins.Len(), "length of %v", test.expected)
+	}
+}
+
+func TestDecode_Target(t *testing.T) {
+	ins := Decode(readBytes(0x150, 0x38, 0xFA), 0x150)
+	assert.True(t, ins.HasTarget)
+	assert.Equal(t, uint16(0x14C), ins.Target)
+
+	ins = Decode(readBytes(0x150, 0x3E, 0x40), 0x150)
+	assert.False(t, ins.HasTarget, "immediate values are not targets")
+}
+
+func TestRange(t *testing.T) {
+	read := readBytes(0x100, 0x00, 0xC3, 0x50, 0x01, 0xCB, 0x11)
+	instructions := Range(read, 0x100, 0x104)
+	require.Len(t, instructions, 3)
+	assert.Equal(t, []uint16{0x100, 0x101, 0x104}, []uint16{instructions[0].Address, instructions[1].Address, instructions[2].Address})
+	assert.Equal(t, "RL C", instructions[2].String())
+}
+
+func TestROMReader(t *testing.T) {
+	rom := make([]byte, 0x10000)
+	rom[0x100] = 1
+	rom[0x4000*2+0x10] = 2
+	read := ROMReader(rom, 2)
+	assert.Equal(t, byte(1), read(0x100))
+	assert.Equal(t, byte(2), read(0x4010))
+	assert.Equal(t, byte(0xFF), read(0xC000))
+	assert.Equal(t, byte(0xFF), ROMReader(rom, 8)(0x4000), "bank is outside of the rom")
+}
+
+func TestParseSymbols(t *testing.T) {
+	f, err := os.Open("./../../roms/mooneye/acceptance/halt_ime0_ei.sym")
+	require.NoError(t, err)
+	defer f.Close()
+	symbols, err := ParseSymbols(f)
+	require.NoError(t, err)
+
+	name, ok := symbols.Lookup(1, 0x4C0C)
+	assert.True(t, ok)
+	assert.Equal(t, "print_load_font", name)
+
+	_, ok = symbols.Lookup(2, 0x4C0C)
+	assert.False(t, ok, "label is in a different bank")
+
+	symbol, ok := symbols.Find("print_load_font")
+	assert.True(t, ok)
+	assert.Equal(t, Symbol{Name: "print_load_font", Bank: 1, Address: 0x4C0C}, symbol)
+
+	name, ok = symbols.Lookup(5, 0xC000)
+	assert.True(t, ok, "labels outside of rom match any bank")
+	assert.Equal(t, "regs_save", name)
+
+	ins := Decode(readBytes(0x200, 0xCD, 0x0C, 0x4C), 0x200)
+	assert.Equal(t, "CALL print_load_font", symbols.Format(ins, 1))
+	assert.Equal(t, "CALL $4C0C", symbols.Format(ins, 2))
+	assert.Equal(t, "CALL $4C0C", (*Symbols)(nil).Format(ins, 1))
+}
+
+func TestParseSymbols_Invalid(t *testing.T) {
+	_, err := ParseSymbols(strings.NewReader("; comment\n00:0150 main\nnonsense\n"))
+	assert.EqualError(t, err, `invalid symbol on line 3: "nonsense"`)
+}
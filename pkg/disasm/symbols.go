@@ -0,0 +1,146 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Symbol is a label at an address in a bank.
+type Symbol struct {
+	Name    string
+	Bank    int
+	Address uint16
+}
+
+func (s Symbol) String() string {
+	return fmt.Sprintf("%02X:%04X %s", s.Bank, s.Address, s.Name)
+}
+
+// Symbols is a table of labels loaded from a symbol file.
+type Symbols struct {
+	symbols []Symbol
+	byAddr  map[Symbol]string
+	byName  map[string]Symbol
+}
+
+// LoadSymbols loads a symbol file from disk.
+func LoadSymbols(filename string) (*Symbols, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseSymbols(f)
+}
+
+// ParseSymbols parses symbols in the .sym format written by RGBDS and WLA-DX,
+// where each line is in the format 'BB:AAAA name'. Comments starting with a
+// semicolon are ignored, as are any sections other than '[labels]' such as the
+// constants in WLA-DX '[definitions]' sections.
+func ParseSymbols(r io.Reader) (*Symbols, error) {
+	symbols := &Symbols{
+		byAddr: map[Symbol]string{},
+		byName: map[string]Symbol{},
+	}
+	var section string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, ';'); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if strings.HasPrefix(text, "[") {
+			section = strings.Trim(text, "[]")
+			continue
+		}
+		if text == "" || (section != "" && section != "labels") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		location := strings.SplitN(fields[0], ":", 2)
+		if len(fields) != 2 || len(location) != 2 {
+			return nil, fmt.Errorf("invalid symbol on line %v: %q", line, text)
+		}
+		bank, err := strconv.ParseUint(location[0], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bank on line %v: %v", line, err)
+		}
+		address, err := strconv.ParseUint(location[1], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address on line %v: %v", line, err)
+		}
+		symbols.add(Symbol{Name: fields[1], Bank: int(bank), Address: uint16(address)})
+	}
+	return symbols, scanner.Err()
+}
+
+// Add a symbol to the table. If there are multiple labels at the same
+// address then the first is used when resolving addresses.
+func (s *Symbols) add(symbol Symbol) {
+	s.symbols = append(s.symbols, symbol)
+	key := Symbol{Bank: symbol.Bank, Address: symbol.Address}
+	if _, ok := s.byAddr[key]; !ok {
+		s.byAddr[key] = symbol.Name
+	}
+	if _, ok := s.byName[symbol.Name]; !ok {
+		s.byName[symbol.Name] = symbol
+	}
+}
+
+// All returns all of the symbols in the order they were loaded.
+func (s *Symbols) All() []Symbol {
+	if s == nil {
+		return nil
+	}
+	return s.symbols
+}
+
+// Lookup returns the label at an address. The bank is the ROM bank which is
+// mapped into 0x4000-0x7FFF. Addresses in the fixed ROM bank are looked up
+// in bank 0, and addresses outside of ROM match a label in any bank.
+func (s *Symbols) Lookup(bank int, address uint16) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	switch {
+	case address < 0x4000:
+		bank = 0
+	case address >= 0x8000:
+		for _, symbol := range s.symbols {
+			if symbol.Address == address {
+				return symbol.Name, true
+			}
+		}
+		return "", false
+	}
+	name, ok := s.byAddr[Symbol{Bank: bank, Address: address}]
+	return name, ok
+}
+
+// Find returns the symbol with a name.
+func (s *Symbols) Find(name string) (Symbol, bool) {
+	if s == nil {
+		return Symbol{}, false
+	}
+	symbol, ok := s.byName[name]
+	return symbol, ok
+}
+
+// Format returns the mnemonic of an instruction with its target address
+// replaced by a label if there is one. The bank is the ROM bank which is
+// mapped into 0x4000-0x7FFF.
+func (s *Symbols) Format(ins Instruction, bank int) string {
+	if !ins.HasTarget {
+		return ins.String()
+	}
+	if name, ok := s.Lookup(bank, ins.Target); ok {
+		return fmt.Sprintf(ins.format, name)
+	}
+	return ins.String()
+}
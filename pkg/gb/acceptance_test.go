@@ -14,9 +14,58 @@ const romPath = "../../roms/mooneye/acceptance"
 // Currently these do not all pass, so the function is renamed as to not
 // run on CI.
 //
-// 16 passed
+// 52 passed
 func _TestAcceptance(t *testing.T) {
-	err := filepath.Walk(romPath, func(path string, _ os.FileInfo, _ error) error {
+	runMooneyeTests(t, romPath)
+}
+
+// TestAcceptanceTimer runs the mooneye timer test roms, which should all pass.
+func TestAcceptanceTimer(t *testing.T) {
+	runMooneyeTests(t, filepath.Join(romPath, "timer"))
+}
+
+// Mooneye test roms which check the timing of the memory accesses made by
+// instructions, interrupts and OAM DMA.
+var memoryTimingTests = []string{
+	"add_sp_e_timing",
+	"call_cc_timing",
+	"call_cc_timing2",
+	"call_timing",
+	"call_timing2",
+	"di_timing-GS",
+	"halt_ime0_nointr_timing",
+	"halt_ime1_timing2-GS",
+	"jp_cc_timing",
+	"jp_timing",
+	"ld_hl_sp_e_timing",
+	"oam_dma_restart",
+	"oam_dma_start",
+	"oam_dma_timing",
+	"pop_timing",
+	"push_timing",
+	"ret_cc_timing",
+	"ret_timing",
+	"reti_timing",
+	"rst_timing",
+	"ppu/intr_1_2_timing-GS",
+	"ppu/intr_2_0_timing",
+	"ppu/intr_2_mode0_timing",
+	"ppu/intr_2_mode3_timing",
+}
+
+// TestAcceptanceMemoryTiming runs the mooneye memory timing test roms, which
+// should all pass.
+func TestAcceptanceMemoryTiming(t *testing.T) {
+	for _, name := range memoryTimingTests {
+		t.Run(name, func(t *testing.T) {
+			runMooneyeTest(t, filepath.Join(romPath, name+".gb"))
+		})
+	}
+}
+
+// Run all of the mooneye test roms in a directory.
+func runMooneyeTests(t *testing.T, dir string) {
+	err := filepath.Walk(dir, func(path string, _ os.FileInfo, _ error) error {
 		if filepath.Ext(path) == ".gb" {
 			name := path[len(romPath)+1 : len(path)-3]
 			t.Run(name, func(t *testing.T) {
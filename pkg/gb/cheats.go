@@ -0,0 +1,320 @@
+package gb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CheatKind is the type of device a cheat code is for.
+type CheatKind byte
+
+const (
+	// GameGenie codes replace a byte of the cartridge ROM when it is read.
+	GameGenie CheatKind = iota
+	// GameShark codes write a byte to RAM at the end of every frame.
+	GameShark
+)
+
+func (k CheatKind) String() string {
+	if k == GameShark {
+		return "GameShark"
+	}
+	return "Game Genie"
+}
+
+// Cheat is a Game Genie or GameShark code.
+//
+// Game Genie codes are in the format ABC-DEF-GHI, where AB is the new value,
+// FCDE is the ROM address XOR 0xF000, and GI is the value that the ROM must
+// contain for it to be replaced (rotated and XORed with 0xBA). The last group
+// is optional, in which case the value is always replaced.
+//
+// GameShark codes are in the format TTVVLLHH, where VV is the value to write
+// to the address HHLL. The type TT selects the RAM bank: 0x01 writes to the
+// bank which is currently mapped, 0x80-0x8F writes to a bank of the
+// cartridge RAM, and 0x90-0x97 writes to a bank of the CGB work RAM.
+type Cheat struct {
+	// Code is the code the cheat was parsed from.
+	Code string
+	// Name is a description of what the cheat does.
+	Name string
+	// Enabled is if the cheat is applied.
+	Enabled bool
+
+	Kind    CheatKind
+	Address uint16
+	Value   byte
+
+	// Compare is the value that must be in the ROM for a Game Genie code
+	// to be applied, which is only checked if HasCompare is set.
+	Compare    byte
+	HasCompare bool
+
+	// Type is the first byte of a GameShark code, which selects the bank.
+	Type byte
+}
+
+func (c Cheat) String() string {
+	state := "on"
+	if !c.Enabled {
+		state = "off"
+	}
+	if c.Name == "" {
+		return fmt.Sprintf("%s (%s)", c.Code, state)
+	}
+	return fmt.Sprintf("%s (%s) %s", c.Code, state, c.Name)
+}
+
+// ErrInvalidCheat is returned when a cheat code cannot be parsed.
+var ErrInvalidCheat = errors.New("invalid cheat code")
+
+// ParseCheat parses a Game Genie code in the format ABC-DEF or ABC-DEF-GHI,
+// or a GameShark code in the format TTVVLLHH. The returned cheat is enabled.
+func ParseCheat(code string) (Cheat, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	digits := strings.ReplaceAll(code, "-", "")
+	value, err := strconv.ParseUint(digits, 16, 64)
+	if err != nil {
+		return Cheat{}, fmt.Errorf("%w %q: not hexadecimal", ErrInvalidCheat, code)
+	}
+	switch len(digits) {
+	case 6, 9:
+		return parseGameGenie(code, digits)
+	case 8:
+		if strings.Contains(code, "-") {
+			break
+		}
+		return parseGameShark(code, uint32(value))
+	}
+	return Cheat{}, fmt.Errorf("%w %q: expected ABC-DEF-GHI or TTVVLLHH", ErrInvalidCheat, code)
+}
+
+// Parse the digits of a Game Genie code.
+func parseGameGenie(code, digits string) (Cheat, error) {
+	d := make([]uint16, len(digits))
+	for i, c := range digits {
+		value, _ := strconv.ParseUint(string(c), 16, 8)
+		d[i] = uint16(value)
+	}
+	cheat := Cheat{
+		Code:    code,
+		Enabled: true,
+		Kind:    GameGenie,
+		Value:   byte(d[0]<<4 | d[1]),
+		Address: (d[5]<<12 | d[2]<<8 | d[3]<<4 | d[4]) ^ 0xF000,
+	}
+	if cheat.Address >= 0x8000 {
+		return Cheat{}, fmt.Errorf("%w %q: address %04X is not in the rom", ErrInvalidCheat, code, cheat.Address)
+	}
+	if len(d) == 9 {
+		// The compare value is rotated right by 2 and XORed, and the
+		// eighth digit is not used
+		compare := byte(d[6]<<4 | d[8])
+		cheat.Compare = (compare>>2 | compare<<6) ^ 0xBA
+		cheat.HasCompare = true
+	}
+	return cheat, nil
+}
+
+// Parse the value of a GameShark code.
+func parseGameShark(code string, value uint32) (Cheat, error) {
+	cheat := Cheat{
+		Code:    code,
+		Enabled: true,
+		Kind:    GameShark,
+		Type:    byte(value >> 24),
+		Value:   byte(value >> 16),
+		Address: uint16(value&0xFF)<<8 | uint16(value>>8&0xFF),
+	}
+	switch {
+	case cheat.Type == 0x00, cheat.Type == 0x01:
+	case cheat.Type >= 0x80 && cheat.Type <= 0x8F:
+	case cheat.Type >= 0x90 && cheat.Type <= 0x97:
+	default:
+		return Cheat{}, fmt.Errorf("%w %q: unsupported type %02X", ErrInvalidCheat, code, cheat.Type)
+	}
+	if cheat.Address < 0x8000 {
+		return Cheat{}, fmt.Errorf("%w %q: address %04X is not in ram", ErrInvalidCheat, code, cheat.Address)
+	}
+	return cheat, nil
+}
+
+// CheatEngine applies Game Genie and GameShark codes to a running Gameboy.
+type CheatEngine struct {
+	gb     *Gameboy
+	cheats []Cheat
+
+	// Enabled Game Genie codes, which are checked on every ROM read.
+	romCheats []Cheat
+}
+
+// Cheats returns the cheat engine for the Gameboy, creating one if there is
+// not one already.
+func (gb *Gameboy) Cheats() *CheatEngine {
+	if gb.cheats == nil {
+		gb.cheats = &CheatEngine{gb: gb}
+	}
+	return gb.cheats
+}
+
+// Add adds a cheat and returns its index.
+func (e *CheatEngine) Add(cheat Cheat) int {
+	e.cheats = append(e.cheats, cheat)
+	e.update()
+	return len(e.cheats) - 1
+}
+
+// AddCode parses a cheat code and adds it, enabled, with a name.
+func (e *CheatEngine) AddCode(code, name string) (int, error) {
+	cheat, err := ParseCheat(code)
+	if err != nil {
+		return 0, err
+	}
+	cheat.Name = name
+	return e.Add(cheat), nil
+}
+
+// Remove removes the cheat at an index in List.
+func (e *CheatEngine) Remove(index int) {
+	if index >= 0 && index < len(e.cheats) {
+		e.cheats = append(e.cheats[:index], e.cheats[index+1:]...)
+		e.update()
+	}
+}
+
+// SetEnabled enables or disables the cheat at an index in List.
+func (e *CheatEngine) SetEnabled(index int, enabled bool) {
+	if index >= 0 && index < len(e.cheats) {
+		e.cheats[index].Enabled = enabled
+		e.update()
+	}
+}
+
+// List returns the current cheats.
+func (e *CheatEngine) List() []Cheat {
+	return append([]Cheat(nil), e.cheats...)
+}
+
+// Update the list of Game Genie codes which are applied to ROM reads.
+func (e *CheatEngine) update() {
+	e.romCheats = e.romCheats[:0]
+	for _, cheat := range e.cheats {
+		if cheat.Enabled && cheat.Kind == GameGenie {
+			e.romCheats = append(e.romCheats, cheat)
+		}
+	}
+}
+
+// Apply the Game Genie codes to a value read from the cartridge ROM.
+func (e *CheatEngine) patchROM(address uint16, value byte) byte {
+	for _, cheat := range e.romCheats {
+		if cheat.Address == address && (!cheat.HasCompare || cheat.Compare == value) {
+			return cheat.Value
+		}
+	}
+	return value
+}
+
+// Write the values of the GameShark codes to RAM, which is done at the end
+// of every frame.
+func (e *CheatEngine) applyRAM() {
+	mem := e.gb.memory
+	for _, cheat := range e.cheats {
+		if !cheat.Enabled || cheat.Kind != GameShark {
+			continue
+		}
+		address := cheat.Address
+		switch {
+		case cheat.Type&0xF0 == 0x80 && address >= 0xA000 && address < 0xC000:
+			if mem.Cart.WriteRAMBank(int(cheat.Type&0xF), address, cheat.Value) {
+				continue
+			}
+		case cheat.Type&0xF0 == 0x90 && address >= 0xD000 && address < 0xE000:
+			bank := uint16(cheat.Type & 0x7)
+			if bank == 0 {
+				bank = 1
+			}
+			mem.WRAM[address-0xD000+bank*0x1000] = cheat.Value
+			continue
+		}
+		mem.Write(address, cheat.Value)
+	}
+}
+
+// LoadFile adds the cheats from a cheat file.
+func (e *CheatEngine) LoadFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cheats, err := ReadCheats(f)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", filename, err)
+	}
+	for _, cheat := range cheats {
+		e.Add(cheat)
+	}
+	return nil
+}
+
+// SaveFile writes the current cheats to a cheat file.
+func (e *CheatEngine) SaveFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := WriteCheats(f, e.cheats); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadCheats reads cheats from a cheat file. Each line of the file has a code
+// followed by an optional name, and the code is prefixed with a ! if it is
+// disabled. Empty lines and lines starting with # are ignored:
+//
+//	# Cheats for a game
+//	00A-17B-C49 Infinite lives
+//	!0105C0C0 Start on the last level
+func ReadCheats(r io.Reader) ([]Cheat, error) {
+	var cheats []Cheat
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		code, name, _ := strings.Cut(text, " ")
+		enabled := !strings.HasPrefix(code, "!")
+		cheat, err := ParseCheat(strings.TrimPrefix(code, "!"))
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+		cheat.Name = strings.TrimSpace(name)
+		cheat.Enabled = enabled
+		cheats = append(cheats, cheat)
+	}
+	return cheats, scanner.Err()
+}
+
+// WriteCheats writes cheats in the format read by ReadCheats.
+func WriteCheats(w io.Writer, cheats []Cheat) error {
+	for _, cheat := range cheats {
+		code := cheat.Code
+		if !cheat.Enabled {
+			code = "!" + code
+		}
+		line := strings.TrimSpace(code + " " + cheat.Name)
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
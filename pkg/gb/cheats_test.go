@@ -0,0 +1,146 @@
+package gb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Humpheh/goboy/pkg/cart"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCheat(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected Cheat
+	}{
+		{"00A-17B-C49", Cheat{Kind: GameGenie, Address: 0x4A17, Value: 0x00, Compare: 0xC8, HasCompare: true}},
+		{"3ea-17b", Cheat{Kind: GameGenie, Address: 0x4A17, Value: 0x3E}},
+		{"0105C0C0", Cheat{Kind: GameShark, Type: 0x01, Address: 0xC0C0, Value: 0x05}},
+		{"93FF10D0", Cheat{Kind: GameShark, Type: 0x93, Address: 0xD010, Value: 0xFF}},
+	}
+	for _, test := range tests {
+		t.Run(test.code, func(t *testing.T) {
+			cheat, err := ParseCheat(test.code)
+			require.NoError(t, err)
+			test.expected.Code = strings.ToUpper(test.code)
+			test.expected.Enabled = true
+			assert.Equal(t, test.expected, cheat)
+		})
+	}
+
+	for _, code := range []string{"", "XYZ-123-456", "12345", "00A-170", "01050040", "5505C0C0", "0105-C0C0"} {
+		_, err := ParseCheat(code)
+		assert.ErrorIs(t, err, ErrInvalidCheat, "code %q", code)
+	}
+}
+
+func TestCheats_GameGenie(t *testing.T) {
+	rom := newTestROM(nil)
+	rom[0x4A17] = 0xC8
+	rom[0x4A18] = 0x12
+	cart.FixHeader(rom)
+	gb, err := NewFromBytes(rom)
+	require.NoError(t, err)
+
+	cheats := gb.Cheats()
+	_, err = cheats.AddCode("00A-17B-C49", "compare matches")
+	require.NoError(t, err)
+	_, err = cheats.AddCode("00A-18B-C49", "compare does not match")
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x00), gb.memory.Read(0x4A17))
+	assert.Equal(t, byte(0x12), gb.memory.Read(0x4A18))
+
+	cheats.SetEnabled(0, false)
+	assert.Equal(t, byte(0xC8), gb.memory.Read(0x4A17))
+	cheats.SetEnabled(0, true)
+	cheats.Remove(0)
+	assert.Equal(t, byte(0xC8), gb.memory.Read(0x4A17))
+}
+
+func TestCheats_GameShark(t *testing.T) {
+	// MBC5+RAM cartridge with 32KB of RAM
+	rom := newTestROM([]byte{0x18, 0xFE})
+	rom[0x143] = 0x80
+	rom[0x147] = 0x1A
+	rom[0x149] = 0x03
+	cart.FixHeader(rom)
+	gb, err := NewFromBytes(rom, WithCGBEnabled(), WithCheats(
+		mustParseCheat(t, "0105C0C0"),
+		mustParseCheat(t, "9342F0DF"),
+		mustParseCheat(t, "82990AA0"),
+	))
+	require.NoError(t, err)
+
+	gb.Update()
+	assert.Equal(t, byte(0x05), gb.memory.Read(0xC0C0))
+	assert.Equal(t, byte(0x42), gb.memory.WRAM[0x3000+0xFF0], "should write to WRAM bank 3")
+	assert.Equal(t, byte(0x00), gb.memory.Read(0xDFF0), "should not write to the mapped WRAM bank")
+	assert.Equal(t, byte(0x99), gb.GetLoadedCart().GetSaveData()[0x4000+0xA], "should write to cart RAM bank 2")
+
+	// The value is written again every frame
+	gb.memory.Write(0xC0C0, 0x00)
+	gb.Update()
+	assert.Equal(t, byte(0x05), gb.memory.Read(0xC0C0))
+}
+
+func mustParseCheat(t *testing.T, code string) Cheat {
+	cheat, err := ParseCheat(code)
+	require.NoError(t, err)
+	return cheat
+}
+
+func TestReadCheats(t *testing.T) {
+	file := "# Comment\n\n00A-17B-C49 Infinite lives\n!0105C0C0  Level select \n"
+	cheats, err := ReadCheats(strings.NewReader(file))
+	require.NoError(t, err)
+	require.Len(t, cheats, 2)
+	assert.Equal(t, "Infinite lives", cheats[0].Name)
+	assert.True(t, cheats[0].Enabled)
+	assert.Equal(t, "Level select", cheats[1].Name)
+	assert.False(t, cheats[1].Enabled)
+
+	var out strings.Builder
+	require.NoError(t, WriteCheats(&out, cheats))
+	assert.Equal(t, "00A-17B-C49 Infinite lives\n!0105C0C0 Level select\n", out.String())
+
+	_, err = ReadCheats(strings.NewReader("00A-17B-C49\nbad code\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestNew_CheatFile(t *testing.T) {
+	dir := t.TempDir()
+	romFile := filepath.Join(dir, "game.gb")
+	require.NoError(t, os.WriteFile(romFile, newTestROM(nil), 0644))
+	require.NoError(t, os.WriteFile(romFile+".cheats", []byte("0105C0C0 Lives\n"), 0644))
+
+	gb, err := New(romFile, WithSaveStore(&testSaveStore{}))
+	require.NoError(t, err)
+	require.Len(t, gb.Cheats().List(), 1)
+	assert.Equal(t, "Lives", gb.Cheats().List()[0].Name)
+
+	// A cheat file given in the options is loaded instead
+	other := filepath.Join(dir, "other.cheats")
+	require.NoError(t, os.WriteFile(other, []byte("!00A-17B-C49\n"), 0644))
+	gb, err = New(romFile, WithSaveStore(&testSaveStore{}), WithCheatFile(other))
+	require.NoError(t, err)
+	require.Len(t, gb.Cheats().List(), 1)
+	assert.Equal(t, "00A-17B-C49", gb.Cheats().List()[0].Code)
+}
+
+func TestNewFromBytes_CheatFile(t *testing.T) {
+	cheatFile := filepath.Join(t.TempDir(), "game.cheats")
+	require.NoError(t, os.WriteFile(cheatFile, []byte("0105C0C0 Lives\n"), 0644))
+
+	gb, err := NewFromBytes(newTestROM(nil), WithCheatFile(cheatFile))
+	require.NoError(t, err)
+	require.Len(t, gb.Cheats().List(), 1)
+	assert.Equal(t, "Lives", gb.Cheats().List()[0].Name)
+
+	// A bad cheat file fails to load the rom
+	require.NoError(t, os.WriteFile(cheatFile, []byte("bad code\n"), 0644))
+	_, err = NewFromBytes(newTestROM(nil), WithCheatFile(cheatFile))
+	assert.ErrorContains(t, err, "failed to load cheats")
+}
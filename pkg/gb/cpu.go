@@ -62,8 +62,6 @@ type CPU struct {
 
 	PC uint16
 	SP register
-
-	Divider int
 }
 
 // Init CPU and its registers to the initial values.
@@ -8,6 +8,8 @@ import (
 	"os"
 	"strconv"
 	"strings"
+
+	"github.com/Humpheh/goboy/pkg/disasm"
 )
 
 // LogOpcode is a debug function to log the the current state of the gameboys CPU and next memory.
@@ -15,8 +17,8 @@ func LogOpcode(gb *Gameboy, short bool) {
 	pc := gb.cpu.PC
 	opcode := gb.memory.Read(pc)
 
-	next := gb.memory.Read(pc + 1)
-	fmt.Printf("[%0#2x]: %3v %-20v %0#4x", opcode, gb.scanlineCounter, GetOpcodeName(opcode, next), pc)
+	ins := disasm.Decode(gb.memory.Read, pc)
+	fmt.Printf("[%0#2x]: %3v %-20v %0#4x", opcode, gb.ppu.Dot, ins, pc)
 
 	if !short {
 		fmt.Printf("  [[")
@@ -0,0 +1,438 @@
+package gb
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// AnyBank can be used as the bank of a breakpoint to break at the address
+// regardless of which ROM bank is currently mapped.
+const AnyBank = -1
+
+// Breakpoint stops execution when the PC reaches an address.
+type Breakpoint struct {
+	// Address of the instruction to stop at.
+	Address uint16
+	// Bank is the ROM bank the address must be mapped to for the breakpoint
+	// to be hit. This is only used for addresses in the cartridge ROM, and
+	// can be set to AnyBank to break on any bank.
+	Bank int
+}
+
+func (bp Breakpoint) String() string {
+	if bp.Bank == AnyBank || bp.Address >= 0x8000 {
+		return fmt.Sprintf("%04X", bp.Address)
+	}
+	return fmt.Sprintf("%02X:%04X", bp.Bank, bp.Address)
+}
+
+// WatchKind is the type of memory access a watchpoint stops on.
+type WatchKind byte
+
+const (
+	// WatchRead stops when the memory is read by the CPU.
+	WatchRead WatchKind = 1 << iota
+	// WatchWrite stops when the memory is written to by the CPU.
+	WatchWrite
+	// WatchReadWrite stops when the memory is read or written by the CPU.
+	WatchReadWrite = WatchRead | WatchWrite
+)
+
+// Watchpoint stops execution when the CPU accesses a range of memory.
+type Watchpoint struct {
+	// Start and End are the inclusive range of addresses to watch.
+	Start, End uint16
+	// Kind is the type of access to stop on.
+	Kind WatchKind
+}
+
+func (wp Watchpoint) String() string {
+	kind := map[WatchKind]string{WatchRead: "r", WatchWrite: "w", WatchReadWrite: "rw"}[wp.Kind]
+	if wp.Start == wp.End {
+		return fmt.Sprintf("%04X (%s)", wp.Start, kind)
+	}
+	return fmt.Sprintf("%04X-%04X (%s)", wp.Start, wp.End, kind)
+}
+
+// StopReason is the reason the debugger stopped execution.
+type StopReason byte
+
+const (
+	// StopStep is when a step has completed.
+	StopStep StopReason = iota
+	// StopBreakpoint is when a breakpoint was reached.
+	StopBreakpoint
+	// StopWatchpoint is when a watched memory address was accessed.
+	StopWatchpoint
+	// StopFrame is when the requested number of frames have been run.
+	StopFrame
+	// StopInterrupted is when execution was interrupted by Interrupt.
+	StopInterrupted
+)
+
+// StopEvent describes why and where the debugger stopped execution.
+type StopEvent struct {
+	Reason StopReason
+	// PC is the address of the next instruction to be executed.
+	PC uint16
+
+	// Breakpoint which was hit if the reason was StopBreakpoint.
+	Breakpoint Breakpoint
+
+	// Watchpoint details if the reason was StopWatchpoint.
+	Watchpoint Watchpoint
+	Access     WatchKind
+	Address    uint16
+	Value      byte
+}
+
+func (e StopEvent) String() string {
+	switch e.Reason {
+	case StopBreakpoint:
+		return fmt.Sprintf("breakpoint %v hit", e.Breakpoint)
+	case StopWatchpoint:
+		access := "read"
+		if e.Access == WatchWrite {
+			access = "write"
+		}
+		return fmt.Sprintf("watchpoint %v: %s %02X at %04X, now at %04X", e.Watchpoint, access, e.Value, e.Address, e.PC)
+	case StopFrame:
+		return fmt.Sprintf("frame completed at %04X", e.PC)
+	case StopInterrupted:
+		return fmt.Sprintf("interrupted at %04X", e.PC)
+	default:
+		return fmt.Sprintf("stepped to %04X", e.PC)
+	}
+}
+
+// Registers contains the values of the CPU registers.
+type Registers struct {
+	A, F, B, C, D, E, H, L byte
+	SP, PC                 uint16
+	// IME is the interrupt master enable flag.
+	IME bool
+	// Halted is true if the CPU is halted waiting for an interrupt.
+	Halted bool
+}
+
+func (r Registers) String() string {
+	return fmt.Sprintf(
+		"AF=%02X%02X BC=%02X%02X DE=%02X%02X HL=%02X%02X SP=%04X PC=%04X IME=%v HALT=%v",
+		r.A, r.F, r.B, r.C, r.D, r.E, r.H, r.L, r.SP, r.PC, r.IME, r.Halted,
+	)
+}
+
+// Debugger provides breakpoints, watchpoints, stepping and inspection of
+// the Gameboy state. While the debugger is stopped, Update will not advance
+// the emulation until Resume is called.
+type Debugger struct {
+	gb *Gameboy
+
+	breakpoints []Breakpoint
+	watchpoints []Watchpoint
+
+	// If the debugger has stopped the execution and the last stop event.
+	stopped   bool
+	lastEvent StopEvent
+
+	// Skip the breakpoint check on the next instruction, used when
+	// resuming from a breakpoint.
+	skipBreakpoint bool
+
+	// If the CPU is currently executing an instruction, and the
+	// watchpoint which was hit during it.
+	executing bool
+	watchHit  *StopEvent
+
+	interrupted atomic.Bool
+}
+
+// Debugger returns the debugger for the Gameboy, attaching one if the
+// Gameboy is not already being debugged.
+func (gb *Gameboy) Debugger() *Debugger {
+	if gb.debugger == nil {
+		gb.debugger = &Debugger{gb: gb}
+	}
+	return gb.debugger
+}
+
+// AddBreakpoint adds a breakpoint to the debugger.
+func (d *Debugger) AddBreakpoint(bp Breakpoint) {
+	d.breakpoints = append(d.breakpoints, bp)
+}
+
+// RemoveBreakpoint removes a breakpoint at an index in Breakpoints.
+func (d *Debugger) RemoveBreakpoint(index int) {
+	if index >= 0 && index < len(d.breakpoints) {
+		d.breakpoints = append(d.breakpoints[:index], d.breakpoints[index+1:]...)
+	}
+}
+
+// Breakpoints returns the current breakpoints.
+func (d *Debugger) Breakpoints() []Breakpoint {
+	return append([]Breakpoint(nil), d.breakpoints...)
+}
+
+// AddWatchpoint adds a watchpoint to the debugger.
+func (d *Debugger) AddWatchpoint(wp Watchpoint) {
+	if wp.End < wp.Start {
+		wp.End = wp.Start
+	}
+	d.watchpoints = append(d.watchpoints, wp)
+}
+
+// RemoveWatchpoint removes a watchpoint at an index in Watchpoints.
+func (d *Debugger) RemoveWatchpoint(index int) {
+	if index >= 0 && index < len(d.watchpoints) {
+		d.watchpoints = append(d.watchpoints[:index], d.watchpoints[index+1:]...)
+	}
+}
+
+// Watchpoints returns the current watchpoints.
+func (d *Debugger) Watchpoints() []Watchpoint {
+	return append([]Watchpoint(nil), d.watchpoints...)
+}
+
+// Stopped returns if the debugger has stopped the execution, and the event
+// which caused it to stop.
+func (d *Debugger) Stopped() (bool, StopEvent) {
+	return d.stopped, d.lastEvent
+}
+
+// Resume allows Update to continue the emulation after the debugger stopped.
+func (d *Debugger) Resume() {
+	d.stopped = false
+	d.interrupted.Store(false)
+}
+
+// Interrupt stops a running Continue or RunFrames at the next instruction. If
+// nothing is running then the next run will stop after one instruction. It is
+// safe to call from another goroutine.
+func (d *Debugger) Interrupt() {
+	d.interrupted.Store(true)
+}
+
+// Step executes a single instruction, stepping into any calls.
+func (d *Debugger) Step() StopEvent {
+	return d.run(func() bool { return true }, nil)
+}
+
+// StepOver executes a single instruction. If the instruction is a call, the
+// execution continues until the call has returned.
+func (d *Debugger) StepOver() StopEvent {
+	pc := d.gb.cpu.PC
+	opcode := d.gb.memory.Read(pc)
+
+	var next uint16
+	switch opcode {
+	case 0xCD, 0xC4, 0xCC, 0xD4, 0xDC:
+		// CALL nn and CALL cc,nn
+		next = pc + 3
+	case 0xC7, 0xCF, 0xD7, 0xDF, 0xE7, 0xEF, 0xF7, 0xFF:
+		// RST n
+		next = pc + 1
+	default:
+		return d.Step()
+	}
+	sp := d.gb.cpu.SP.HiLo()
+	return d.run(func() bool {
+		return d.gb.cpu.PC == next && d.gb.cpu.SP.HiLo() >= sp
+	}, nil)
+}
+
+// StepOut continues the execution until the current function returns.
+func (d *Debugger) StepOut() StopEvent {
+	sp := d.gb.cpu.SP.HiLo()
+	var returned bool
+	return d.run(func() bool {
+		return returned && d.gb.cpu.SP.HiLo() > sp
+	}, func(opcode byte) {
+		switch opcode {
+		case 0xC9, 0xD9, 0xC0, 0xC8, 0xD0, 0xD8:
+			// RET, RETI and RET cc
+			returned = true
+		default:
+			returned = false
+		}
+	})
+}
+
+// Continue runs the emulation until a breakpoint or watchpoint is hit, or
+// the debugger is interrupted.
+func (d *Debugger) Continue() StopEvent {
+	return d.run(func() bool { return false }, nil)
+}
+
+// RunFrames runs the emulation until a number of frames have completed, or
+// until a breakpoint or watchpoint is hit.
+func (d *Debugger) RunFrames(frames int) StopEvent {
+	target := d.gb.frames + frames
+	event := d.run(func() bool { return d.gb.frames >= target }, nil)
+	if event.Reason == StopStep {
+		event.Reason = StopFrame
+	}
+	return event
+}
+
+// Frame returns the number of frames which have been completed.
+func (d *Debugger) Frame() int {
+	return d.gb.frames
+}
+
+// Run instructions until done returns true after an instruction, or a
+// breakpoint or watchpoint is hit. If observe is not nil it is called with
+// the opcode of each instruction before it is executed.
+func (d *Debugger) run(done func() bool, observe func(opcode byte)) StopEvent {
+	d.stopped = false
+	first := true
+	for {
+		if !first && d.checkBreakpoint() {
+			return d.lastEvent
+		}
+		first = false
+		d.skipBreakpoint = false
+
+		if observe != nil {
+			observe(d.gb.memory.Read(d.gb.cpu.PC))
+		}
+		d.gb.frameStep()
+
+		if d.checkWatchpoints() {
+			return d.lastEvent
+		}
+		if done() {
+			return d.stop(StopEvent{Reason: StopStep})
+		}
+		if d.interrupted.Swap(false) {
+			return d.stop(StopEvent{Reason: StopInterrupted})
+		}
+	}
+}
+
+// Stop the execution with an event.
+func (d *Debugger) stop(event StopEvent) StopEvent {
+	event.PC = d.gb.cpu.PC
+	d.stopped = true
+	d.lastEvent = event
+	return event
+}
+
+// Returns if the debugger is attached and has stopped the execution.
+func (d *Debugger) isStopped() bool {
+	return d != nil && d.stopped
+}
+
+// Set if the CPU is executing an instruction, so that memory accesses are
+// checked against the watchpoints.
+func (d *Debugger) setExecuting(executing bool) {
+	if d != nil {
+		d.executing = executing
+	}
+}
+
+// Check if there is a breakpoint at the current PC. If there is, then
+// the execution will be stopped and true is returned.
+func (d *Debugger) checkBreakpoint() bool {
+	if d.skipBreakpoint {
+		d.skipBreakpoint = false
+		return false
+	}
+	pc := d.gb.cpu.PC
+	for _, bp := range d.breakpoints {
+		if bp.Address != pc {
+			continue
+		}
+		if bp.Bank != AnyBank && pc < 0x8000 && bp.Bank != d.gb.memory.Cart.ROMBank(pc) {
+			continue
+		}
+		d.stop(StopEvent{Reason: StopBreakpoint, Breakpoint: bp})
+		d.skipBreakpoint = true
+		return true
+	}
+	return false
+}
+
+// Check if a watchpoint was hit during the last instruction. If one was,
+// then the execution will be stopped and true is returned.
+func (d *Debugger) checkWatchpoints() bool {
+	if d.watchHit == nil {
+		return false
+	}
+	d.stop(*d.watchHit)
+	d.watchHit = nil
+	return true
+}
+
+// Called by the memory when the CPU accesses an address.
+func (d *Debugger) onAccess(kind WatchKind, address uint16, value byte) {
+	if !d.executing || d.watchHit != nil {
+		return
+	}
+	for _, wp := range d.watchpoints {
+		if wp.Kind&kind != 0 && address >= wp.Start && address <= wp.End {
+			d.watchHit = &StopEvent{
+				Reason:     StopWatchpoint,
+				Watchpoint: wp,
+				Access:     kind,
+				Address:    address,
+				Value:      value,
+			}
+			return
+		}
+	}
+}
+
+// Registers returns the current values of the CPU registers.
+func (d *Debugger) Registers() Registers {
+	cpu := d.gb.cpu
+	return Registers{
+		A: cpu.AF.Hi(), F: cpu.AF.Lo(),
+		B: cpu.BC.Hi(), C: cpu.BC.Lo(),
+		D: cpu.DE.Hi(), E: cpu.DE.Lo(),
+		H: cpu.HL.Hi(), L: cpu.HL.Lo(),
+		SP:     cpu.SP.HiLo(),
+		PC:     cpu.PC,
+		IME:    d.gb.interruptsOn,
+		Halted: d.gb.halted,
+	}
+}
+
+// SetRegisters sets the values of the CPU registers.
+func (d *Debugger) SetRegisters(regs Registers) {
+	cpu := d.gb.cpu
+	cpu.AF.Set(uint16(regs.A)<<8 | uint16(regs.F))
+	cpu.BC.Set(uint16(regs.B)<<8 | uint16(regs.C))
+	cpu.DE.Set(uint16(regs.D)<<8 | uint16(regs.E))
+	cpu.HL.Set(uint16(regs.H)<<8 | uint16(regs.L))
+	cpu.SP.Set(regs.SP)
+	cpu.PC = regs.PC
+	d.gb.interruptsOn = regs.IME
+	d.gb.halted = regs.Halted
+}
+
+// ReadMemory reads a range of memory as seen by the CPU. Reading through the
+// debugger does not trigger watchpoints. Returns nil if the length is not
+// positive.
+func (d *Debugger) ReadMemory(address uint16, length int) []byte {
+	if length <= 0 {
+		return nil
+	}
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = d.gb.memory.Read(address + uint16(i))
+	}
+	return data
+}
+
+// WriteMemory writes data to memory as if it were written by the CPU. Writing
+// through the debugger does not trigger watchpoints.
+func (d *Debugger) WriteMemory(address uint16, data []byte) {
+	for i, value := range data {
+		d.gb.memory.Write(address+uint16(i), value)
+	}
+}
+
+// ROMBank returns the ROM bank which is currently mapped to an address.
+func (d *Debugger) ROMBank(address uint16) int {
+	return d.gb.memory.Cart.ROMBank(address)
+}
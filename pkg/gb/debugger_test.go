@@ -0,0 +1,114 @@
+package gb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDebugGameboy(t *testing.T) (*Gameboy, *Debugger) {
+	gb, err := New("./../../roms/blargg/cpu_instrs.gb")
+	require.NoError(t, err, "error in init gb %v", err)
+	return gb, gb.Debugger()
+}
+
+func TestDebugger_Breakpoint(t *testing.T) {
+	// Record the path of the program counter
+	_, d := newDebugGameboy(t)
+	var path []uint16
+	for i := 0; i < 100; i++ {
+		path = append(path, d.Step().PC)
+	}
+
+	gb, d := newDebugGameboy(t)
+	d.AddBreakpoint(Breakpoint{Address: path[80], Bank: AnyBank})
+	event := d.Continue()
+	assert.Equal(t, StopBreakpoint, event.Reason)
+	assert.Equal(t, path[80], event.PC)
+	assert.Equal(t, path[80], d.Registers().PC)
+
+	// Update does not run while the debugger is stopped
+	assert.Equal(t, 0, gb.Update())
+	d.Resume()
+	assert.NotEqual(t, 0, gb.Update())
+}
+
+func TestDebugger_BreakpointBank(t *testing.T) {
+	// Address of print_load_font in bank 1 of the test rom
+	const address = 0x4C0C
+	rom := "./../../roms/mooneye/acceptance/halt_ime0_ei.gb"
+
+	gb, err := New(rom)
+	require.NoError(t, err, "error in init gb %v", err)
+	d := gb.Debugger()
+	d.AddBreakpoint(Breakpoint{Address: address, Bank: 2})
+	event := d.RunFrames(100)
+	assert.Equal(t, StopFrame, event.Reason, "breakpoint in the wrong bank was hit")
+	assert.Equal(t, 100, d.Frame())
+	assert.Equal(t, 0, gb.frameCycles)
+
+	gb, err = New(rom)
+	require.NoError(t, err, "error in init gb %v", err)
+	d = gb.Debugger()
+	d.AddBreakpoint(Breakpoint{Address: address, Bank: 1})
+	event = d.RunFrames(100)
+	assert.Equal(t, StopBreakpoint, event.Reason)
+	assert.Equal(t, uint16(address), event.PC)
+}
+
+func TestDebugger_Watchpoint(t *testing.T) {
+	_, d := newDebugGameboy(t)
+	// Serial transfer data is written when the test prints
+	d.AddWatchpoint(Watchpoint{Start: 0xFF01, End: 0xFF01, Kind: WatchWrite})
+	event := d.Continue()
+	require.Equal(t, StopWatchpoint, event.Reason)
+	assert.Equal(t, uint16(0xFF01), event.Address)
+	assert.Equal(t, WatchWrite, event.Access)
+	assert.Equal(t, event.Value, d.ReadMemory(0xFF01, 1)[0])
+}
+
+func TestDebugger_StepOver(t *testing.T) {
+	_, d := newDebugGameboy(t)
+	for i := 0; i < 1000 && d.ReadMemory(d.Registers().PC, 1)[0] != 0xCD; i++ {
+		d.Step()
+	}
+	pc := d.Registers().PC
+	sp := d.Registers().SP
+	require.Equal(t, byte(0xCD), d.ReadMemory(pc, 1)[0], "did not find a CALL instruction")
+
+	event := d.StepOver()
+	assert.Equal(t, pc+3, event.PC)
+	assert.Equal(t, sp, d.Registers().SP)
+}
+
+func TestDebugger_StepOut(t *testing.T) {
+	_, d := newDebugGameboy(t)
+	for i := 0; i < 1000 && d.ReadMemory(d.Registers().PC, 1)[0] != 0xCD; i++ {
+		d.Step()
+	}
+	pc := d.Registers().PC
+	sp := d.Registers().SP
+	d.Step() // Step into the call
+
+	event := d.StepOut()
+	assert.Equal(t, pc+3, event.PC)
+	assert.Equal(t, sp, d.Registers().SP)
+}
+
+func TestDebugger_SetRegisters(t *testing.T) {
+	_, d := newDebugGameboy(t)
+	regs := d.Registers()
+	regs.B = 0x12
+	regs.F = 0xFF
+	d.SetRegisters(regs)
+	assert.Equal(t, byte(0x12), d.Registers().B)
+	assert.Equal(t, byte(0xF0), d.Registers().F, "lower bits of F cannot be set")
+}
+
+func TestDebugger_ReadMemory(t *testing.T) {
+	_, d := newDebugGameboy(t)
+	assert.Equal(t, []byte{0x00, 0xC3}, d.ReadMemory(0x0100, 2))
+	assert.Nil(t, d.ReadMemory(0x0100, 0))
+	assert.Nil(t, d.ReadMemory(0x0100, -1))
+}
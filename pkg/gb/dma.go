@@ -0,0 +1,192 @@
+package gb
+
+// Number of bytes copied to OAM by a DMA transfer.
+const oamDMALength = 0xA0
+
+// oamDMA is the state of the OAM DMA transfer, which copies 0xA0 bytes to OAM
+// at one byte per machine cycle while the CPU continues to run. While the
+// transfer is running the CPU cannot access OAM or the bus being copied from.
+type oamDMA struct {
+	// If a transfer is running, its source address and the number of bytes
+	// which have been copied so far.
+	Active bool
+	Source uint16
+	Copied int
+
+	// If a transfer has been requested by writing to FF46, the source address
+	// and the number of machine cycles until it starts. A transfer which is
+	// already running continues until the new transfer starts.
+	Requested       bool
+	RequestedSource uint16
+	Delay           int
+}
+
+// Write to the DMA register to request a transfer from value*0x100. The
+// transfer starts after a machine cycle of setup.
+func (gb *Gameboy) writeOAMDMA(value byte) {
+	gb.memory.HighRAM[0x46] = value
+	gb.oamDMA.Requested = true
+	gb.oamDMA.RequestedSource = uint16(value) << 8
+	gb.oamDMA.Delay = 2
+}
+
+// Advance the OAM DMA by a number of clock cycles.
+func (gb *Gameboy) updateOAMDMA(cycles int) {
+	if !gb.oamDMA.Active && !gb.oamDMA.Requested {
+		return
+	}
+	for i := 0; i < cycles; i += 4 {
+		gb.tickOAMDMA()
+	}
+}
+
+// Advance the OAM DMA by a single machine cycle, copying the next byte. The
+// first byte is copied on the cycle after the transfer starts.
+func (gb *Gameboy) tickOAMDMA() {
+	dma := &gb.oamDMA
+	if dma.Requested {
+		dma.Delay--
+		if dma.Delay == 0 {
+			dma.Requested = false
+			dma.Active = true
+			dma.Source = dma.RequestedSource
+			dma.Copied = 0
+			return
+		}
+	}
+	if !dma.Active {
+		return
+	}
+
+	address := dma.Source + uint16(dma.Copied)
+	if address >= 0xE000 {
+		// Sources above the WRAM read from the WRAM echo
+		address -= 0x2000
+	}
+	gb.memory.OAM[dma.Copied] = gb.memory.read(address)
+	dma.Copied++
+	if dma.Copied == oamDMALength {
+		dma.Active = false
+	}
+}
+
+// Check if the CPU is blocked from accessing an address by the OAM DMA. OAM
+// is always blocked, and otherwise only the bus which the transfer is reading
+// from is blocked: either VRAM or the external bus for the cartridge and WRAM.
+func (gb *Gameboy) oamDMABlocked(address uint16) bool {
+	if !gb.oamDMA.Active || address >= 0xFF00 {
+		return false
+	}
+	if address >= 0xFE00 {
+		return true
+	}
+	return isVRAMBus(gb.oamDMA.Source) == isVRAMBus(address)
+}
+
+// Check if an address is accessed through the VRAM bus.
+func isVRAMBus(address uint16) bool {
+	return address >= 0x8000 && address < 0xA000
+}
+
+// Number of bytes copied by each block of a CGB VRAM DMA transfer, and the
+// number of clock cycles at normal speed the CPU is paused for each block.
+const (
+	hdmaBlockLength = 0x10
+	hdmaBlockCycles = 32
+)
+
+// hdma is the state of the CGB VRAM DMA, which copies data into VRAM either
+// all at once (general purpose DMA) or one block in each H-Blank (H-Blank
+// DMA). The CPU is paused while each block is copied.
+type hdma struct {
+	// If an H-Blank DMA is running, and the number of blocks remaining
+	// minus one.
+	Active bool
+	Length byte
+
+	// Number of clock cycles until the CPU resumes after copying data.
+	Stall int
+}
+
+// Write to the HDMA5 register to start a transfer of (value&0x7F+1)*0x10
+// bytes. Bit 7 selects an H-Blank DMA, and writing with bit 7 clear while an
+// H-Blank DMA is running stops it.
+func (gb *Gameboy) writeHDMA(value byte) {
+	dma := &gb.hdma
+	if dma.Active && !bitTest(value, 7) {
+		dma.Active = false
+		gb.memory.HighRAM[0x55] = dma.Length | 0x80
+		return
+	}
+
+	if !bitTest(value, 7) {
+		// General purpose DMA copies everything while the CPU is paused
+		for i := 0; i <= int(value&0x7F); i++ {
+			dma.Stall += hdmaBlockCycles * gb.getSpeed()
+			if !gb.copyHDMABlock() {
+				break
+			}
+		}
+		gb.memory.HighRAM[0x55] = 0xFF
+		return
+	}
+
+	dma.Active = true
+	dma.Length = value & 0x7F
+	gb.memory.HighRAM[0x55] = dma.Length
+	if gb.isLCDEnabled() && gb.ppu.Mode == modeHBlank {
+		// Starting during H-Blank copies the first block straight away
+		gb.doHDMATransfer()
+	}
+}
+
+// Copy the next block of an H-Blank DMA at the start of H-Blank.
+func (gb *Gameboy) doHDMATransfer() {
+	dma := &gb.hdma
+	if !dma.Active {
+		return
+	}
+	if !gb.copyHDMABlock() || dma.Length == 0 {
+		// DMA has finished
+		dma.Active = false
+		gb.memory.HighRAM[0x55] = 0xFF
+	} else {
+		dma.Length--
+		gb.memory.HighRAM[0x55] = dma.Length
+	}
+	dma.Stall += hdmaBlockCycles * gb.getSpeed()
+}
+
+// Copy a block of data from the source to the destination registers into the
+// current VRAM bank and advance the registers. Returns false if the
+// destination has reached the end of VRAM, which ends the transfer early.
+func (gb *Gameboy) copyHDMABlock() bool {
+	mem := gb.memory
+	source := (uint16(mem.HighRAM[0x51])<<8 | uint16(mem.HighRAM[0x52])) & 0xFFF0
+	destination := (uint16(mem.HighRAM[0x53])<<8 | uint16(mem.HighRAM[0x54])) & 0x1FF0
+
+	bankOffset := uint16(mem.VRAMBank) * 0x2000
+	for i := uint16(0); i < hdmaBlockLength; i++ {
+		mem.VRAM[destination+i+bankOffset] = gb.readHDMASource(source + i)
+	}
+	source += hdmaBlockLength
+	destination += hdmaBlockLength
+
+	mem.HighRAM[0x51] = byte(source >> 8)
+	mem.HighRAM[0x52] = byte(source)
+	mem.HighRAM[0x53] = byte(destination >> 8)
+	mem.HighRAM[0x54] = byte(destination)
+	return destination < 0x2000
+}
+
+// Read a byte from the source of a VRAM DMA. VRAM cannot be used as the
+// source, and sources above 0xE000 read from cartridge RAM.
+func (gb *Gameboy) readHDMASource(address uint16) byte {
+	switch {
+	case address >= 0x8000 && address < 0xA000:
+		return 0xFF
+	case address >= 0xE000:
+		return gb.memory.read(address - 0x4000)
+	}
+	return gb.memory.read(address)
+}
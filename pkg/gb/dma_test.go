@@ -0,0 +1,208 @@
+package gb
+
+import (
+	"testing"
+
+	"github.com/Humpheh/goboy/pkg/cart"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Fill a 0x100 byte page of WRAM with its offset plus a value.
+func fillPage(gb *Gameboy, page uint16, add byte) {
+	for i := uint16(0); i < 0x100; i++ {
+		gb.memory.Write(page+i, byte(i)+add)
+	}
+}
+
+func TestOAMDMA_Timing(t *testing.T) {
+	gb := newProgramGameboy(t, nil, nil)
+	fillPage(gb, 0xC100, 1)
+	gb.memory.Write(0xFF46, 0xC1)
+	assert.Equal(t, byte(0xC1), gb.memory.Read(0xFF46))
+
+	gb.tickOAMDMA()
+	assert.False(t, gb.oamDMA.Active, "transfer should not start during setup")
+	assert.Equal(t, byte(2), gb.memory.Read(0xC101), "memory should be accessible during setup")
+
+	gb.tickOAMDMA()
+	assert.True(t, gb.oamDMA.Active)
+	assert.Equal(t, byte(0), gb.memory.OAM[0], "first byte should be copied the cycle after starting")
+
+	gb.tickOAMDMA()
+	assert.Equal(t, byte(1), gb.memory.OAM[0])
+	assert.Equal(t, byte(0), gb.memory.OAM[1], "one byte should be copied each cycle")
+
+	for i := 0; i < oamDMALength-1; i++ {
+		gb.tickOAMDMA()
+	}
+	assert.False(t, gb.oamDMA.Active, "transfer should take 160 cycles")
+	for i := 0; i < oamDMALength; i++ {
+		assert.Equal(t, byte(i+1), gb.memory.OAM[i])
+	}
+}
+
+func TestOAMDMA_BusBlocked(t *testing.T) {
+	gb := newProgramGameboy(t, nil, nil)
+	fillPage(gb, 0xC100, 1)
+	gb.memory.Write(0xFF46, 0xC1)
+	gb.updateOAMDMA(8)
+
+	assert.Equal(t, byte(0xFF), gb.memory.Read(0xC101), "WRAM should not be readable")
+	assert.Equal(t, byte(0xFF), gb.memory.Read(0xFE00), "OAM should not be readable")
+	gb.memory.Write(0xC101, 0x55)
+	gb.memory.Write(0xFF80, 0x66)
+	assert.Equal(t, byte(0x66), gb.memory.Read(0xFF80), "HRAM should be accessible")
+
+	gb.updateOAMDMA(oamDMALength * 4)
+	assert.Equal(t, byte(2), gb.memory.Read(0xC101), "writes should be ignored during the transfer")
+}
+
+func TestOAMDMA_VRAMSource(t *testing.T) {
+	gb := newProgramGameboy(t, nil, nil)
+	gb.memory.Write(0xC101, 0x12)
+	gb.memory.Write(0xFF46, 0x80)
+	gb.updateOAMDMA(8)
+
+	assert.Equal(t, byte(0xFF), gb.memory.Read(0x8001), "VRAM should not be readable")
+	assert.Equal(t, byte(0xFF), gb.memory.Read(0xFE00), "OAM should not be readable")
+	assert.Equal(t, byte(0x12), gb.memory.Read(0xC101), "WRAM should be accessible")
+	assert.Equal(t, byte(0x12), gb.memory.Read(0xE101), "echo RAM should be accessible")
+}
+
+func TestOAMDMA_Restart(t *testing.T) {
+	gb := newProgramGameboy(t, nil, nil)
+	fillPage(gb, 0xC100, 1)
+	fillPage(gb, 0xC200, 0x80)
+	gb.memory.Write(0xFF46, 0xC1)
+	gb.updateOAMDMA(50 * 4)
+
+	gb.memory.Write(0xFF46, 0xC2)
+	gb.tickOAMDMA()
+	assert.True(t, gb.oamDMA.Active, "old transfer should continue during setup")
+	assert.Equal(t, byte(49), gb.memory.OAM[48])
+
+	gb.tickOAMDMA()
+	assert.Equal(t, 0, gb.oamDMA.Copied, "new transfer should restart from the first byte")
+	gb.tickOAMDMA()
+	assert.Equal(t, byte(0x80), gb.memory.OAM[0])
+	gb.updateOAMDMA(oamDMALength * 4)
+	assert.False(t, gb.oamDMA.Active)
+	assert.Equal(t, byte(0x1F), gb.memory.OAM[oamDMALength-1], "0x9F+0x80 should wrap")
+}
+
+func TestOAMDMA_EchoSource(t *testing.T) {
+	gb := newProgramGameboy(t, nil, nil)
+	fillPage(gb, 0xDE00, 3)
+	gb.memory.Write(0xFF46, 0xFE)
+	gb.updateOAMDMA((oamDMALength + 2) * 4)
+	assert.Equal(t, byte(3), gb.memory.OAM[0], "sources above 0xE000 should read WRAM")
+	assert.Equal(t, byte(0x9F+3), gb.memory.OAM[0x9F])
+}
+
+// Create a Gameboy in CGB mode with an infinite loop at 0x100.
+func newCGBGameboy(t *testing.T) *Gameboy {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x100:], []byte{0x18, 0xFE})
+	rom[0x143] = 0x80
+	cart.FixHeader(rom)
+	gb, err := NewFromBytes(rom, WithCGBEnabled())
+	require.NoError(t, err, "error in init gb %v", err)
+	return gb
+}
+
+// Set the source and destination registers of a VRAM DMA.
+func setHDMAAddresses(gb *Gameboy, source, destination uint16) {
+	gb.memory.Write(0xFF51, byte(source>>8))
+	gb.memory.Write(0xFF52, byte(source))
+	gb.memory.Write(0xFF53, byte(destination>>8))
+	gb.memory.Write(0xFF54, byte(destination))
+}
+
+func TestHDMA_GeneralPurpose(t *testing.T) {
+	for speed := byte(0); speed < 2; speed++ {
+		gb := newCGBGameboy(t)
+		gb.currentSpeed = speed
+		fillPage(gb, 0xC000, 1)
+		setHDMAAddresses(gb, 0xC000, 0x8100)
+		gb.memory.Write(0xFF55, 0x01)
+
+		assert.Equal(t, byte(0xFF), gb.memory.Read(0xFF55))
+		assert.Equal(t, byte(1), gb.memory.VRAM[0x100])
+		assert.Equal(t, byte(0x20), gb.memory.VRAM[0x11F])
+		assert.Equal(t, byte(0), gb.memory.VRAM[0x120], "only two blocks should be copied")
+		assert.Equal(t, 2*32*gb.getSpeed(), gb.hdma.Stall)
+
+		pc := gb.cpu.PC
+		for gb.hdma.Stall > 0 {
+			gb.step()
+			assert.Equal(t, pc, gb.cpu.PC, "CPU should be paused during the transfer")
+		}
+	}
+}
+
+func TestHDMA_HBlank(t *testing.T) {
+	gb := newCGBGameboy(t)
+	fillPage(gb, 0xC000, 1)
+	setHDMAAddresses(gb, 0xC000, 0x8000)
+	tickUntil(gb, 0, modeTransfer)
+	gb.memory.Write(0xFF55, 0x81)
+	assert.Equal(t, byte(0x01), gb.memory.Read(0xFF55), "bit 7 should be clear while active")
+	assert.Equal(t, byte(0), gb.memory.VRAM[0], "nothing should be copied until H-Blank")
+
+	tickUntil(gb, 0, modeHBlank)
+	assert.Equal(t, byte(0x00), gb.memory.Read(0xFF55))
+	assert.Equal(t, byte(0x10), gb.memory.VRAM[0xF])
+	assert.Equal(t, byte(0), gb.memory.VRAM[0x10], "one block should be copied each H-Blank")
+	assert.Equal(t, 32, gb.hdma.Stall)
+
+	tickUntil(gb, 1, modeHBlank)
+	assert.Equal(t, byte(0xFF), gb.memory.Read(0xFF55))
+	assert.Equal(t, byte(0x20), gb.memory.VRAM[0x1F])
+	assert.False(t, gb.hdma.Active)
+}
+
+func TestHDMA_StartDuringHBlank(t *testing.T) {
+	gb := newCGBGameboy(t)
+	fillPage(gb, 0xC000, 1)
+	setHDMAAddresses(gb, 0xC000, 0x8000)
+	tickUntil(gb, 0, modeHBlank)
+	gb.memory.Write(0xFF55, 0x81)
+	assert.Equal(t, byte(0x10), gb.memory.VRAM[0xF], "first block should be copied immediately")
+	assert.Equal(t, byte(0x00), gb.memory.Read(0xFF55))
+}
+
+func TestHDMA_Abort(t *testing.T) {
+	gb := newCGBGameboy(t)
+	setHDMAAddresses(gb, 0xC000, 0x8000)
+	tickUntil(gb, 0, modeTransfer)
+	gb.memory.Write(0xFF55, 0x83)
+	tickUntil(gb, 0, modeHBlank)
+	gb.memory.Write(0xFF55, 0x00)
+
+	assert.False(t, gb.hdma.Active)
+	assert.Equal(t, byte(0x82), gb.memory.Read(0xFF55), "remaining length should be kept with bit 7 set")
+	stall := gb.hdma.Stall
+	tickUntil(gb, 1, modeHBlank)
+	assert.Equal(t, stall, gb.hdma.Stall, "no more blocks should be copied")
+}
+
+func TestHDMA_Sources(t *testing.T) {
+	gb := newCGBGameboy(t)
+	gb.memory.Write(0xFF4F, 1)
+	gb.memory.VRAM[0x2000] = 0x12
+	setHDMAAddresses(gb, 0x8000, 0x8100)
+	gb.memory.Write(0xFF55, 0x00)
+	assert.Equal(t, byte(0xFF), gb.memory.VRAM[0x2100], "VRAM cannot be used as the source")
+	assert.Equal(t, byte(0), gb.memory.VRAM[0x100], "destination should be in the selected bank")
+}
+
+func TestHDMA_DestinationOverflow(t *testing.T) {
+	gb := newCGBGameboy(t)
+	fillPage(gb, 0xC000, 1)
+	setHDMAAddresses(gb, 0xC000, 0x9FF0)
+	gb.memory.Write(0xFF55, 0x03)
+	assert.Equal(t, byte(1), gb.memory.VRAM[0x1FF0])
+	assert.Equal(t, byte(0), gb.memory.VRAM[0], "transfer should stop at the end of VRAM")
+	assert.Equal(t, 32, gb.hdma.Stall)
+}
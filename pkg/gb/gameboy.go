@@ -2,6 +2,8 @@ package gb
 
 import (
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/Humpheh/goboy/pkg/apu"
 	"github.com/Humpheh/goboy/pkg/cart"
@@ -29,17 +31,15 @@ type Gameboy struct {
 	Debug  DebugFlags
 	paused bool
 
-	timerCounter int
+	timer  timer
+	ppu    ppu
+	oamDMA oamDMA
+	hdma   hdma
 
 	// Matrix of pixel data which is used while the screen is rendering. When a
 	// frame has been completed, this data is copied into the PreparedData matrix.
-	screenData [ScreenWidth][ScreenHeight][3]uint8
-	bgPriority [ScreenWidth][ScreenHeight]bool
-
-	// Track colour of tiles in scanline for priority management.
-	tileScanline    [ScreenWidth]uint8
-	scanlineCounter int
-	screenCleared   bool
+	screenData    [ScreenWidth][ScreenHeight][3]uint8
+	screenCleared bool
 
 	// PreparedData is a matrix of screen pixel data for a single frame which has
 	// been fully rendered.
@@ -49,6 +49,19 @@ type Gameboy struct {
 	interruptsOn       bool
 	halted             bool
 
+	// If the IME was enabled by the previous instruction, which is needed for
+	// the behaviour of HALT directly after EI.
+	imeJustEnabled bool
+
+	// If the HALT bug has been triggered, which causes the PC to not be
+	// incremented after reading the next opcode.
+	haltBug bool
+
+	// If the CPU is in STOP mode waiting for a button to be pressed, and the
+	// number of cycles remaining until a CGB speed switch has completed.
+	stopped           bool
+	speedSwitchCycles int
+
 	cbInst [0x100]func()
 
 	// Mask of the currently pressed buttons.
@@ -64,35 +77,137 @@ type Gameboy struct {
 	prepareSpeed bool
 
 	thisCpuTicks int
+	// Cycles taken so far by the current step, which is advanced each
+	// time the CPU accesses memory or spends a cycle internally.
+	stepCycles int
+
+	// Cycles executed so far in the current frame and the number of
+	// frames which have been completed.
+	frameCycles int
+	frames      int
 
 	keyHandlers map[Button]func()
+
+	// Hardware on the cartridge which is driven by the clock, or nil if
+	// the cartridge does not have any.
+	cartClock cart.Clocked
+
+	debugger *Debugger
+	cheats   *CheatEngine
+	watches  *WatchList
 }
 
-// Update update the state of the gameboy by a single frame.
+// Update update the state of the gameboy by a single frame. If a debugger is
+// attached, the update may return early when a breakpoint or watchpoint is hit.
 func (gb *Gameboy) Update() int {
-	if gb.paused {
+	if gb.paused || gb.debugger.isStopped() {
 		return 0
 	}
 
 	cycles := 0
-	for cycles < CyclesFrame*gb.getSpeed() {
-		cyclesOp := 4
-		if !gb.halted {
-			if gb.Debug.OutputOpcodes {
-				LogOpcode(gb, false)
-			}
-			cyclesOp = gb.ExecuteNextOpcode()
-		} else {
-			// TODO: This is incorrect
+	for {
+		if gb.debugger != nil && gb.debugger.checkBreakpoint() {
+			return cycles
 		}
-		cycles += cyclesOp
-		gb.updateGraphics(cyclesOp)
-		gb.updateTimers(cyclesOp)
-		cycles += gb.doInterrupts()
+		stepCycles, frameDone := gb.frameStep()
+		cycles += stepCycles
+		if gb.debugger != nil && gb.debugger.checkWatchpoints() {
+			return cycles
+		}
+		if frameDone {
+			return cycles
+		}
+	}
+}
 
-		gb.sound.Buffer(cyclesOp, gb.getSpeed())
+// Perform a single step as part of the current frame. Returns the number of
+// cycles taken and if the frame has been completed.
+func (gb *Gameboy) frameStep() (int, bool) {
+	cycles := gb.step()
+	gb.frameCycles += cycles
+	if gb.frameCycles >= CyclesFrame*gb.getSpeed() {
+		gb.frameCycles = 0
+		gb.frames++
+		if gb.cheats != nil {
+			gb.cheats.applyRAM()
+		}
+		if gb.watches != nil {
+			gb.watches.onFrame()
+		}
+		return cycles, true
 	}
-	return cycles
+	return cycles, false
+}
+
+// Execute the next opcode, or idle if halted, and update the rest of the
+// hardware by the cycles taken. Returns the number of cycles taken including
+// any interrupt which was serviced.
+func (gb *Gameboy) step() int {
+	gb.stepCycles = 0
+	switch {
+	case gb.stopped:
+		// Everything is stopped until a button is pressed
+		return 4
+	case gb.speedSwitchCycles > 0:
+		// The CPU and timers are paused while the speed is switched
+		gb.speedSwitchCycles -= 4
+		gb.updateGraphics(4)
+		gb.sound.Buffer(4, gb.getSpeed())
+		return 4
+	case gb.hdma.Stall > 0:
+		// The CPU is paused while a VRAM DMA copies data
+		gb.hdma.Stall -= 4
+		gb.idleCycle()
+		gb.sound.Buffer(gb.stepCycles, gb.getSpeed())
+		return gb.stepCycles
+	case !gb.halted:
+		if gb.Debug.OutputOpcodes {
+			LogOpcode(gb, false)
+		}
+		gb.options.trace.trace(gb)
+		gb.debugger.setExecuting(true)
+		gb.ExecuteNextOpcode()
+		gb.debugger.setExecuting(false)
+	default:
+		// If halted then the CPU idles until an interrupt is pending
+		gb.idleCycle()
+	}
+	gb.doInterrupts()
+
+	gb.sound.Buffer(gb.stepCycles, gb.getSpeed())
+	return gb.stepCycles
+}
+
+// Advance the rest of the hardware by a single machine cycle of the CPU.
+func (gb *Gameboy) tick() {
+	gb.updateGraphics(4)
+	gb.updateTimers(4)
+	gb.updateOAMDMA(4)
+	if gb.cartClock != nil {
+		gb.cartClock.Tick(4 / gb.getSpeed())
+	}
+	gb.stepCycles += 4
+}
+
+// Read a value from memory on the CPU bus, which takes a machine cycle. The
+// access is made at the start of the cycle, before the hardware is advanced.
+func (gb *Gameboy) cpuRead(address uint16) byte {
+	value := gb.memory.Read(address)
+	gb.tick()
+	return value
+}
+
+// Write a value to memory on the CPU bus, which takes a machine cycle. The
+// access is made at the start of the cycle, before the hardware is advanced.
+func (gb *Gameboy) cpuWrite(address uint16, value byte) {
+	gb.memory.Write(address, value)
+	gb.tick()
+}
+
+// Spend a machine cycle on an internal operation which does not access
+// memory.
+func (gb *Gameboy) idleCycle() {
+	gb.tick()
 }
 
 // togglePaused switches the paused state of the execution.
@@ -131,70 +246,30 @@ func (gb *Gameboy) getSpeed() int {
 	return int(gb.currentSpeed + 1)
 }
 
-// Check if the speed needs to be switched for CGB mode.
-func (gb *Gameboy) checkSpeedSwitch() {
-	if gb.prepareSpeed {
-		// Switch speed
-		gb.prepareSpeed = false
-		if gb.currentSpeed == 0 {
-			gb.currentSpeed = 1
-		} else {
-			gb.currentSpeed = 0
-		}
-		gb.halted = false
-	}
-}
-
-func (gb *Gameboy) updateTimers(cycles int) {
-	gb.dividerRegister(cycles)
-	if gb.isClockEnabled() {
-		gb.timerCounter += cycles
+// Number of cycles the CPU is paused for while switching speed.
+const speedSwitchCycles = 2050 * 4
 
-		freq := gb.getClockFreqCount()
-		for gb.timerCounter >= freq {
-			gb.timerCounter -= freq
-			tima := gb.memory.HighRAM[0x05] /* TIMA */
-			if tima == 0xFF {
-				gb.memory.HighRAM[TIMA-0xFF00] = gb.memory.HighRAM[0x06] /* TMA */
-				gb.requestInterrupt(2)
-			} else {
-				gb.memory.HighRAM[TIMA-0xFF00] = tima + 1
-			}
-		}
+// Check if the speed needs to be switched for CGB mode. Returns true if the
+// speed was switched.
+func (gb *Gameboy) checkSpeedSwitch() bool {
+	if !gb.prepareSpeed {
+		return false
 	}
-}
-
-func (gb *Gameboy) isClockEnabled() bool {
-	return bitTest(gb.memory.HighRAM[0x07] /* TAC */, 2)
-}
-
-func (gb *Gameboy) getClockFreq() byte {
-	return gb.memory.HighRAM[0x07] /* TAC */ & 0x3
-}
-
-func (gb *Gameboy) getClockFreqCount() int {
-	switch gb.getClockFreq() {
-	case 0:
-		return 1024
-	case 1:
-		return 16
-	case 2:
-		return 64
-	default:
-		return 256
+	gb.prepareSpeed = false
+	if gb.currentSpeed == 0 {
+		gb.currentSpeed = 1
+	} else {
+		gb.currentSpeed = 0
 	}
+	gb.resetDivider()
+	gb.speedSwitchCycles = speedSwitchCycles
+	return true
 }
 
-func (gb *Gameboy) setClockFreq() {
-	gb.timerCounter = 0
-}
-
-func (gb *Gameboy) dividerRegister(cycles int) {
-	gb.cpu.Divider += cycles
-	if gb.cpu.Divider >= 255 {
-		gb.cpu.Divider -= 255
-		gb.memory.HighRAM[DIV-0xFF00]++
-	}
+// Enter STOP mode, which stops the CPU and timers until a button is pressed.
+func (gb *Gameboy) stop() {
+	gb.resetDivider()
+	gb.stopped = true
 }
 
 // Request the Gameboy to perform an interrupt.
@@ -204,29 +279,38 @@ func (gb *Gameboy) requestInterrupt(interrupt byte) {
 	gb.memory.Write(0xFF0F, req)
 }
 
-func (gb *Gameboy) doInterrupts() (cycles int) {
+func (gb *Gameboy) doInterrupts() {
+	gb.imeJustEnabled = false
 	if gb.interruptsEnabling {
 		gb.interruptsOn = true
 		gb.interruptsEnabling = false
-		return 0
+		gb.imeJustEnabled = true
+		return
 	}
-	if !gb.interruptsOn && !gb.halted {
-		return 0
+	pending := gb.pendingInterrupts()
+	if pending == 0 {
+		return
 	}
 
-	req := gb.memory.HighRAM[0x0F] | 0xE0
-	enabled := gb.memory.HighRAM[0xFF]
-
-	if req > 0 {
-		var i byte
-		for i = 0; i < 5; i++ {
-			if bitTest(req, i) && bitTest(enabled, i) {
-				gb.serviceInterrupt(i)
-				return 20
-			}
+	// A pending interrupt always wakes the CPU from HALT, even if the
+	// interrupts are disabled
+	gb.halted = false
+	if !gb.interruptsOn {
+		return
+	}
+
+	var i byte
+	for i = 0; i < 5; i++ {
+		if bitTest(pending, i) {
+			gb.serviceInterrupt(i)
+			return
 		}
 	}
-	return 0
+}
+
+// Get the interrupts which are both requested and enabled.
+func (gb *Gameboy) pendingInterrupts() byte {
+	return gb.memory.HighRAM[0x0F] & gb.memory.HighRAM[0xFF] & 0x1F
 }
 
 // Address that should be jumped to by interrupt.
@@ -238,38 +322,38 @@ var interruptAddresses = map[byte]uint16{
 	4: 0x60, // Hi-Lo P10-P13
 }
 
-// Called if an interrupt has been raised. Will check if interrupts are
-// enabled and will jump to the interrupt address.
+// Called if an interrupt has been raised while interrupts are enabled. Will
+// disable interrupts and jump to the interrupt address.
 func (gb *Gameboy) serviceInterrupt(interrupt byte) {
-	// If was halted without interrupts, do not jump or reset IF
-	if !gb.interruptsOn && gb.halted {
-		gb.halted = false
-		return
-	}
 	gb.interruptsOn = false
-	gb.halted = false
 
 	req := gb.memory.ReadHighRam(0xFF0F)
 	req = bitReset(req, interrupt)
 	gb.memory.Write(0xFF0F, req)
 
+	// Dispatching takes 5 machine cycles: two internal cycles, writing the
+	// PC to the stack, and jumping to the interrupt address
+	gb.idleCycle()
 	gb.pushStack(gb.cpu.PC)
 	gb.cpu.PC = interruptAddresses[interrupt]
+	gb.idleCycle()
 }
 
 // Push a 16 bit value onto the stack and decrement SP.
 func (gb *Gameboy) pushStack(address uint16) {
+	// SP is decremented on an internal cycle before the writes
+	gb.idleCycle()
 	sp := gb.cpu.SP.HiLo()
-	gb.memory.Write(sp-1, byte(uint16(address&0xFF00)>>8))
-	gb.memory.Write(sp-2, byte(address&0xFF))
+	gb.cpuWrite(sp-1, byte(uint16(address&0xFF00)>>8))
+	gb.cpuWrite(sp-2, byte(address&0xFF))
 	gb.cpu.SP.Set(gb.cpu.SP.HiLo() - 2)
 }
 
 // Pop the next 16 bit value off the stack and increment SP.
 func (gb *Gameboy) popStack() uint16 {
 	sp := gb.cpu.SP.HiLo()
-	byte1 := uint16(gb.memory.Read(sp))
-	byte2 := uint16(gb.memory.Read(sp+1)) << 8
+	byte1 := uint16(gb.cpuRead(sp))
+	byte2 := uint16(gb.cpuRead(sp+1)) << 8
 	gb.cpu.SP.Set(gb.cpu.SP.HiLo() + 2)
 	return byte1 | byte2
 }
@@ -297,23 +381,44 @@ func (gb *Gameboy) IsCartLoaded() bool {
 	return gb.memory != nil && gb.memory.Cart != nil
 }
 
+// Close stops the background save loop and sound output of the Gameboy,
+// writes any unsaved changes to the cartridge RAM to the save store and
+// flushes the trace writer. The Gameboy should not be used after it has been
+// closed.
+func (gb *Gameboy) Close() error {
+	gb.sound.Close()
+	var err error
+	if gb.IsCartLoaded() {
+		err = gb.memory.Cart.Close()
+	}
+	if traceErr := gb.options.trace.flush(); traceErr != nil && err == nil {
+		err = fmt.Errorf("flushing trace: %v", traceErr)
+	}
+	return err
+}
+
 // IsCGB returns if we are using CGB features.
 func (gb *Gameboy) IsCGB() bool {
 	return gb.cgbMode
 }
 
-// Initialise the Gameboy using a path to a rom.
-func (gb *Gameboy) init(romFile string) error {
+// Initialise the Gameboy with a cartridge.
+func (gb *Gameboy) init(c *cart.Cart) {
 	gb.setup()
 
-	// Load the ROM file
-	hasCGB, err := gb.memory.LoadCart(romFile)
-	if err != nil {
-		return fmt.Errorf("failed to open rom file: %s", err)
+	gb.memory.Cart = c
+	gb.cartClock, _ = c.BankingController.(cart.Clocked)
+	if gb.options.imageSource != nil {
+		c.SetImageSource(gb.options.imageSource)
+	}
+	if gb.options.rumbleHandler != nil {
+		c.SetRumbleHandler(gb.options.rumbleHandler)
+	}
+	for _, cheat := range gb.options.cheats {
+		gb.Cheats().Add(cheat)
 	}
 	fmt.Printf("Loaded ROM: %s\n", gb.memory.Cart.GetName())
-	gb.cgbMode = gb.options.cgbMode && hasCGB
-	return nil
+	gb.cgbMode = gb.options.cgbMode && c.GetMode()&cart.CGB != 0
 }
 
 func (gb *Gameboy) initKeyHandlers() {
@@ -328,6 +433,8 @@ func (gb *Gameboy) initKeyHandlers() {
 		ButtonToggleSoundChannel2: func() { gb.ToggleSoundChannel(2) },
 		ButtonToggleSoundChannel3: func() { gb.ToggleSoundChannel(3) },
 		ButtonToggleSoundChannel4: func() { gb.ToggleSoundChannel(4) },
+		ButtonSaveState:           gb.saveStateToFile,
+		ButtonLoadState:           gb.loadStateFromFile,
 	}
 }
 
@@ -340,12 +447,13 @@ func (gb *Gameboy) setup() {
 	// Initialise the memory
 	gb.memory = &Memory{}
 	gb.memory.Init(gb)
+	gb.timer = timer{counter: initialTimerCounter(gb.options.cgbMode)}
 
 	gb.sound = &apu.APU{}
 	gb.sound.Init(gb.options.sound)
 
 	gb.Debug = DebugFlags{}
-	gb.scanlineCounter = 456
+	gb.ppu = ppu{Mode: modeOAMScan}
 	gb.inputMask = 0xFF
 
 	gb.cbInst = gb.cbInstructions()
@@ -356,16 +464,103 @@ func (gb *Gameboy) setup() {
 	gb.initKeyHandlers()
 }
 
-// New returns a new Gameboy instance.
+// New returns a new Gameboy instance with a rom loaded from a file. Unless
+// a save store is provided with WithSaveStore, save data will be stored in
+// a .sav file next to the rom. A patch file next to the rom, or the patch
+// provided with WithPatch, is applied to the rom, and the cheats in a .cheats
+// file next to the rom, or the file provided with WithCheatFile, are loaded.
 func New(romFile string, opts ...GameboyOption) (*Gameboy, error) {
-	// Build the gameboy
+	gameboy := newGameboy(opts)
+	rom, err := cart.LoadPatchedROMFile(romFile, gameboy.options.patchFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rom file: %s", err)
+	}
+	if err := validateROM(rom); err != nil {
+		return nil, err
+	}
+
+	store := gameboy.options.saveStore
+	if store == nil {
+		store = cart.NewFileSaveStore(romFile + ".sav")
+	}
+	gameboy.init(cart.NewCartWithStore(rom, romFile, store))
+	if err := gameboy.loadCheatFile(); err != nil {
+		gameboy.Close()
+		return nil, err
+	}
+	return gameboy, nil
+}
+
+// Load the cheat file given in the options, or the cheat file next to the rom
+// if it exists. Roms which were not loaded from a file have no cheat file next
+// to them, so only the cheat file from the options is loaded.
+func (gb *Gameboy) loadCheatFile() error {
+	filename := gb.options.cheatFile
+	if filename == "" {
+		filename = gb.memory.Cart.GetCheatFilename()
+		if filename == "" {
+			return nil
+		}
+		if _, err := os.Stat(filename); err != nil {
+			return nil
+		}
+	}
+	if err := gb.Cheats().LoadFile(filename); err != nil {
+		return fmt.Errorf("failed to load cheats: %w", err)
+	}
+	return nil
+}
+
+// NewFromBytes returns a new Gameboy instance with a rom loaded from a byte
+// slice. Save data is only persisted if a save store is provided with the
+// WithSaveStore option, and patches and cheats are only loaded from a file
+// if one is provided with WithPatch or WithCheatFile.
+func NewFromBytes(rom []byte, opts ...GameboyOption) (*Gameboy, error) {
+	gameboy := newGameboy(opts)
+	if gameboy.options.patchFile != "" {
+		patched, err := cart.ApplyPatchFile(rom, gameboy.options.patchFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply patch: %w", err)
+		}
+		rom = patched
+	}
+	if err := validateROM(rom); err != nil {
+		return nil, err
+	}
+	gameboy.init(cart.NewCartWithStore(rom, "", gameboy.options.saveStore))
+	if err := gameboy.loadCheatFile(); err != nil {
+		gameboy.Close()
+		return nil, err
+	}
+	return gameboy, nil
+}
+
+// NewFromReader returns a new Gameboy instance with a rom read from a reader.
+// Save data is only persisted if a save store is provided with the
+// WithSaveStore option, and patches and cheats are only loaded from a file
+// if one is provided with WithPatch or WithCheatFile.
+func NewFromReader(r io.Reader, opts ...GameboyOption) (*Gameboy, error) {
+	rom, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rom: %s", err)
+	}
+	return NewFromBytes(rom, opts...)
+}
+
+// Build the gameboy and apply the options.
+func newGameboy(opts []GameboyOption) *Gameboy {
 	gameboy := Gameboy{}
 	for _, opt := range opts {
 		opt(&gameboy.options)
 	}
-	err := gameboy.init(romFile)
-	if err != nil {
-		return nil, err
+	return &gameboy
+}
+
+// Check that the rom has a valid cartridge header, so that bad dumps are
+// rejected before they are run.
+func validateROM(rom []byte) error {
+	if err := cart.ValidateROM(rom); err != nil {
+		return fmt.Errorf("invalid rom: %w", err)
 	}
-	return &gameboy, nil
+	return nil
 }
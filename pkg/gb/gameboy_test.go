@@ -0,0 +1,171 @@
+package gb
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Humpheh/goboy/pkg/cart"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Save store which returns fixed save data.
+type testSaveStore struct {
+	data []byte
+}
+
+func (s *testSaveStore) Load() ([]byte, error) {
+	return s.data, nil
+}
+
+func (s *testSaveStore) Save(data []byte) error {
+	s.data = data
+	return nil
+}
+
+func TestNewFromBytes(t *testing.T) {
+	rom, err := os.ReadFile("./../../roms/blargg/cpu_instrs.gb")
+	require.NoError(t, err)
+
+	gb, err := NewFromBytes(rom)
+	require.NoError(t, err, "error in init gb %v", err)
+	assert.Equal(t, "CPU_INSTRS", gb.GetLoadedCart().GetName())
+
+	gb, err = NewFromReader(bytes.NewReader(rom))
+	require.NoError(t, err, "error in init gb %v", err)
+	assert.Equal(t, "CPU_INSTRS", gb.GetLoadedCart().GetName())
+
+	_, err = NewFromBytes(rom[:0x100])
+	assert.Error(t, err, "expected error with rom which is too small")
+
+	bad := append([]byte{}, rom...)
+	bad[0x104] = 0x00
+	_, err = NewFromBytes(bad)
+	assert.ErrorIs(t, err, cart.ErrInvalidLogo)
+}
+
+// Create a 32KB rom with a valid header which jumps from the entry point to
+// a program at 0x150. The header must be fixed again if it is changed.
+func newTestROM(program []byte) []byte {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x100:], []byte{0xC3, 0x50, 0x01}) // JP $0150
+	copy(rom[0x150:], program)
+	cart.FixHeader(rom)
+	return rom
+}
+
+func TestWithSaveStore(t *testing.T) {
+	// MBC1+RAM+BATTERY cartridge with 32KB of RAM
+	rom := make([]byte, 0x8000)
+	rom[0x147] = 0x03
+	rom[0x149] = 0x03
+	cart.FixHeader(rom)
+
+	store := &testSaveStore{data: bytes.Repeat([]byte{0x42}, 0x8000)}
+	gb, err := NewFromBytes(rom, WithSaveStore(store))
+	require.NoError(t, err, "error in init gb %v", err)
+	gb.memory.Write(0x0000, 0x0A) // Enable RAM
+	assert.Equal(t, byte(0x42), gb.memory.Read(0xA000), "save data was not loaded")
+}
+
+func TestWithPatch(t *testing.T) {
+	// IPS patch which writes 3 bytes at 0x0150
+	patch := []byte("PATCH\x00\x01\x50\x00\x03\x12\x34\x56EOF")
+	patchFile := filepath.Join(t.TempDir(), "game.ips")
+	require.NoError(t, os.WriteFile(patchFile, patch, 0644))
+
+	gb, err := NewFromBytes(newTestROM(nil), WithPatch(patchFile))
+	require.NoError(t, err, "error in init gb %v", err)
+	assert.Equal(t, byte(0x12), gb.memory.Read(0x0150))
+	assert.Equal(t, byte(0x34), gb.memory.Read(0x0151))
+	assert.Equal(t, byte(0x56), gb.memory.Read(0x0152))
+
+	require.NoError(t, os.WriteFile(patchFile, []byte("not a patch"), 0644))
+	_, err = NewFromBytes(newTestROM(nil), WithPatch(patchFile))
+	assert.ErrorIs(t, err, cart.ErrUnknownPatch)
+}
+
+func TestWithTraceWriter(t *testing.T) {
+	var trace bytes.Buffer
+	gb, err := New("./../../roms/blargg/cpu_instrs.gb", WithTraceWriter(&trace, TraceFormatDisasm))
+	require.NoError(t, err, "error in init gb %v", err)
+	gb.Update()
+	require.NoError(t, gb.Close())
+
+	lines := strings.Split(trace.String(), "\n")
+	require.Greater(t, len(lines), 1000)
+	assert.Equal(t, "A:01 F:B0 B:00 C:00 D:FF E:56 H:00 L:0D SP:FFFE PC:0100 PCMEM:00,C3,37,06 ; NOP", lines[0])
+	assert.Equal(t, "A:01 F:B0 B:00 C:00 D:FF E:56 H:00 L:0D SP:FFFE PC:0101 PCMEM:C3,37,06,CE ; JP $0637", lines[1])
+	assert.Contains(t, lines[2], "PC:0637")
+}
+
+// Writer which always fails.
+type errorWriter struct{}
+
+func (errorWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestWithTraceWriter_Error(t *testing.T) {
+	gb, err := New("./../../roms/blargg/cpu_instrs.gb", WithTraceWriter(errorWriter{}, TraceFormatDoctor))
+	require.NoError(t, err, "error in init gb %v", err)
+	gb.Update()
+	assert.ErrorContains(t, gb.Close(), "disk full")
+}
+
+func TestWithImageSource(t *testing.T) {
+	// Pocket Camera cartridge which loops at the entry point
+	rom := make([]byte, 0x8000)
+	rom[0x147] = 0xFC
+	rom[0x100], rom[0x101] = 0x18, 0xFE
+	cart.FixHeader(rom)
+
+	white := image.NewGray(image.Rect(0, 0, 128, 112))
+	for i := range white.Pix {
+		white.Pix[i] = 0xFF
+	}
+	gb, err := NewFromBytes(rom, WithImageSource(cart.NewStaticImageSource(white)))
+	require.NoError(t, err, "error in init gb %v", err)
+
+	// Set every dithering threshold so that white is the lightest shade
+	// and everything else is black, and start a capture
+	gb.memory.Write(0x4000, 0x10)
+	gb.memory.Write(0xA002, 0x03)
+	for i := uint16(0xA006); i < 0xA036; i++ {
+		gb.memory.Write(i, 0xFF)
+	}
+	gb.memory.Write(0xA000, 0x01)
+	assert.Equal(t, byte(0x01), gb.memory.Read(0xA000), "capture should be in progress")
+
+	for i := 0; i < 3; i++ {
+		gb.Update()
+	}
+	assert.Equal(t, byte(0x00), gb.memory.Read(0xA000), "capture should have finished")
+	gb.memory.Write(0x4000, 0x00)
+	assert.Equal(t, byte(0x00), gb.memory.Read(0xA100), "image should be captured as white")
+	assert.Equal(t, byte(0x00), gb.memory.Read(0xAEFF))
+}
+
+func TestWithRumbleHandler(t *testing.T) {
+	// MBC5+RUMBLE cartridge which turns the motor on and then loops
+	rom := newTestROM([]byte{
+		0x3E, 0x08, // LD A,$08
+		0xEA, 0x00, 0x40, // LD ($4000),A
+		0x18, 0xFE, // JR -2
+	})
+	rom[0x147] = 0x1C
+	cart.FixHeader(rom)
+
+	var events []bool
+	gb, err := NewFromBytes(rom, WithRumbleHandler(func(on bool) {
+		events = append(events, on)
+	}))
+	require.NoError(t, err, "error in init gb %v", err)
+	gb.Update()
+	assert.Equal(t, []bool{true}, events)
+}
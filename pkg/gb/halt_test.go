@@ -0,0 +1,149 @@
+package gb
+
+import (
+	"testing"
+
+	"github.com/Humpheh/goboy/pkg/cart"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create a Gameboy running a rom with a program at 0x150 and a handler at
+// the V-Blank interrupt vector. The jump from the entry point to the program
+// has already been executed.
+func newProgramGameboy(t *testing.T, program []byte, vblank []byte) *Gameboy {
+	rom := newTestROM(program)
+	copy(rom[0x40:], vblank)
+	copy(rom[0x134:], "HALTTEST")
+	cart.FixHeader(rom)
+	gb, err := NewFromBytes(rom)
+	require.NoError(t, err, "error in init gb %v", err)
+	gb.step()
+	return gb
+}
+
+// Program which enables and requests the V-Blank interrupt and clears A.
+var requestVBlank = []byte{
+	0xF3,       // DI
+	0x3E, 0x01, // LD A,$01
+	0xE0, 0xFF, // LDH ($FFFF),A
+	0xE0, 0x0F, // LDH ($FF0F),A
+	0xAF, // XOR A
+}
+
+func TestHalt_Bug(t *testing.T) {
+	program := append(append([]byte{}, requestVBlank...),
+		0x76,       // HALT
+		0x3C,       // INC A
+		0x18, 0xFE, // JR -2
+	)
+	gb := newProgramGameboy(t, program, nil)
+	for i := 0; i < 9; i++ {
+		gb.step()
+	}
+	assert.Equal(t, byte(2), gb.cpu.AF.Hi(), "INC A should be executed twice")
+	assert.False(t, gb.halted)
+	assert.Equal(t, uint16(0x15A), gb.cpu.PC)
+}
+
+func TestHalt_WakeWithoutIME(t *testing.T) {
+	program := []byte{
+		0xF3,       // DI
+		0x3E, 0x01, // LD A,$01
+		0xE0, 0xFF, // LDH ($FFFF),A
+		0xAF,       // XOR A
+		0xE0, 0x0F, // LDH ($FF0F),A
+		0x76, // HALT
+		0x3C, // INC A
+	}
+	gb := newProgramGameboy(t, program, nil)
+	for i := 0; i < 6; i++ {
+		gb.step()
+	}
+	require.True(t, gb.halted, "should halt with no interrupt pending")
+	for i := 0; i < 100; i++ {
+		gb.step()
+	}
+	assert.True(t, gb.halted, "should stay halted until an interrupt is pending")
+
+	gb.requestInterrupt(0)
+	gb.step()
+	assert.False(t, gb.halted, "should wake when an interrupt is pending")
+	gb.step()
+	assert.Equal(t, byte(1), gb.cpu.AF.Hi(), "interrupt should not be serviced")
+	assert.Equal(t, byte(1), gb.memory.HighRAM[0x0F]&1, "interrupt flag should not be cleared")
+}
+
+func TestHalt_AfterEI(t *testing.T) {
+	program := append(append([]byte{}, requestVBlank...),
+		0xFB, // EI
+		0x76, // HALT
+	)
+	handler := []byte{
+		0x3C, // INC A
+		0xD9, // RETI
+	}
+	gb := newProgramGameboy(t, program, handler)
+	for i := 0; i < 11; i++ {
+		gb.step()
+	}
+	assert.Equal(t, byte(1), gb.cpu.AF.Hi(), "interrupt should be serviced once")
+	assert.True(t, gb.halted, "HALT should be executed again after the interrupt")
+	assert.Equal(t, uint16(0x15A), gb.cpu.PC)
+
+	sp := gb.cpu.SP.HiLo()
+	returnAddress := uint16(gb.memory.Read(sp-1))<<8 | uint16(gb.memory.Read(sp-2))
+	assert.Equal(t, uint16(0x159), returnAddress, "interrupt should return to the HALT")
+}
+
+func TestStop(t *testing.T) {
+	program := []byte{
+		0x10, 0x00, // STOP
+		0x3C, // INC A
+	}
+	gb := newProgramGameboy(t, program, nil)
+	gb.step()
+	require.True(t, gb.stopped)
+	assert.Equal(t, byte(0), gb.memory.Read(DIV), "STOP should reset DIV")
+
+	a := gb.cpu.AF.Hi()
+	for i := 0; i < 1000; i++ {
+		gb.step()
+	}
+	assert.Equal(t, uint16(0x152), gb.cpu.PC, "should not execute while stopped")
+	assert.Equal(t, byte(0), gb.memory.Read(DIV), "DIV should not increment while stopped")
+
+	gb.pressButton(ButtonA)
+	gb.step()
+	assert.False(t, gb.stopped, "pressing a button should exit STOP")
+	assert.Equal(t, a+1, gb.cpu.AF.Hi())
+}
+
+func TestStop_SpeedSwitch(t *testing.T) {
+	program := []byte{
+		0x3E, 0x01, // LD A,$01
+		0xE0, 0x4D, // LDH ($FF4D),A
+		0x10, 0x00, // STOP
+		0x3C, // INC A
+	}
+	rom := newTestROM(program)
+	rom[0x143] = 0x80
+	cart.FixHeader(rom)
+	gb, err := NewFromBytes(rom, WithCGBEnabled())
+	require.NoError(t, err, "error in init gb %v", err)
+
+	for i := 0; i < 4; i++ {
+		gb.step()
+	}
+	assert.False(t, gb.stopped, "STOP should switch speed instead of stopping")
+	assert.Equal(t, byte(1), gb.currentSpeed)
+	assert.Equal(t, byte(0x80), gb.memory.Read(0xFF4D))
+
+	// The CPU is paused while the speed switches
+	for gb.speedSwitchCycles > 0 {
+		assert.Equal(t, uint16(0x156), gb.cpu.PC)
+		gb.step()
+	}
+	gb.step()
+	assert.Equal(t, byte(2), gb.cpu.AF.Hi())
+}
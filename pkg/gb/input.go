@@ -31,6 +31,8 @@ const (
 	ButtonToggleSoundChannel2 = 15
 	ButtonToggleSoundChannel3 = 16
 	ButtonToggleSoundChannel4 = 17
+	ButtonSaveState           = 18
+	ButtonLoadState           = 19
 )
 
 // IsGameBoyButton checks whether a button value represents a physical button on a GameBoy
@@ -61,8 +63,8 @@ type IOBinding interface {
 	IsRunning() bool
 }
 
-// pressButton notifies the GameBoy that a button has just been pressed
-// and requests a joypad interrupt.
+// pressButton notifies the GameBoy that a button has just been pressed,
+// requests a joypad interrupt and wakes the CPU if it is in STOP mode.
 func (gb *Gameboy) pressButton(button Button) {
 	if gb.paused || !gb.IsCartLoaded() {
 		return
@@ -70,6 +72,7 @@ func (gb *Gameboy) pressButton(button Button) {
 
 	gb.inputMask = bitReset(gb.inputMask, byte(button))
 	gb.requestInterrupt(4) // Request the joypad interrupt
+	gb.stopped = false
 }
 
 // releaseButton notifies the GameBoy that a button has just been released.
@@ -96,3 +99,14 @@ func (gb *Gameboy) ProcessInput(buttons ButtonInput) {
 		}
 	}
 }
+
+// SetAccelerometer sets the tilt of cartridges which have an accelerometer,
+// such as the MBC7, as the acceleration in each axis in units of g. Positive
+// x is tilting the GameBoy to the right and positive y is tilting it towards
+// the player. This does nothing if the cartridge does not have an
+// accelerometer.
+func (gb *Gameboy) SetAccelerometer(x, y float64) {
+	if gb.IsCartLoaded() {
+		gb.memory.Cart.SetAcceleration(x, y)
+	}
+}
@@ -40,10 +40,6 @@ type Memory struct {
 	WRAMBank byte
 
 	OAM [0x100]byte
-
-	// CGB HDMA transfer variables
-	hdmaLength byte
-	hdmaActive bool
 }
 
 // Init the gb memory to the post-boot values.
@@ -51,7 +47,6 @@ func (mem *Memory) Init(gameboy *Gameboy) {
 	mem.gb = gameboy
 
 	// Set the default values
-	mem.HighRAM[0x04] = 0x1E
 	mem.HighRAM[0x05] = 0x00
 	mem.HighRAM[0x06] = 0x00
 	mem.HighRAM[0x07] = 0xF8
@@ -89,7 +84,7 @@ func (mem *Memory) Init(gameboy *Gameboy) {
 	mem.WRAMBank = 1
 }
 
-// LoadCart load a cart rom into memory.
+// LoadCart load a cart rom from a file into memory.
 func (mem *Memory) LoadCart(loc string) (bool, error) {
 	var err error
 	mem.Cart, err = cart.NewCartFromFile(loc)
@@ -125,36 +120,28 @@ func (mem *Memory) WriteHighRam(address uint16, value byte) {
 
 	case address == DIV:
 		// Trap divider register
-		mem.gb.setClockFreq()
-		mem.gb.cpu.Divider = 0
-		mem.HighRAM[DIV-0xFF00] = 0
+		mem.gb.resetDivider()
 
 	case address == TIMA:
-		mem.HighRAM[TIMA-0xFF00] = value
+		mem.gb.writeTIMA(value)
 
 	case address == TMA:
-		mem.HighRAM[TMA-0xFF00] = value
+		mem.gb.writeTMA(value)
 
 	case address == TAC:
 		// Timer control
-		currentFreq := mem.gb.getClockFreq()
-		mem.HighRAM[TAC-0xFF00] = value | 0xF8
-		newFreq := mem.gb.getClockFreq()
-
-		if currentFreq != newFreq {
-			mem.gb.setClockFreq()
-		}
+		mem.gb.writeTAC(value)
 
 	case address == 0xFF41:
-		mem.HighRAM[0x41] = value | 0x80
+		mem.gb.writeSTAT(value)
 
 	case address == 0xFF44:
 		// Trap scanline register
 		mem.HighRAM[0x44] = 0
 
 	case address == 0xFF46:
-		// DMA transfer
-		mem.doDMATransfer(value)
+		// OAM DMA transfer
+		mem.gb.writeOAMDMA(value)
 
 	case address == 0xFF4D:
 		// CGB speed change
@@ -163,15 +150,15 @@ func (mem *Memory) WriteHighRam(address uint16, value byte) {
 		}
 
 	case address == 0xFF4F:
-		// VRAM bank (CGB only), blocked when HDMA is active
-		if mem.gb.IsCGB() && !mem.hdmaActive {
+		// VRAM bank (CGB only)
+		if mem.gb.IsCGB() {
 			mem.VRAMBank = value & 0x1
 		}
 
 	case address == 0xFF55:
 		// CGB DMA transfer
 		if mem.gb.IsCGB() {
-			mem.doNewDMATransfer(value)
+			mem.gb.writeHDMA(value)
 		}
 
 	case address == 0xFF68:
@@ -219,6 +206,17 @@ func (mem *Memory) WriteHighRam(address uint16, value byte) {
 // current state of the gameboy. This handles banking and side effects
 // of writing to certain addresses.
 func (mem *Memory) Write(address uint16, value byte) {
+	if mem.gb.debugger != nil {
+		mem.gb.debugger.onAccess(WatchWrite, address, value)
+	}
+	if mem.gb.oamDMABlocked(address) {
+		return
+	}
+	if address >= 0xE000 && address < 0xFE00 {
+		// Echo RAM mirrors the internal RAM
+		address -= 0x2000
+	}
+
 	switch {
 	case address < 0x8000:
 		// Write to the cartridge ROM (banking)
@@ -241,12 +239,6 @@ func (mem *Memory) Write(address uint16, value byte) {
 		// Internal RAM Bank 1-7
 		mem.WRAM[(address-0xC000)+(uint16(mem.WRAMBank)*0x1000)] = value
 
-	case address < 0xFE00:
-		// Echo RAM
-		// TODO: re-enable echo RAM?
-		//mem.Data[address] = value
-		//mem.Write(address-0x2000, value)
-
 	case address < 0xFEA0:
 		// Object Attribute Memory
 		mem.OAM[address-0xFE00] = value
@@ -264,9 +256,24 @@ func (mem *Memory) Write(address uint16, value byte) {
 // Read from memory. Will go and read from cartridge memory if the
 // requested address is mapped to that space.
 func (mem *Memory) Read(address uint16) byte {
+	value := byte(0xFF)
+	if !mem.gb.oamDMABlocked(address) {
+		value = mem.read(address)
+	}
+	if mem.gb.debugger != nil {
+		mem.gb.debugger.onAccess(WatchRead, address, value)
+	}
+	return value
+}
+
+// Read from the memory region which an address is mapped to.
+func (mem *Memory) read(address uint16) byte {
 	switch {
 	case address < 0x8000:
 		// Cartridge ROM
+		if mem.gb.cheats != nil {
+			return mem.gb.cheats.patchROM(address, mem.Cart.Read(address))
+		}
 		return mem.Cart.Read(address)
 
 	case address < 0xA000:
@@ -288,11 +295,8 @@ func (mem *Memory) Read(address uint16) byte {
 		return mem.WRAM[(address-0xC000)+(uint16(mem.WRAMBank)*0x1000)]
 
 	case address < 0xFE00:
-		// Echo RAM
-		// TODO: re-enable echo RAM?
-		//mem.Data[address] = value
-		//mem.Write(address-0x2000, value)
-		return 0xFF
+		// Echo RAM mirrors the internal RAM
+		return mem.read(address - 0x2000)
 
 	case address < 0xFEA0:
 		// Object Attribute Memory
@@ -322,6 +326,9 @@ func (mem *Memory) ReadHighRam(address uint16) byte {
 		// Writing to channel 3 waveform RAM.
 		return mem.gb.sound.Read(address)
 
+	case address == DIV:
+		return mem.gb.readDivider()
+
 	case address == 0xFF0F:
 		return mem.HighRAM[0x0F] | 0xE0
 
@@ -371,76 +378,3 @@ func (mem *Memory) ReadHighRam(address uint16) byte {
 		return mem.HighRAM[address-0xFF00]
 	}
 }
-
-// Perform a DMA transfer.
-func (mem *Memory) doDMATransfer(value byte) {
-	// TODO: This may need to be done instead of CPU ticks
-	address := uint16(value) << 8 // (data * 100)
-
-	var i uint16
-	for i = 0; i < 0xA0; i++ {
-		// TODO: Check this doesn't prevent
-		mem.Write(0xFE00+i, mem.Read(address+i))
-	}
-}
-
-// Start a CGB DMA transfer.
-func (mem *Memory) doNewDMATransfer(value byte) {
-	if mem.hdmaActive && bitGet(value, 7) == 0 {
-		// Abort a HDMA transfer
-		mem.hdmaActive = false
-		mem.HighRAM[0x55] |= 0x80 // Set bit 7
-		return
-	}
-
-	length := ((uint16(value) & 0x7F) + 1) * 0x10
-
-	// The 7th bit is DMA mode
-	if value>>7 == 0 {
-		// Mode 0, general purpose DMA
-		mem.performNewDMATransfer(length)
-		mem.HighRAM[0x55] = 0xFF
-	} else {
-		// Mode 1, H-Blank DMA
-		mem.hdmaLength = byte(value)
-		mem.hdmaActive = true
-	}
-}
-
-// Perform a HDMA transfer during a HBlank period.
-func (mem *Memory) doHDMATransfer() {
-	if !mem.hdmaActive {
-		return
-	}
-
-	mem.performNewDMATransfer(0x10)
-	if mem.hdmaLength > 0 {
-		mem.hdmaLength--
-		mem.HighRAM[0x55] = mem.hdmaLength
-	} else {
-		// DMA has finished
-		mem.HighRAM[0x55] = 0xFF
-		mem.hdmaActive = false
-	}
-}
-
-// Transfer a set amount of DMA data based on the current register values.
-func (mem *Memory) performNewDMATransfer(length uint16) {
-	// Load the source and destination from RAM
-	source := (uint16(mem.HighRAM[0x51])<<8 | uint16(mem.HighRAM[0x52])) & 0xFFF0
-	destination := (uint16(mem.HighRAM[0x53])<<8 | uint16(mem.HighRAM[0x54])) & 0x1FF0
-	destination += 0x8000
-
-	// Transfer the data from the source to the destination
-	for i := uint16(0); i < length; i++ {
-		mem.Write(destination, mem.Read(source))
-		destination++
-		source++
-	}
-
-	// Update the source and destination in RAM
-	mem.HighRAM[0x51] = byte(source >> 8)
-	mem.HighRAM[0x52] = byte(source & 0xFF)
-	mem.HighRAM[0x53] = byte(destination >> 8)
-	mem.HighRAM[0x54] = byte(destination & 0xF0)
-}
@@ -1,5 +1,7 @@
 package gb
 
+import "github.com/Humpheh/goboy/pkg/cart"
+
 // GameboyOption is an option for the Gameboy execution.
 type GameboyOption func(o *gameboyOptions)
 
@@ -9,6 +11,26 @@ type gameboyOptions struct {
 
 	// Callback when the serial port is written to
 	transferFunction func(byte)
+
+	// Store for persisting the cartridge save data
+	saveStore cart.SaveStore
+
+	// Writer for the instruction trace
+	trace *traceWriter
+
+	// Source of the images captured by cartridges with a camera
+	imageSource cart.ImageSource
+
+	// Callback when the rumble motor is turned on or off
+	rumbleHandler func(on bool)
+
+	// Patch file to apply to the rom instead of a patch next to it
+	patchFile string
+
+	// Cheats to apply, and the cheat file to load instead of the cheat
+	// file next to the rom
+	cheats    []Cheat
+	cheatFile string
 }
 
 // DebugFlags are flags which can be set to alter the execution of the Gameboy.
@@ -58,3 +80,51 @@ func WithTransferFunction(transfer func(byte)) GameboyOption {
 		o.transferFunction = transfer
 	}
 }
+
+// WithSaveStore provides a store which the battery backed cartridge RAM
+// will be loaded from and saved to, instead of a .sav file next to the rom.
+func WithSaveStore(store cart.SaveStore) GameboyOption {
+	return func(o *gameboyOptions) {
+		o.saveStore = store
+	}
+}
+
+// WithImageSource provides the images which are captured by cartridges with
+// a camera, such as the Pocket Camera.
+func WithImageSource(source cart.ImageSource) GameboyOption {
+	return func(o *gameboyOptions) {
+		o.imageSource = source
+	}
+}
+
+// WithRumbleHandler provides a function to callback on when the rumble motor
+// of the cartridge is turned on or off.
+func WithRumbleHandler(handler func(on bool)) GameboyOption {
+	return func(o *gameboyOptions) {
+		o.rumbleHandler = handler
+	}
+}
+
+// WithPatch applies an IPS, UPS or BPS patch file to the rom when it is
+// loaded, instead of a patch file next to the rom. The rom file is not
+// modified.
+func WithPatch(filename string) GameboyOption {
+	return func(o *gameboyOptions) {
+		o.patchFile = filename
+	}
+}
+
+// WithCheats applies Game Genie or GameShark cheats to the game.
+func WithCheats(cheats ...Cheat) GameboyOption {
+	return func(o *gameboyOptions) {
+		o.cheats = append(o.cheats, cheats...)
+	}
+}
+
+// WithCheatFile loads the cheats from a cheat file, instead of the .cheats
+// file next to the rom.
+func WithCheatFile(filename string) GameboyOption {
+	return func(o *gameboyOptions) {
+		o.cheatFile = filename
+	}
+}
@@ -11,111 +11,135 @@ const (
 	LCDC = 0xFF40
 )
 
-// Update the state of the graphics.
-func (gb *Gameboy) updateGraphics(cycles int) {
-	gb.setLCDStatus()
+const (
+	// Number of dots (clock cycles at normal speed) in each scanline.
+	lineDots = 456
 
-	if !gb.isLCDEnabled() {
-		return
-	}
-	gb.scanlineCounter -= cycles
+	// Number of dots taken by the OAM scan at the start of each line.
+	oamScanDots = 80
 
-	if gb.scanlineCounter <= 0 {
-		gb.memory.HighRAM[0x44]++
-		if gb.memory.HighRAM[0x44] > 153 {
-			gb.PreparedData = gb.screenData
-			gb.screenData = [ScreenWidth][ScreenHeight][3]uint8{}
-			gb.bgPriority = [ScreenWidth][ScreenHeight]bool{}
-			gb.memory.HighRAM[0x44] = 0
-		}
+	// Number of dots the fetcher takes to read a tile number and the two
+	// bytes of tile data for the next 8 background pixels.
+	tileFetchDots = 6
 
-		currentLine := gb.memory.ReadHighRam(0xFF44)
-		gb.scanlineCounter += 456 * gb.getSpeed()
+	// Number of dots taken to fetch a row of sprite data once the background
+	// fetcher has finished its current step.
+	spriteFetchDots = 6
 
-		if currentLine == ScreenHeight {
-			gb.requestInterrupt(0)
-		}
-	}
-}
+	// Maximum number of sprites which are drawn on each line.
+	maxLineSprites = 10
 
-const (
-	lcdMode2Bounds = 456 - 80
-	lcdMode3Bounds = lcdMode2Bounds - 172
+	// Value of the penalised tile when no sprite has been fetched on a line.
+	noPenaltyTile = -1 << 16
 )
 
-// Set the status of the LCD based on the current state of memory.
-func (gb *Gameboy) setLCDStatus() {
-	status := gb.memory.HighRAM[0x41]
-
-	if !gb.isLCDEnabled() {
-		// set the screen to white
-		gb.clearScreen()
+// Modes of the PPU which are reported in the lower two bits of STAT.
+const (
+	modeHBlank   byte = 0
+	modeVBlank   byte = 1
+	modeOAMScan  byte = 2
+	modeTransfer byte = 3
+)
 
-		gb.scanlineCounter = 456
-		gb.memory.HighRAM[0x44] = 0
-		status &= 252
-		// TODO: Check this is correct
-		// We aren't in a mode so reset the values
-		status = bitReset(status, 0)
-		status = bitReset(status, 1)
-		gb.memory.Write(0xFF41, status)
-		return
-	}
-	gb.screenCleared = false
+// A pixel in the background FIFO.
+type bgPixel struct {
+	Colour byte
+	// CGB palette number and BG-to-OAM priority from the tile attributes.
+	Palette  byte
+	Priority bool
+}
 
-	currentLine := gb.memory.HighRAM[0x44]
-	currentMode := status & 0x3
+// A pixel in the sprite FIFO.
+type spritePixel struct {
+	Colour byte
+	// Palette number, which is OBP0 or OBP1 in DMG mode.
+	Palette byte
+	// If the background is drawn over this pixel when it is not colour 0.
+	BehindBG bool
+	// Index of the sprite in OAM, used for priority in CGB mode.
+	OAMIndex byte
+}
 
-	var mode byte
-	requestInterrupt := false
+// A sprite found on the current line by the OAM scan.
+type lineSprite struct {
+	OAMIndex   byte
+	Y, X       byte
+	Tile       byte
+	Attributes byte
+	Fetched    bool
+}
 
-	switch {
-	case currentLine >= 144:
-		mode = 1
-		status = bitSet(status, 0)
-		status = bitReset(status, 1)
-		requestInterrupt = bitTest(status, 4)
-	case gb.scanlineCounter >= lcdMode2Bounds:
-		mode = 2
-		status = bitReset(status, 0)
-		status = bitSet(status, 1)
-		requestInterrupt = bitTest(status, 5)
-	case gb.scanlineCounter >= lcdMode3Bounds:
-		mode = 3
-		status = bitSet(status, 0)
-		status = bitSet(status, 1)
-		if mode != currentMode {
-			// Draw the scanline when we start mode 3. In the real GameBoy
-			// this would be done throughout mode 3 by reading OAM and VRAM
-			// to generate the picture.
-			gb.drawScanline(currentLine)
-		}
-	default:
-		mode = 0
-		status = bitReset(status, 0)
-		status = bitReset(status, 1)
-		requestInterrupt = bitTest(status, 3)
-		if mode != currentMode {
-			gb.memory.doHDMATransfer()
-		}
-	}
+// ppu is the state of the pixel processing unit. At the start of each line
+// the OAM is scanned for the sprites on the line, then during mode 3 pixels
+// are shifted out to the LCD one per dot from a background FIFO, which is
+// filled by the tile fetcher, mixed with a sprite FIFO, which is filled when
+// the position of a sprite is reached. Registers are read as pixels are
+// fetched and output, so writes during mode 3 take effect part way along the
+// line, and the length of mode 3 depends on the scroll, window and sprites.
+type ppu struct {
+	// Number of dots since the start of the current line, and the number of
+	// the current line. This is the same as LY except at the end of line 153.
+	Dot  int
+	Line int
+	// Current mode of the PPU.
+	Mode byte
+
+	// If this is the first line after the LCD was turned on, which starts
+	// without the OAM scan mode being reported or its interrupt requested.
+	FirstLine bool
+
+	// State of the combined STAT interrupt line, which requests the LCD
+	// interrupt when it goes from low to high.
+	StatLine bool
+
+	// Sprites on the current line in OAM order.
+	Sprites    [maxLineSprites]lineSprite
+	NumSprites int
+
+	// X coordinate of the next pixel to be output to the LCD.
+	X int
+	// Number of pixels still to be discarded at the start of the line for
+	// the fine scroll of SCX.
+	Discard int
+	// Number of dots remaining until the pixel pipeline resumes after
+	// fetching sprites.
+	Stall int
+
+	// Background pixels waiting to be output. The FIFO is only filled when
+	// it is empty, so the next pixel is at 8-BGCount.
+	BGFIFO  [8]bgPixel
+	BGCount int
+
+	// Sprite pixels to be mixed with the next 8 background pixels.
+	SpriteFIFO [8]spritePixel
+
+	// Tile column being fetched, relative to the start of the line or the
+	// window, and the number of dots spent fetching it.
+	FetchX    int
+	FetchDots int
+
+	// Tile column which was last waited for by a sprite fetch.
+	PenaltyTile int
+
+	// If LY has matched WY this frame, if the window is being drawn on the
+	// current line and the internal counter of window lines drawn.
+	WindowTriggered bool
+	WindowActive    bool
+	WindowLine      int
+}
 
-	if requestInterrupt && mode != currentMode {
-		gb.requestInterrupt(1)
+// Update the state of the graphics.
+func (gb *Gameboy) updateGraphics(cycles int) {
+	if !gb.isLCDEnabled() {
+		gb.disableLCD()
+		return
 	}
+	gb.screenCleared = false
 
-	// Check if LYC == LY (coincidence flag)
-	if currentLine == gb.memory.HighRAM[0x45] {
-		status = bitSet(status, 2)
-		// If enabled request an interrupt for this
-		if bitTest(status, 6) {
-			gb.requestInterrupt(1)
-		}
-	} else {
-		status = bitReset(status, 2)
+	// The PPU runs at the same rate in double speed mode
+	for i := 0; i < cycles/gb.getSpeed(); i++ {
+		gb.tickPPU()
 	}
-
-	gb.memory.Write(0xFF41, status)
 }
 
 // Checks if the LCD is enabled by examining 0xFF40.
@@ -123,278 +147,449 @@ func (gb *Gameboy) isLCDEnabled() bool {
 	return bitTest(gb.memory.HighRAM[0x40], 7)
 }
 
-// Draw a single scanline to the graphics output.
-func (gb *Gameboy) drawScanline(scanline byte) {
-	control := gb.memory.ReadHighRam(LCDC)
+// Reset the PPU while the LCD is turned off. When it is turned back on the
+// first line starts at the beginning of the OAM scan, but the mode in STAT
+// stays at 0 until pixel transfer starts.
+func (gb *Gameboy) disableLCD() {
+	// set the screen to white
+	gb.clearScreen()
+
+	// The STAT interrupt line holds its state until the LCD is turned back on
+	gb.ppu = ppu{Mode: modeOAMScan, FirstLine: true, StatLine: gb.ppu.StatLine}
+	gb.memory.HighRAM[0x44] = 0
+	gb.memory.HighRAM[0x41] &^= 0x3
+}
 
-	// LCDC bit 0 clears tiles on DMG but controls priority on CGB.
-	if (gb.IsCGB() || bitTest(control, 0)) && !gb.Debug.HideBackground {
-		gb.renderTiles(control, scanline)
+// Advance the PPU by a single dot.
+func (gb *Gameboy) tickPPU() {
+	p := &gb.ppu
+	if p.Mode == modeTransfer {
+		gb.tickTransfer()
+		if p.X == ScreenWidth {
+			gb.setMode(modeHBlank)
+		}
 	}
 
-	if bitTest(control, 1) && !gb.Debug.HideSprites {
-		gb.renderSprites(control, int32(scanline))
+	p.Dot++
+	switch {
+	case p.Dot == lineDots:
+		p.Dot = 0
+		gb.nextLine()
+	case p.Mode == modeOAMScan && p.Dot == oamScanDots:
+		gb.scanOAM()
+		gb.startTransfer()
+	case p.Line == 153 && p.Dot == 4:
+		// LY only reads as 153 for the first few dots of the last line
+		gb.memory.HighRAM[0x44] = 0
 	}
+	gb.updateStatLine()
 }
 
-// Get settings to be used when rendering tiles.
-func (gb *Gameboy) getTileSettings(lcdControl byte, windowY byte) (
-	usingWindow bool,
-	unsigned bool,
-	tileData uint16,
-	backgroundMemory uint16,
-) {
-	tileData = uint16(0x8800)
-
-	if bitTest(lcdControl, 5) {
-		// Is current scanline we're drawing within windows Y position?
-		if windowY <= gb.memory.ReadHighRam(0xFF44) {
-			usingWindow = true
-		}
+// Move on to the next line, entering V-Blank after the last visible line.
+func (gb *Gameboy) nextLine() {
+	p := &gb.ppu
+	p.FirstLine = false
+	if p.WindowActive {
+		p.WindowActive = false
+		p.WindowLine++
 	}
 
-	// Test if we're using unsigned bytes
-	if bitTest(lcdControl, 4) {
-		tileData = 0x8000
-		unsigned = true
+	p.Line++
+	if p.Line > 153 {
+		p.Line = 0
+		p.WindowTriggered = false
+		p.WindowLine = 0
 	}
+	gb.memory.HighRAM[0x44] = byte(p.Line)
 
-	// Work out where to look in background memory.
-	var testBit byte = 3
-	if usingWindow {
-		testBit = 6
-	}
-	backgroundMemory = uint16(0x9800)
-	if bitTest(lcdControl, testBit) {
-		backgroundMemory = 0x9C00
+	switch {
+	case p.Line == ScreenHeight:
+		gb.PreparedData = gb.screenData
+		gb.setMode(modeVBlank)
+		gb.requestInterrupt(0)
+	case p.Line < ScreenHeight:
+		gb.setMode(modeOAMScan)
 	}
-	return
 }
 
-// Render a scanline of the tile map to the graphics output based
-// on the state of the lcdControl register.
-func (gb *Gameboy) renderTiles(lcdControl byte, scanline byte) {
-	scrollY := gb.memory.ReadHighRam(0xFF42)
-	scrollX := gb.memory.ReadHighRam(0xFF43)
-	windowY := gb.memory.ReadHighRam(0xFF4A)
-	windowX := gb.memory.ReadHighRam(0xFF4B) - 7
-
-	usingWindow, unsigned, tileData, backgroundMemory := gb.getTileSettings(lcdControl, windowY)
+// Set the current mode of the PPU in STAT.
+func (gb *Gameboy) setMode(mode byte) {
+	gb.ppu.Mode = mode
+	gb.memory.HighRAM[0x41] = gb.memory.HighRAM[0x41]&^0x3 | mode
+	if mode == modeHBlank {
+		gb.doHDMATransfer()
+	}
+}
 
-	// yPos is used to calc which of 32 v-lines the current scanline is drawing
-	var yPos byte
-	if !usingWindow {
-		yPos = scrollY + scanline
+// Update the LY=LYC coincidence flag in STAT and the combined STAT interrupt
+// line. The LCD interrupt is only requested when the line goes from low to
+// high, so a source which becomes active while another enabled source is
+// still active does not request another interrupt.
+func (gb *Gameboy) updateStatLine() {
+	p := &gb.ppu
+	status := gb.memory.HighRAM[0x41]
+	if gb.memory.HighRAM[0x44] == gb.memory.HighRAM[0x45] {
+		status = bitSet(status, 2)
 	} else {
-		yPos = scanline - windowY
+		status = bitReset(status, 2)
 	}
+	gb.memory.HighRAM[0x41] = status
+
+	line := bitTest(status, 6) && bitTest(status, 2)
+	switch p.Mode {
+	case modeHBlank:
+		line = line || bitTest(status, 3)
+	case modeVBlank:
+		// The OAM source is also active as V-Blank starts
+		line = line || bitTest(status, 4) || (bitTest(status, 5) && p.Line == ScreenHeight && p.Dot == 0)
+	case modeOAMScan:
+		line = line || (bitTest(status, 5) && !p.FirstLine)
+	}
+	if line && !p.StatLine {
+		gb.requestInterrupt(1)
+	}
+	p.StatLine = line
+}
 
-	// which of the 8 vertical pixels of the current tile is the scanline on?
-	var tileRow = uint16(yPos/8) * 32
-
-	// Load the palette which will be used to draw the tiles
-	var palette = gb.memory.ReadHighRam(0xFF47)
+// Write to the STAT register, where only the interrupt source bits are
+// writable. On the DMG the write briefly enables every source, which
+// requests an interrupt if in H-Blank, V-Blank or LY=LYC and the line was low.
+func (gb *Gameboy) writeSTAT(value byte) {
+	if gb.isLCDEnabled() && !gb.IsCGB() {
+		gb.memory.HighRAM[0x41] |= 0x78
+		gb.updateStatLine()
+	}
+	gb.memory.HighRAM[0x41] = value&0x78 | gb.memory.HighRAM[0x41]&0x07 | 0x80
+	if gb.isLCDEnabled() {
+		gb.updateStatLine()
+	}
+}
 
-	// start drawing the 160 horizontal pixels for this scanline
-	gb.tileScanline = [160]uint8{}
-	for pixel := byte(0); pixel < 160; pixel++ {
-		xPos := pixel + scrollX
+// Find the sprites which are on the current line. Only the first 10 sprites
+// in OAM are drawn.
+func (gb *Gameboy) scanOAM() {
+	p := &gb.ppu
+	height := 8
+	if bitTest(gb.memory.HighRAM[0x40], 2) {
+		height = 16
+	}
+	line := int(gb.memory.HighRAM[0x44])
 
-		// Translate the current x pos to window space if necessary
-		if usingWindow && pixel >= windowX {
-			xPos = pixel - windowX
+	p.NumSprites = 0
+	if gb.oamDMA.Active {
+		// OAM cannot be read by the PPU during OAM DMA
+		return
+	}
+	for i := 0; i < 40 && p.NumSprites < maxLineSprites; i++ {
+		entry := gb.memory.OAM[i*4 : i*4+4]
+		y := int(entry[0]) - 16
+		if line < y || line >= y+height {
+			continue
+		}
+		p.Sprites[p.NumSprites] = lineSprite{
+			OAMIndex:   byte(i),
+			Y:          entry[0],
+			X:          entry[1],
+			Tile:       entry[2],
+			Attributes: entry[3],
 		}
+		p.NumSprites++
+	}
+}
 
-		// Which of the 32 horizontal tiles does this x_pox fall within?
-		tileCol := uint16(xPos / 8)
+// Reset the pixel pipeline and start mode 3. The first tile fetch of each
+// line is thrown away, so no pixels are output for the first 12 dots.
+func (gb *Gameboy) startTransfer() {
+	p := &gb.ppu
+	p.X = 0
+	p.Discard = int(gb.memory.HighRAM[0x43] & 0x7)
+	p.Stall = 0
+	p.BGCount = 0
+	p.SpriteFIFO = [8]spritePixel{}
+	p.FetchX = 0
+	p.FetchDots = -tileFetchDots
+	p.PenaltyTile = noPenaltyTile
+	if gb.memory.HighRAM[0x44] == gb.memory.HighRAM[0x4A] {
+		p.WindowTriggered = true
+	}
+	gb.setMode(modeTransfer)
+}
 
-		// Get the tile identity number
-		tileAddress := backgroundMemory + tileRow + tileCol
+// Advance the pixel pipeline by one dot during mode 3.
+func (gb *Gameboy) tickTransfer() {
+	p := &gb.ppu
+	if p.Stall > 0 {
+		p.Stall--
+		return
+	}
+	control := gb.memory.HighRAM[0x40]
+
+	// Switch the fetcher to the window when its left edge is reached
+	windowX := int(gb.memory.HighRAM[0x4B]) - 7
+	if p.BGCount > 0 && !p.WindowActive && p.WindowTriggered && bitTest(control, 5) && p.X >= windowX {
+		p.WindowActive = true
+		p.BGCount = 0
+		p.Discard = 0
+		p.FetchX = 0
+		p.FetchDots = 0
+	}
 
-		// Deduce where this tile id is in memory
-		tileLocation := tileData
-		if unsigned {
-			tileNum := int16(gb.memory.VRAM[tileAddress-0x8000])
-			tileLocation = tileLocation + uint16(tileNum*16)
-		} else {
-			tileNum := int16(int8(gb.memory.VRAM[tileAddress-0x8000]))
-			tileLocation = uint16(int32(tileLocation) + int32((tileNum+128)*16))
+	if p.BGCount > 0 {
+		switch {
+		case p.Discard > 0:
+			p.BGCount--
+			p.Discard--
+		case gb.fetchSprites(control):
+			// The fetcher is paused while the sprites are fetched
+			return
+		default:
+			gb.outputPixel(control)
 		}
+	}
 
-		bankOffset := uint16(0x8000)
-
-		// Attributes used in CGB mode TODO: check in CGB mode
-		//
-		//    Bit 0-2  Background Palette number  (BGP0-7)
-		//    Bit 3    Tile VRAM Bank number      (0=Bank 0, 1=Bank 1)
-		//    Bit 5    Horizontal Flip            (0=Normal, 1=Mirror horizontally)
-		//    Bit 6    Vertical Flip              (0=Normal, 1=Mirror vertically)
-		//    Bit 7    BG-to-OAM Priority         (0=Use OAM priority bit, 1=BG Priority)
-		//
-		tileAttr := gb.memory.VRAM[tileAddress-0x6000]
-		if gb.IsCGB() && bitTest(tileAttr, 3) {
-			bankOffset = 0x6000
-		}
-		priority := bitTest(tileAttr, 7)
+	p.FetchDots++
+	if p.FetchDots >= tileFetchDots && p.BGCount == 0 {
+		p.BGFIFO = gb.fetchTile(control)
+		p.BGCount = 8
+		p.FetchX++
+		p.FetchDots = 0
+	}
+}
 
-		var line byte
-		if gb.IsCGB() && bitTest(tileAttr, 6) {
-			// Vertical flip
-			line = ((7 - yPos) % 8) * 2
-		} else {
-			line = (yPos % 8) * 2
+// Fetch the next 8 pixels of the background or window for the current line.
+func (gb *Gameboy) fetchTile(control byte) [8]bgPixel {
+	p := &gb.ppu
+	var mapAddress uint16 = 0x1800
+	var x, y byte
+	if p.WindowActive {
+		if bitTest(control, 6) {
+			mapAddress = 0x1C00
 		}
-		// Get the tile data from memory
-		data1 := gb.memory.VRAM[tileLocation+uint16(line)-bankOffset]
-		data2 := gb.memory.VRAM[tileLocation+uint16(line)+1-bankOffset]
-
-		if gb.IsCGB() && bitTest(tileAttr, 5) {
-			// Horizontal flip
-			xPos = 7 - xPos
+		x = byte(p.FetchX)
+		y = byte(p.WindowLine)
+	} else {
+		if bitTest(control, 3) {
+			mapAddress = 0x1C00
 		}
-		colourBit := byte(int8((xPos%8)-7) * -1)
-		colourNum := (bitGet(data2, colourBit) << 1) | bitGet(data1, colourBit)
-		gb.setTilePixel(pixel, scanline, tileAttr, colourNum, palette, priority)
+		x = gb.memory.HighRAM[0x43]/8 + byte(p.FetchX)
+		y = gb.memory.HighRAM[0x44] + gb.memory.HighRAM[0x42]
 	}
-}
-
-func (gb *Gameboy) setTilePixel(x, y, tileAttr, colourNum, palette byte, priority bool) {
-	// Set the pixel
+	mapAddress += uint16(y/8)*32 + uint16(x&31)
+	tileNum := gb.memory.VRAM[mapAddress]
+
+	// Attributes used in CGB mode, which are stored in VRAM bank 1
+	//
+	//    Bit 0-2  Background Palette number  (BGP0-7)
+	//    Bit 3    Tile VRAM Bank number      (0=Bank 0, 1=Bank 1)
+	//    Bit 5    Horizontal Flip            (0=Normal, 1=Mirror horizontally)
+	//    Bit 6    Vertical Flip              (0=Normal, 1=Mirror vertically)
+	//    Bit 7    BG-to-OAM Priority         (0=Use OAM priority bit, 1=BG Priority)
+	//
+	var tileAttr byte
 	if gb.IsCGB() {
-		cgbPalette := tileAttr & 0x7
-		red, green, blue := gb.bgPalette.get(cgbPalette, colourNum)
-		gb.setPixel(x, y, red, green, blue, true)
-		gb.bgPriority[x][y] = priority
+		tileAttr = gb.memory.VRAM[mapAddress+0x2000]
+	}
+
+	// Deduce where the tile data is in memory
+	var tileAddress uint16
+	if bitTest(control, 4) {
+		tileAddress = uint16(tileNum) * 16
 	} else {
-		red, green, blue := gb.getColour(colourNum, palette)
-		gb.setPixel(x, y, red, green, blue, true)
+		tileAddress = uint16(0x1000 + int(int8(tileNum))*16)
+	}
+	row := y % 8
+	if bitTest(tileAttr, 6) {
+		row = 7 - row
+	}
+	tileAddress += uint16(row) * 2
+	if bitTest(tileAttr, 3) {
+		tileAddress += 0x2000
 	}
+	data1 := gb.memory.VRAM[tileAddress]
+	data2 := gb.memory.VRAM[tileAddress+1]
+
+	var pixels [8]bgPixel
+	for i := byte(0); i < 8; i++ {
+		colourBit := 7 - i
+		if bitTest(tileAttr, 5) {
+			colourBit = i
+		}
+		pixels[i] = bgPixel{
+			Colour:   (bitGet(data2, colourBit) << 1) | bitGet(data1, colourBit),
+			Palette:  tileAttr & 0x7,
+			Priority: bitTest(tileAttr, 7),
+		}
+	}
+	return pixels
+}
 
-	// Store for the current scanline so sprite priority can be managed
-	gb.tileScanline[x] = colourNum
+// Fetch any sprites which start at the next pixel into the sprite FIFO.
+// Returns true if the pipeline has been stalled to fetch them.
+func (gb *Gameboy) fetchSprites(control byte) bool {
+	p := &gb.ppu
+	if !bitTest(control, 1) {
+		return false
+	}
+	penalty := 0
+	for i := 0; i < p.NumSprites; i++ {
+		sprite := &p.Sprites[i]
+		if sprite.Fetched || int(sprite.X) > p.X+8 {
+			continue
+		}
+		sprite.Fetched = true
+		penalty += gb.spritePenalty(sprite)
+		gb.fetchSprite(sprite, control)
+	}
+	if penalty == 0 {
+		return false
+	}
+	// This dot is the first of the penalty
+	p.Stall = penalty - 1
+	return true
 }
 
-// Get the RGB colour value for a colour num at an address using the current palette.
-func (gb *Gameboy) getColour(colourNum byte, palette byte) (uint8, uint8, uint8) {
-	hi := colourNum<<1 | 1
-	lo := colourNum << 1
-	col := (bitGet(palette, hi) << 1) | bitGet(palette, lo)
-	return GetPaletteColour(col)
+// Get the number of dots mode 3 is extended by to fetch a sprite. The
+// fetcher first has to finish fetching the background tile the sprite is
+// over, unless it has already done so for an earlier sprite.
+func (gb *Gameboy) spritePenalty(sprite *lineSprite) int {
+	p := &gb.ppu
+	pixel := int(sprite.X) - 8 + int(gb.memory.HighRAM[0x43])
+	switch {
+	case sprite.X == 0:
+		// Sprites hidden left of the screen always wait for a whole fetch
+		pixel = -8
+	case p.WindowActive:
+		pixel = int(sprite.X) - 1 - int(gb.memory.HighRAM[0x4B])
+	}
+	penalty := spriteFetchDots
+	if tile := pixel >> 3; tile != p.PenaltyTile {
+		p.PenaltyTile = tile
+		if wait := 5 - pixel&7; wait > 0 {
+			penalty += wait
+		}
+	}
+	return penalty
 }
 
-const spritePriorityOffset = 100
+// Fetch the row of a sprite on the current line and mix it into the sprite
+// FIFO. Pixels which are already occupied by a sprite are only replaced in
+// CGB mode by a sprite which is earlier in OAM.
+func (gb *Gameboy) fetchSprite(sprite *lineSprite, control byte) {
+	p := &gb.ppu
+	height := 8
+	tile := sprite.Tile
+	if bitTest(control, 2) {
+		height = 16
+		tile &= 0xFE
+	}
 
-// Render the sprites to the screen on the current scanline using the lcdControl register.
-func (gb *Gameboy) renderSprites(lcdControl byte, scanline int32) {
-	var ySize int32 = 8
-	if bitTest(lcdControl, 2) {
-		ySize = 16
+	// Set the line to draw based on if the sprite is flipped on the y
+	line := int(gb.memory.HighRAM[0x44]) - (int(sprite.Y) - 16)
+	if bitTest(sprite.Attributes, 6) {
+		line = height - line - 1
 	}
 
-	// Load the two palettes which sprites can be drawn in
-	var palette1 = gb.memory.ReadHighRam(0xFF48)
-	var palette2 = gb.memory.ReadHighRam(0xFF49)
+	// Load the data containing the sprite data for this line, from bank 1
+	// if selected in CGB mode
+	dataAddress := uint16(tile)*16 + uint16(line)*2
+	if gb.IsCGB() && bitTest(sprite.Attributes, 3) {
+		dataAddress += 0x2000
+	}
+	data1 := gb.memory.VRAM[dataAddress]
+	data2 := gb.memory.VRAM[dataAddress+1]
 
-	var minx [ScreenWidth]int32
-	var lineSprites = 0
-	for sprite := uint16(0); sprite < 40; sprite++ {
-		// Load sprite data from memory.
-		index := sprite * 4
+	palette := sprite.Attributes & 0x7
+	if !gb.IsCGB() {
+		palette = bitGet(sprite.Attributes, 4)
+	}
 
-		// If this is true the scanline is out of the area we care about
-		yPos := int32(gb.memory.Read(uint16(0xFE00+index))) - 16
-		if scanline < yPos || scanline >= (yPos+ySize) {
+	for i := 0; i < 8; i++ {
+		// Pixels left of the screen are not drawn
+		pos := int(sprite.X) - 8 + i - p.X
+		if pos < 0 || pos >= 8 {
 			continue
 		}
+		colourBit := byte(7 - i)
+		if bitTest(sprite.Attributes, 5) {
+			colourBit = byte(i)
+		}
 
-		// Only 10 sprites are allowed to be displayed on each line
-		if lineSprites >= 10 {
-			break
+		// Colour 0 is transparent for sprites
+		colourNum := (bitGet(data2, colourBit) << 1) | bitGet(data1, colourBit)
+		if colourNum == 0 {
+			continue
 		}
-		lineSprites++
 
-		xPos := int32(gb.memory.Read(uint16(0xFE00+index+1))) - 8
-		tileLocation := gb.memory.Read(uint16(0xFE00 + index + 2))
-		attributes := gb.memory.Read(uint16(0xFE00 + index + 3))
+		// In DMG mode the sprite with the smallest X coordinate, then the
+		// first in OAM, has priority. As sprites are fetched from left to
+		// right this is the first sprite to reach the FIFO. In CGB mode the
+		// first sprite in OAM has priority.
+		current := p.SpriteFIFO[pos]
+		if current.Colour != 0 && (!gb.IsCGB() || current.OAMIndex < sprite.OAMIndex) {
+			continue
+		}
+		p.SpriteFIFO[pos] = spritePixel{
+			Colour:   colourNum,
+			Palette:  palette,
+			BehindBG: bitTest(sprite.Attributes, 7),
+			OAMIndex: sprite.OAMIndex,
+		}
+	}
+}
 
-		yFlip := bitTest(attributes, 6)
-		xFlip := bitTest(attributes, 5)
-		priority := !bitTest(attributes, 7)
+// Shift the next pixel out of the FIFOs and draw it to the screen.
+func (gb *Gameboy) outputPixel(control byte) {
+	p := &gb.ppu
+	bg := p.BGFIFO[8-p.BGCount]
+	p.BGCount--
+	sprite := p.SpriteFIFO[0]
+	copy(p.SpriteFIFO[:], p.SpriteFIFO[1:])
+	p.SpriteFIFO[7] = spritePixel{}
 
-		// Bank the sprite data in is (CGB only)
-		var bank uint16 = 0
-		if gb.IsCGB() && bitTest(attributes, 3) {
-			bank = 1
-		}
+	// LCDC bit 0 clears tiles on DMG but controls priority on CGB.
+	bgVisible := (gb.IsCGB() || bitTest(control, 0)) && !gb.Debug.HideBackground
+	if !bgVisible {
+		bg.Colour = 0
+	}
 
-		// Set the line to draw based on if the sprite is flipped on the y
-		line := scanline - yPos
-		if yFlip {
-			line = ySize - line - 1
+	drawSprite := sprite.Colour != 0 && bitTest(control, 1) && !gb.Debug.HideSprites
+	if drawSprite && bg.Colour != 0 {
+		if gb.IsCGB() {
+			drawSprite = !bitTest(control, 0) || !(bg.Priority || sprite.BehindBG)
+		} else {
+			drawSprite = !sprite.BehindBG
 		}
+	}
 
-		// Load the data containing the sprite data for this line
-		dataAddress := (uint16(tileLocation) * 16) + uint16(line*2) + (bank * 0x2000)
-		data1 := gb.memory.VRAM[dataAddress]
-		data2 := gb.memory.VRAM[dataAddress+1]
-
-		// Draw the line of the sprite
-		for tilePixel := byte(0); tilePixel < 8; tilePixel++ {
-			pixel := int16(xPos) + int16(7-tilePixel)
-			if pixel < 0 || pixel >= ScreenWidth {
-				continue
-			}
-
-			// Check if the pixel has priority.
-			//  - In DMG this is determined by the sprite with the smallest X coordinate,
-			//    then the first sprite in the OAM.
-			//  - In CGB this is determined by the first sprite appearing in the OAM.
-			// We add a fixed 100 to the xPos so we can use the 0 value as the absence of a sprite.
-			if minx[pixel] != 0 && (gb.IsCGB() || minx[pixel] <= xPos+spritePriorityOffset) {
-				continue
-			}
-
-			colourBit := tilePixel
-			if xFlip {
-				colourBit = byte(int8(colourBit-7) * -1)
-			}
-
-			// Find the colour value by combining the data bits
-			colourNum := (bitGet(data2, colourBit) << 1) | bitGet(data1, colourBit)
-
-			// Colour 0 is transparent for sprites
-			if colourNum == 0 {
-				continue
-			}
-
-			if gb.IsCGB() {
-				cgbPalette := attributes & 0x7
-				red, green, blue := gb.spritePalette.get(cgbPalette, colourNum)
-				gb.setPixel(byte(pixel), byte(scanline), red, green, blue, priority)
-			} else {
-				// Determine the colour palette to use
-				var palette = palette1
-				if bitTest(attributes, 4) {
-					palette = palette2
-				}
-				red, green, blue := gb.getColour(colourNum, palette)
-				gb.setPixel(byte(pixel), byte(scanline), red, green, blue, priority)
-			}
-
-			// Store the xpos of the sprite for this pixel for priority resolution
-			minx[pixel] = xPos + spritePriorityOffset
+	var red, green, blue uint8
+	switch {
+	case drawSprite && gb.IsCGB():
+		red, green, blue = gb.spritePalette.get(sprite.Palette, sprite.Colour)
+	case drawSprite:
+		palette := gb.memory.HighRAM[0x48]
+		if sprite.Palette == 1 {
+			palette = gb.memory.HighRAM[0x49]
 		}
+		red, green, blue = gb.getColour(sprite.Colour, palette)
+	case !bgVisible:
+		red, green, blue = GetPaletteColour(0)
+	case gb.IsCGB():
+		red, green, blue = gb.bgPalette.get(bg.Palette, bg.Colour)
+	default:
+		red, green, blue = gb.getColour(bg.Colour, gb.memory.HighRAM[0x47])
 	}
+
+	line := gb.memory.HighRAM[0x44]
+	gb.screenData[p.X][line] = [3]uint8{red, green, blue}
+	p.X++
 }
 
-// Set a pixel in the graphics screen data.
-func (gb *Gameboy) setPixel(x byte, y byte, r uint8, g uint8, b uint8, priority bool) {
-	// If priority is false then sprite pixel is only set if tile colour is 0
-	if (priority && !gb.bgPriority[x][y]) || gb.tileScanline[x] == 0 {
-		gb.screenData[x][y][0] = r
-		gb.screenData[x][y][1] = g
-		gb.screenData[x][y][2] = b
-	}
+// Get the RGB colour value for a colour num at an address using the current palette.
+func (gb *Gameboy) getColour(colourNum byte, palette byte) (uint8, uint8, uint8) {
+	hi := colourNum<<1 | 1
+	lo := colourNum << 1
+	col := (bitGet(palette, hi) << 1) | bitGet(palette, lo)
+	return GetPaletteColour(col)
 }
 
 // Clear the screen by setting every pixel to white.
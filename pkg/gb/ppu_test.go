@@ -8,6 +8,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -56,6 +57,111 @@ func TestSpritePriority(t *testing.T) {
 	}
 }
 
+// Create a Gameboy with the LCD just turned on, with the background using
+// the tile data at 0x8000 and sprites enabled.
+func newLCDGameboy(t *testing.T) *Gameboy {
+	gb := newProgramGameboy(t, []byte{0x18, 0xFE}, nil)
+	gb.memory.HighRAM[0x40] = 0
+	gb.updateGraphics(4)
+	gb.memory.HighRAM[0x40] = 0x93
+	return gb
+}
+
+// Run the PPU until the end of the next mode 3 and return its length in dots.
+func mode3Length(gb *Gameboy) int {
+	for gb.ppu.Mode != modeTransfer {
+		gb.tickPPU()
+	}
+	dots := 0
+	for gb.ppu.Mode == modeTransfer {
+		gb.tickPPU()
+		dots++
+	}
+	return dots
+}
+
+func TestPPU_Mode3Length(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(gb *Gameboy)
+		expected int
+	}{
+		{"no sprites", func(gb *Gameboy) {}, 172},
+		{"scx", func(gb *Gameboy) { gb.memory.HighRAM[0x43] = 3 }, 175},
+		{"sprite aligned", func(gb *Gameboy) {
+			copy(gb.memory.OAM[:], []byte{16, 8, 0, 0})
+		}, 183},
+		{"two sprites on one tile", func(gb *Gameboy) {
+			copy(gb.memory.OAM[:], []byte{16, 8, 0, 0, 16, 10, 0, 0})
+		}, 189},
+		{"sprite unaligned", func(gb *Gameboy) {
+			copy(gb.memory.OAM[:], []byte{16, 12, 0, 0})
+		}, 179},
+		{"sprite hidden left", func(gb *Gameboy) {
+			copy(gb.memory.OAM[:], []byte{16, 0, 0, 0})
+		}, 183},
+		{"sprites disabled", func(gb *Gameboy) {
+			copy(gb.memory.OAM[:], []byte{16, 8, 0, 0})
+			gb.memory.HighRAM[0x40] &^= 0x2
+		}, 172},
+		{"window", func(gb *Gameboy) {
+			gb.memory.HighRAM[0x40] |= 0x20
+			gb.memory.HighRAM[0x4A] = 0
+			gb.memory.HighRAM[0x4B] = 7
+		}, 178},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gb := newLCDGameboy(t)
+			test.setup(gb)
+			assert.Equal(t, test.expected, mode3Length(gb))
+			assert.Equal(t, modeHBlank, gb.memory.ReadHighRam(0xFF41)&0x3)
+		})
+	}
+}
+
+func TestPPU_MidScanlinePalette(t *testing.T) {
+	gb := newLCDGameboy(t)
+	// Tile 0 is filled with colour 3
+	for i := 0; i < 16; i++ {
+		gb.memory.VRAM[i] = 0xFF
+	}
+	gb.memory.HighRAM[0x47] = 0xE4
+
+	for gb.ppu.Mode != modeTransfer || gb.ppu.X < ScreenWidth/2 {
+		gb.tickPPU()
+	}
+	gb.memory.Write(0xFF47, 0x00)
+	mode3Length(gb)
+
+	r, g, b := GetPaletteColour(3)
+	assert.Equal(t, [3]uint8{r, g, b}, gb.screenData[0][0], "pixels before the write use the old palette")
+	r, g, b = GetPaletteColour(0)
+	assert.Equal(t, [3]uint8{r, g, b}, gb.screenData[ScreenWidth-1][0], "pixels after the write use the new palette")
+}
+
+func TestPPU_MidScanlineScroll(t *testing.T) {
+	gb := newLCDGameboy(t)
+	// Tile 1 is filled with colour 3 and is the second tile in the map
+	for i := 16; i < 32; i++ {
+		gb.memory.VRAM[i] = 0xFF
+	}
+	gb.memory.VRAM[0x1801] = 1
+	gb.memory.HighRAM[0x47] = 0xE4
+
+	for gb.ppu.Mode != modeTransfer || gb.ppu.X < 40 {
+		gb.tickPPU()
+	}
+	gb.memory.Write(0xFF43, 0x50)
+	mode3Length(gb)
+
+	black, white := gb.screenData[8][0], gb.screenData[0][0]
+	assert.NotEqual(t, white, black)
+	for x := 40; x < ScreenWidth; x++ {
+		assert.Equal(t, white, gb.screenData[x][0], "pixel %v should be scrolled", x)
+	}
+}
+
 // Load a PNG image
 func loadImage(filename string) (image.Image, error) {
 	file, err := os.Open(filename)
@@ -0,0 +1,227 @@
+package gb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValueType is how a value in memory is read by a RAM search or a watch.
+// 16 bit values are little endian.
+type ValueType byte
+
+const (
+	// Uint8 is an unsigned 8 bit value.
+	Uint8 ValueType = iota
+	// Int8 is a signed 8 bit value.
+	Int8
+	// Uint16 is an unsigned 16 bit value.
+	Uint16
+	// Int16 is a signed 16 bit value.
+	Int16
+)
+
+// Names of the value types, which are used by ParseValueType.
+var valueTypeNames = map[ValueType]string{
+	Uint8:  "u8",
+	Int8:   "s8",
+	Uint16: "u16",
+	Int16:  "s16",
+}
+
+func (t ValueType) String() string {
+	return valueTypeNames[t]
+}
+
+// ParseValueType parses the name of a value type, which is u8, s8, u16 or
+// s16.
+func ParseValueType(name string) (ValueType, error) {
+	for t, typeName := range valueTypeNames {
+		if strings.EqualFold(name, typeName) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown value type %q, expected u8, s8, u16 or s16", name)
+}
+
+// Size returns the number of bytes in the value.
+func (t ValueType) Size() int {
+	if t == Uint16 || t == Int16 {
+		return 2
+	}
+	return 1
+}
+
+// Read a value from the memory as seen by the CPU, without triggering
+// watchpoints.
+func (gb *Gameboy) readValue(address uint16, t ValueType) int {
+	value := int(gb.memory.read(address))
+	if t.Size() == 2 {
+		value |= int(gb.memory.read(address+1)) << 8
+	}
+	switch t {
+	case Int8:
+		return int(int8(value))
+	case Int16:
+		return int(int16(value))
+	}
+	return value
+}
+
+// SearchRegion is a region of memory which is included in a RAM search.
+type SearchRegion byte
+
+const (
+	// SearchCartRAM is the cartridge RAM at 0xA000-0xBFFF. The bank which
+	// is currently mapped is searched, and the values are 0xFF if the RAM
+	// is not enabled.
+	SearchCartRAM SearchRegion = 1 << iota
+	// SearchWRAM is the work RAM at 0xC000-0xDFFF, including the bank
+	// which is currently mapped at 0xD000.
+	SearchWRAM
+	// SearchHRAM is the high RAM at 0xFF80-0xFFFE.
+	SearchHRAM
+	// SearchAllRAM is all of the regions of RAM.
+	SearchAllRAM = SearchCartRAM | SearchWRAM | SearchHRAM
+)
+
+// Inclusive address ranges of each search region.
+var searchRegionRanges = []struct {
+	region     SearchRegion
+	start, end uint16
+}{
+	{SearchCartRAM, 0xA000, 0xBFFF},
+	{SearchWRAM, 0xC000, 0xDFFF},
+	{SearchHRAM, 0xFF80, 0xFFFE},
+}
+
+// SearchFilter is a comparison used to filter the results of a RAM search.
+type SearchFilter byte
+
+const (
+	// SearchChanged keeps values which have changed since the last filter.
+	SearchChanged SearchFilter = iota
+	// SearchUnchanged keeps values which are equal to the last filter.
+	SearchUnchanged
+	// SearchIncreased keeps values which are greater than the last filter.
+	SearchIncreased
+	// SearchDecreased keeps values which are less than the last filter.
+	SearchDecreased
+	// SearchEqual keeps values which are equal to a specific value.
+	SearchEqual
+	// SearchNotEqual keeps values which are not equal to a specific value.
+	SearchNotEqual
+)
+
+// SearchResult is an address which matches a RAM search.
+type SearchResult struct {
+	Address uint16
+	// Value is the current value at the address.
+	Value int
+	// Previous is the value at the address when the search was last
+	// filtered or snapshotted.
+	Previous int
+}
+
+// RAMSearch finds the addresses of game variables by filtering the values in
+// RAM as they change. A search starts with every address in the regions as a
+// result, and each filter compares the current values with the snapshot from
+// the previous filter, or with a specific value.
+type RAMSearch struct {
+	gb        *Gameboy
+	valueType ValueType
+
+	// Addresses which match the filters so far, and the value at each
+	// address in the last snapshot.
+	addresses []uint16
+	values    []int
+}
+
+// NewRAMSearch starts a RAM search over some regions of RAM, which reads the
+// values as a type. The values are read from the memory as seen by the CPU,
+// so only the cart RAM and WRAM banks which are mapped when the search is
+// snapshotted or filtered are searched. If the game switches banks between
+// filters then different memory is compared at the same address.
+func (gb *Gameboy) NewRAMSearch(t ValueType, regions SearchRegion) *RAMSearch {
+	search := &RAMSearch{gb: gb, valueType: t}
+	for _, r := range searchRegionRanges {
+		if regions&r.region == 0 {
+			continue
+		}
+		// 16 bit values must not run past the end of the region
+		for address := int(r.start); address+t.Size()-1 <= int(r.end); address++ {
+			search.addresses = append(search.addresses, uint16(address))
+		}
+	}
+	search.Snapshot()
+	return search
+}
+
+// Type returns the type the values are read as.
+func (s *RAMSearch) Type() ValueType {
+	return s.valueType
+}
+
+// Snapshot records the current values of the results, which the next filter
+// compares against.
+func (s *RAMSearch) Snapshot() {
+	s.values = s.values[:0]
+	for _, address := range s.addresses {
+		s.values = append(s.values, s.gb.readValue(address, s.valueType))
+	}
+}
+
+// Filter removes the results which do not match a filter, and takes a new
+// snapshot of the values. The value is only used by SearchEqual and
+// SearchNotEqual. Returns the number of results remaining.
+func (s *RAMSearch) Filter(filter SearchFilter, value int) int {
+	addresses := s.addresses[:0]
+	values := s.values[:0]
+	for i, address := range s.addresses {
+		current := s.gb.readValue(address, s.valueType)
+		if matchesFilter(filter, current, s.values[i], value) {
+			addresses = append(addresses, address)
+			values = append(values, current)
+		}
+	}
+	s.addresses = addresses
+	s.values = values
+	return len(s.addresses)
+}
+
+// Check if a value matches a filter.
+func matchesFilter(filter SearchFilter, current, previous, value int) bool {
+	switch filter {
+	case SearchChanged:
+		return current != previous
+	case SearchUnchanged:
+		return current == previous
+	case SearchIncreased:
+		return current > previous
+	case SearchDecreased:
+		return current < previous
+	case SearchEqual:
+		return current == value
+	case SearchNotEqual:
+		return current != value
+	}
+	return false
+}
+
+// Count returns the number of results.
+func (s *RAMSearch) Count() int {
+	return len(s.addresses)
+}
+
+// Results returns the addresses which match the search, with their current
+// values and their values in the last snapshot.
+func (s *RAMSearch) Results() []SearchResult {
+	results := make([]SearchResult, len(s.addresses))
+	for i, address := range s.addresses {
+		results[i] = SearchResult{
+			Address:  address,
+			Value:    s.gb.readValue(address, s.valueType),
+			Previous: s.values[i],
+		}
+	}
+	return results
+}
@@ -0,0 +1,84 @@
+package gb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRAMSearch_Filter(t *testing.T) {
+	gb, err := NewFromBytes(newTestROM(nil))
+	require.NoError(t, err)
+
+	search := gb.NewRAMSearch(Uint8, SearchWRAM|SearchHRAM)
+	assert.Equal(t, 0x2000+0x7F, search.Count())
+
+	gb.memory.WRAM[0x10] = 5
+	gb.memory.HighRAM[0x90] = 1
+	assert.Equal(t, 2, search.Filter(SearchChanged, 0))
+
+	gb.memory.WRAM[0x10] = 4
+	gb.memory.HighRAM[0x90] = 2
+	assert.Equal(t, 1, search.Filter(SearchDecreased, 0))
+	assert.Equal(t, []SearchResult{{Address: 0xC010, Value: 4, Previous: 4}}, search.Results())
+
+	gb.memory.WRAM[0x10] = 7
+	assert.Equal(t, 0, search.Filter(SearchEqual, 8))
+}
+
+func TestRAMSearch_ValueTypes(t *testing.T) {
+	gb, err := NewFromBytes(newTestROM(nil))
+	require.NoError(t, err)
+
+	gb.memory.HighRAM[0x80] = 0xFE
+	gb.memory.HighRAM[0x81] = 0xFF
+	assert.Equal(t, 0xFE, gb.readValue(0xFF80, Uint8))
+	assert.Equal(t, -2, gb.readValue(0xFF80, Int8))
+	assert.Equal(t, 0xFFFE, gb.readValue(0xFF80, Uint16))
+	assert.Equal(t, -2, gb.readValue(0xFF80, Int16))
+
+	search := gb.NewRAMSearch(Int16, SearchHRAM)
+	assert.Equal(t, 0x7E, search.Count(), "should not read past the end of HRAM")
+	assert.Equal(t, 1, search.Filter(SearchEqual, -2))
+	assert.Equal(t, uint16(0xFF80), search.Results()[0].Address)
+
+	for _, name := range []string{"u8", "S8", "u16", "s16"} {
+		valueType, err := ParseValueType(name)
+		require.NoError(t, err)
+		assert.Equal(t, strings.ToLower(name), valueType.String())
+	}
+	_, err = ParseValueType("u32")
+	assert.Error(t, err)
+}
+
+func TestWatchList_Frames(t *testing.T) {
+	gb, err := NewFromBytes(newTestROM([]byte{0x18, 0xFE}))
+	require.NoError(t, err)
+
+	var reported []WatchValue
+	watches := gb.Watches()
+	watches.SetFrameHandler(func(frame int, values []WatchValue) {
+		reported = values
+	})
+	watches.Add(MemoryWatch{Name: "lives", Address: 0xC100, Type: Uint8})
+	watches.Add(MemoryWatch{Name: "score", Address: 0xC102, Type: Uint16})
+
+	gb.memory.WRAM[0x100] = 3
+	gb.Update()
+	require.Len(t, reported, 2)
+	assert.Equal(t, 3, reported[0].Value)
+	assert.True(t, reported[0].Changed)
+	assert.False(t, reported[1].Changed)
+	assert.Equal(t, "lives=3", reported[0].String())
+
+	gb.memory.WRAM[0x103] = 0x01
+	gb.Update()
+	assert.False(t, reported[0].Changed)
+	assert.True(t, reported[1].Changed)
+	assert.Equal(t, 0x100, reported[1].Value)
+
+	watches.Remove(0)
+	assert.Equal(t, []MemoryWatch{{Name: "score", Address: 0xC102, Type: Uint16}}, watches.List())
+}
@@ -0,0 +1,265 @@
+package gb
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// Magic bytes written at the start of every save state.
+	saveStateMagic = "GOBOYSS"
+	// SaveStateVersion is the version of the save state format. This is
+	// incremented whenever the layout of the state changes so that states
+	// from an older version fail to load rather than corrupting the emulation.
+	SaveStateVersion uint32 = 9
+)
+
+// ErrInvalidSaveState is returned when attempting to load data which is not a
+// GoBoy save state.
+var ErrInvalidSaveState = errors.New("data is not a goboy save state")
+
+// Snapshot of the state of the Gameboy. All of the components are copied into
+// this struct so it can be serialised in a single pass.
+type gameboyState struct {
+	// Name of the cartridge the state was taken from.
+	CartName string
+
+	// CPU registers and flags
+	AF, BC, DE, HL, SP uint16
+	PC                 uint16
+
+	InterruptsEnabling bool
+	InterruptsOn       bool
+	Halted             bool
+	IMEJustEnabled     bool
+	HaltBug            bool
+	Stopped            bool
+	SpeedSwitchCycles  int
+	CurrentSpeed       byte
+	PrepareSpeed       bool
+	CGBMode            bool
+
+	// Memory
+	HighRAM  [0x100]byte
+	VRAM     [0x4000]byte
+	VRAMBank byte
+	WRAM     [0x9000]byte
+	WRAMBank byte
+	OAM      [0x100]byte
+	OAMDMA   oamDMA
+	HDMA     hdma
+
+	// PPU and timers
+	PPU            ppu
+	ScreenData     [ScreenWidth][ScreenHeight][3]uint8
+	ScreenCleared  bool
+	PreparedData   [ScreenWidth][ScreenHeight][3]uint8
+	TimerCounter   uint16
+	TIMAOverflowed bool
+	TIMAReloaded   bool
+	FrameCycles    int
+
+	BGPalette     cgbPalette
+	SpritePalette cgbPalette
+	InputMask     byte
+
+	// Serialised states of the APU and cartridge banking controller
+	Sound []byte
+	Cart  []byte
+}
+
+// SaveState writes a snapshot of the full state of the Gameboy to a writer. The
+// state can be restored with LoadState to resume the emulation from exactly the
+// same point.
+func (gb *Gameboy) SaveState(w io.Writer) error {
+	if !gb.IsCartLoaded() {
+		return errors.New("no cartridge loaded")
+	}
+	state := gameboyState{
+		CartName: gb.memory.Cart.GetName(),
+
+		AF: gb.cpu.AF.HiLo(),
+		BC: gb.cpu.BC.HiLo(),
+		DE: gb.cpu.DE.HiLo(),
+		HL: gb.cpu.HL.HiLo(),
+		SP: gb.cpu.SP.HiLo(),
+		PC: gb.cpu.PC,
+
+		InterruptsEnabling: gb.interruptsEnabling,
+		InterruptsOn:       gb.interruptsOn,
+		Halted:             gb.halted,
+		IMEJustEnabled:     gb.imeJustEnabled,
+		HaltBug:            gb.haltBug,
+		Stopped:            gb.stopped,
+		SpeedSwitchCycles:  gb.speedSwitchCycles,
+		CurrentSpeed:       gb.currentSpeed,
+		PrepareSpeed:       gb.prepareSpeed,
+		CGBMode:            gb.cgbMode,
+
+		HighRAM:  gb.memory.HighRAM,
+		VRAM:     gb.memory.VRAM,
+		VRAMBank: gb.memory.VRAMBank,
+		WRAM:     gb.memory.WRAM,
+		WRAMBank: gb.memory.WRAMBank,
+		OAM:      gb.memory.OAM,
+		OAMDMA:   gb.oamDMA,
+		HDMA:     gb.hdma,
+
+		PPU:            gb.ppu,
+		ScreenData:     gb.screenData,
+		ScreenCleared:  gb.screenCleared,
+		PreparedData:   gb.PreparedData,
+		TimerCounter:   gb.timer.counter,
+		TIMAOverflowed: gb.timer.overflowed,
+		TIMAReloaded:   gb.timer.reloaded,
+		FrameCycles:    gb.frameCycles,
+
+		BGPalette:     *gb.bgPalette,
+		SpritePalette: *gb.spritePalette,
+		InputMask:     gb.inputMask,
+	}
+
+	var err error
+	if state.Sound, err = gb.sound.MarshalState(); err != nil {
+		return fmt.Errorf("saving apu state: %v", err)
+	}
+	if state.Cart, err = gb.memory.Cart.MarshalState(); err != nil {
+		return fmt.Errorf("saving cartridge state: %v", err)
+	}
+
+	if _, err := io.WriteString(w, saveStateMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, SaveStateVersion); err != nil {
+		return err
+	}
+	return gob.NewEncoder(w).Encode(state)
+}
+
+// LoadState restores the Gameboy to a snapshot previously written by SaveState.
+// If the data is not a save state, was written by a different version of the
+// format or was taken from a different cartridge then an error is returned and
+// the Gameboy is left unchanged.
+func (gb *Gameboy) LoadState(r io.Reader) error {
+	if !gb.IsCartLoaded() {
+		return errors.New("no cartridge loaded")
+	}
+
+	magic := make([]byte, len(saveStateMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != saveStateMagic {
+		return ErrInvalidSaveState
+	}
+	var version uint32
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return ErrInvalidSaveState
+	}
+	if version != SaveStateVersion {
+		return fmt.Errorf("unsupported save state version %v (expected %v)", version, SaveStateVersion)
+	}
+
+	var state gameboyState
+	if err := gob.NewDecoder(r).Decode(&state); err != nil {
+		return fmt.Errorf("reading save state: %v", err)
+	}
+	if state.CartName != gb.memory.Cart.GetName() {
+		return fmt.Errorf("save state is for a different cartridge: %q", state.CartName)
+	}
+
+	// Validate the sub components before anything is restored, as these may
+	// fail to decode. The cartridge is validated before it is restored, so
+	// after it has been restored nothing else can fail.
+	if err := gb.sound.ValidateState(state.Sound); err != nil {
+		return fmt.Errorf("loading apu state: %v", err)
+	}
+	if err := gb.memory.Cart.UnmarshalState(state.Cart); err != nil {
+		return fmt.Errorf("loading cartridge state: %v", err)
+	}
+	if err := gb.sound.UnmarshalState(state.Sound); err != nil {
+		return fmt.Errorf("loading apu state: %v", err)
+	}
+
+	gb.cpu.AF.Set(state.AF)
+	gb.cpu.BC.Set(state.BC)
+	gb.cpu.DE.Set(state.DE)
+	gb.cpu.HL.Set(state.HL)
+	gb.cpu.SP.Set(state.SP)
+	gb.cpu.PC = state.PC
+
+	gb.interruptsEnabling = state.InterruptsEnabling
+	gb.interruptsOn = state.InterruptsOn
+	gb.halted = state.Halted
+	gb.imeJustEnabled = state.IMEJustEnabled
+	gb.haltBug = state.HaltBug
+	gb.stopped = state.Stopped
+	gb.speedSwitchCycles = state.SpeedSwitchCycles
+	gb.currentSpeed = state.CurrentSpeed
+	gb.prepareSpeed = state.PrepareSpeed
+	gb.cgbMode = state.CGBMode
+
+	gb.memory.HighRAM = state.HighRAM
+	gb.memory.VRAM = state.VRAM
+	gb.memory.VRAMBank = state.VRAMBank
+	gb.memory.WRAM = state.WRAM
+	gb.memory.WRAMBank = state.WRAMBank
+	gb.memory.OAM = state.OAM
+	gb.oamDMA = state.OAMDMA
+	gb.hdma = state.HDMA
+
+	gb.ppu = state.PPU
+	gb.screenData = state.ScreenData
+	gb.screenCleared = state.ScreenCleared
+	gb.PreparedData = state.PreparedData
+	gb.timer = timer{
+		counter:    state.TimerCounter,
+		overflowed: state.TIMAOverflowed,
+		reloaded:   state.TIMAReloaded,
+	}
+	gb.frameCycles = state.FrameCycles
+
+	*gb.bgPalette = state.BGPalette
+	*gb.spritePalette = state.SpritePalette
+	gb.inputMask = state.InputMask
+	return nil
+}
+
+// Save the state of the Gameboy to the save state file next to the rom.
+func (gb *Gameboy) saveStateToFile() {
+	if gb.memory.Cart.GetStateFilename() == "" {
+		fmt.Println("Error saving state: cartridge was not loaded from a file")
+		return
+	}
+	f, err := os.Create(gb.memory.Cart.GetStateFilename())
+	if err != nil {
+		fmt.Printf("Error creating save state: %v\n", err)
+		return
+	}
+	defer f.Close()
+	if err := gb.SaveState(f); err != nil {
+		fmt.Printf("Error saving state: %v\n", err)
+		return
+	}
+	fmt.Printf("Saved state to %s\n", gb.memory.Cart.GetStateFilename())
+}
+
+// Load the state of the Gameboy from the save state file next to the rom.
+func (gb *Gameboy) loadStateFromFile() {
+	if gb.memory.Cart.GetStateFilename() == "" {
+		fmt.Println("Error loading state: cartridge was not loaded from a file")
+		return
+	}
+	f, err := os.Open(gb.memory.Cart.GetStateFilename())
+	if err != nil {
+		fmt.Printf("Error opening save state: %v\n", err)
+		return
+	}
+	defer f.Close()
+	if err := gb.LoadState(f); err != nil {
+		fmt.Printf("Error loading state: %v\n", err)
+		return
+	}
+	fmt.Printf("Loaded state from %s\n", gb.memory.Cart.GetStateFilename())
+}
@@ -0,0 +1,93 @@
+package gb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"testing"
+
+	"github.com/Humpheh/goboy/pkg/cart"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGameboy_SaveState asserts that restoring a save state resumes the
+// emulation from exactly the same point it was taken.
+func TestGameboy_SaveState(t *testing.T) {
+	gb, err := New("./../../roms/blargg/cpu_instrs.gb")
+	require.NoError(t, err, "error in init gb %v", err)
+	for i := 0; i < 100; i++ {
+		gb.Update()
+	}
+
+	var state bytes.Buffer
+	require.NoError(t, gb.SaveState(&state))
+
+	for i := 0; i < 50; i++ {
+		gb.Update()
+	}
+	expectedCPU := *gb.cpu
+	expectedScreen := gb.PreparedData
+
+	require.NoError(t, gb.LoadState(bytes.NewReader(state.Bytes())))
+	for i := 0; i < 50; i++ {
+		gb.Update()
+	}
+	assert.Equal(t, expectedCPU, *gb.cpu, "cpu state does not match")
+	assert.Equal(t, expectedScreen, gb.PreparedData, "screen does not match")
+}
+
+func TestGameboy_LoadState_Invalid(t *testing.T) {
+	gb, err := New("./../../roms/blargg/cpu_instrs.gb")
+	require.NoError(t, err, "error in init gb %v", err)
+
+	t.Run("Not a state", func(t *testing.T) {
+		err := gb.LoadState(bytes.NewReader([]byte("not a save state")))
+		assert.Equal(t, ErrInvalidSaveState, err)
+	})
+
+	t.Run("Wrong version", func(t *testing.T) {
+		var state bytes.Buffer
+		require.NoError(t, gb.SaveState(&state))
+		data := state.Bytes()
+		binary.BigEndian.PutUint32(data[len(saveStateMagic):], SaveStateVersion+1)
+
+		pc := gb.cpu.PC
+		err := gb.LoadState(bytes.NewReader(data))
+		expected := fmt.Sprintf("unsupported save state version %v (expected %v)", SaveStateVersion+1, SaveStateVersion)
+		assert.EqualError(t, err, expected)
+		assert.Equal(t, pc, gb.cpu.PC, "state was modified")
+	})
+}
+
+// TestGameboy_LoadState_Atomic asserts that a state which fails to load part
+// way through leaves the Gameboy unchanged.
+func TestGameboy_LoadState_Atomic(t *testing.T) {
+	// MBC1+RAM+BATTERY cartridge with 8KB of RAM
+	rom := newTestROM(nil)
+	rom[0x147] = 0x03
+	rom[0x149] = 0x02
+	cart.FixHeader(rom)
+	gb, err := NewFromBytes(rom)
+	require.NoError(t, err, "error in init gb %v", err)
+	gb.memory.Write(0x0000, 0x0A) // Enable RAM
+
+	var buf bytes.Buffer
+	require.NoError(t, gb.SaveState(&buf))
+	data := buf.Bytes()
+	header := len(saveStateMagic) + 4
+
+	// Corrupt the sound section of the state
+	var state gameboyState
+	require.NoError(t, gob.NewDecoder(bytes.NewReader(data[header:])).Decode(&state))
+	state.Sound = []byte("corrupt")
+	var corrupt bytes.Buffer
+	corrupt.Write(data[:header])
+	require.NoError(t, gob.NewEncoder(&corrupt).Encode(state))
+
+	gb.memory.Write(0xA000, 0x42)
+	err = gb.LoadState(bytes.NewReader(corrupt.Bytes()))
+	assert.ErrorContains(t, err, "loading apu state")
+	assert.Equal(t, byte(0x42), gb.memory.Read(0xA000), "cart RAM was modified")
+}
@@ -0,0 +1,102 @@
+package gb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Run the PPU until it reaches a mode on a line.
+func tickUntil(gb *Gameboy, line int, mode byte) {
+	for gb.ppu.Line != line || gb.ppu.Mode != mode {
+		gb.tickPPU()
+	}
+}
+
+// Check if the LCD STAT interrupt has been requested.
+func statRequested(gb *Gameboy) bool {
+	return bitTest(gb.memory.HighRAM[0x0F], 1)
+}
+
+func TestStat_Blocking(t *testing.T) {
+	gb := newLCDGameboy(t)
+	gb.memory.Write(0xFF41, 0x20)
+	tickUntil(gb, 0, modeHBlank)
+	gb.memory.HighRAM[0x0F] = 0
+	tickUntil(gb, 1, modeTransfer)
+	assert.True(t, statRequested(gb), "OAM interrupt should be requested")
+
+	gb = newLCDGameboy(t)
+	gb.memory.Write(0xFF41, 0x28)
+	tickUntil(gb, 0, modeHBlank)
+	gb.memory.HighRAM[0x0F] = 0
+	tickUntil(gb, 1, modeTransfer)
+	assert.False(t, statRequested(gb), "OAM interrupt should be blocked by the H-Blank interrupt")
+}
+
+func TestStat_VBlankOAMInterrupt(t *testing.T) {
+	gb := newLCDGameboy(t)
+	gb.memory.Write(0xFF41, 0x20)
+	tickUntil(gb, ScreenHeight-1, modeHBlank)
+	gb.memory.HighRAM[0x0F] = 0
+	tickUntil(gb, ScreenHeight, modeVBlank)
+	assert.True(t, statRequested(gb), "OAM interrupt should be requested at the start of V-Blank")
+}
+
+func TestStat_Line153(t *testing.T) {
+	gb := newLCDGameboy(t)
+	gb.memory.HighRAM[0x45] = 0
+	gb.memory.Write(0xFF41, 0x40)
+	tickUntil(gb, 153, modeVBlank)
+	gb.memory.HighRAM[0x0F] = 0
+	assert.Equal(t, byte(153), gb.memory.Read(0xFF44))
+
+	for i := 0; i < 4; i++ {
+		gb.tickPPU()
+	}
+	assert.Equal(t, byte(0), gb.memory.Read(0xFF44), "LY should read 0 for most of line 153")
+	assert.True(t, bitTest(gb.memory.Read(0xFF41), 2), "LY=LYC should be set on line 153")
+	assert.True(t, statRequested(gb))
+
+	gb.memory.HighRAM[0x0F] = 0
+	tickUntil(gb, 0, modeTransfer)
+	assert.False(t, statRequested(gb), "LY=LYC interrupt should only be requested once")
+}
+
+func TestStat_FirstLine(t *testing.T) {
+	gb := newLCDGameboy(t)
+	gb.memory.Write(0xFF41, 0x20)
+	gb.memory.HighRAM[0x0F] = 0
+	for i := 0; i < oamScanDots-1; i++ {
+		gb.tickPPU()
+		assert.Equal(t, modeHBlank, gb.memory.Read(0xFF41)&0x3, "mode should read 0 before the first mode 3")
+	}
+	gb.tickPPU()
+	assert.Equal(t, modeTransfer, gb.memory.Read(0xFF41)&0x3)
+	assert.False(t, statRequested(gb), "OAM interrupt should not be requested on the first line")
+}
+
+func TestStat_LCDOff(t *testing.T) {
+	gb := newLCDGameboy(t)
+	tickUntil(gb, 10, modeTransfer)
+	gb.memory.Write(0xFF41, 0x08)
+	gb.memory.Write(0xFF40, 0x00)
+	gb.updateGraphics(4)
+
+	assert.Equal(t, byte(0), gb.memory.Read(0xFF44))
+	assert.Equal(t, byte(0x88), gb.memory.Read(0xFF41)&0xFB, "bit 7 should be set and the mode should be 0")
+}
+
+func TestStat_WriteQuirk(t *testing.T) {
+	gb := newLCDGameboy(t)
+	gb.memory.HighRAM[0x45] = 0xFF
+	tickUntil(gb, 1, modeHBlank)
+	gb.memory.HighRAM[0x0F] = 0
+	gb.memory.Write(0xFF41, 0x00)
+	assert.True(t, statRequested(gb), "writing STAT in H-Blank should request an interrupt on the DMG")
+
+	gb.memory.HighRAM[0x0F] = 0
+	tickUntil(gb, 2, modeTransfer)
+	gb.memory.Write(0xFF41, 0x00)
+	assert.False(t, statRequested(gb), "writing STAT in mode 3 should not request an interrupt")
+}
@@ -0,0 +1,113 @@
+package gb
+
+// Bit of the system counter which clocks TIMA for each of the TAC frequencies.
+var timerBits = [4]uint{9, 3, 5, 7}
+
+// timer is the state of the DIV and TIMA timers. Both are driven by a single
+// 16 bit system counter which is incremented every clock cycle. DIV is the
+// upper 8 bits of the counter, and TIMA is incremented on the falling edge of
+// one of the counter bits selected by TAC.
+type timer struct {
+	// Internal system counter.
+	counter uint16
+
+	// If TIMA overflowed in the last cycle. TIMA reads as 0 for one cycle
+	// before it is reloaded from TMA and the interrupt is requested.
+	overflowed bool
+
+	// If TIMA was reloaded from TMA in this cycle. Writes to TIMA during this
+	// cycle are ignored, and writes to TMA are also copied to TIMA.
+	reloaded bool
+}
+
+// Initial value of the system counter after the boot rom has run.
+func initialTimerCounter(cgb bool) uint16 {
+	if cgb {
+		return 0x1EA0
+	}
+	return 0xABCC
+}
+
+// Advance the timers by a number of clock cycles.
+func (gb *Gameboy) updateTimers(cycles int) {
+	for i := 0; i < cycles; i += 4 {
+		gb.tickTimer()
+	}
+}
+
+// Advance the timers by a single machine cycle (4 clock cycles).
+func (gb *Gameboy) tickTimer() {
+	gb.timer.reloaded = false
+	if gb.timer.overflowed {
+		gb.timer.overflowed = false
+		gb.timer.reloaded = true
+		gb.memory.HighRAM[TIMA-0xFF00] = gb.memory.HighRAM[TMA-0xFF00]
+		gb.requestInterrupt(2)
+	}
+	gb.setTimerCounter(gb.timer.counter + 4)
+}
+
+// Set the system counter. If this causes a falling edge on the bit selected
+// by TAC then TIMA is incremented.
+func (gb *Gameboy) setTimerCounter(value uint16) {
+	before := gb.timerInput()
+	gb.timer.counter = value
+	if before && !gb.timerInput() {
+		gb.incrementTIMA()
+	}
+}
+
+// Get the value of the signal which clocks TIMA, which is the counter bit
+// selected by TAC if the timer is enabled.
+func (gb *Gameboy) timerInput() bool {
+	tac := gb.memory.HighRAM[TAC-0xFF00]
+	return bitTest(tac, 2) && gb.timer.counter&(1<<timerBits[tac&0x3]) != 0
+}
+
+// Increment TIMA, starting the reload if it overflows.
+func (gb *Gameboy) incrementTIMA() {
+	tima := gb.memory.HighRAM[TIMA-0xFF00] + 1
+	gb.memory.HighRAM[TIMA-0xFF00] = tima
+	if tima == 0 {
+		gb.timer.overflowed = true
+	}
+}
+
+// Reset the divider register, which resets the whole system counter.
+func (gb *Gameboy) resetDivider() {
+	gb.setTimerCounter(0)
+}
+
+// Read the DIV register.
+func (gb *Gameboy) readDivider() byte {
+	return byte(gb.timer.counter >> 8)
+}
+
+// Write to the TIMA register. Writing during the cycle after an overflow
+// cancels the reload and interrupt, and writing during the reload is ignored.
+func (gb *Gameboy) writeTIMA(value byte) {
+	if gb.timer.reloaded {
+		return
+	}
+	gb.timer.overflowed = false
+	gb.memory.HighRAM[TIMA-0xFF00] = value
+}
+
+// Write to the TMA register. Writing during the reload also writes the new
+// value to TIMA.
+func (gb *Gameboy) writeTMA(value byte) {
+	gb.memory.HighRAM[TMA-0xFF00] = value
+	if gb.timer.reloaded {
+		gb.memory.HighRAM[TIMA-0xFF00] = value
+	}
+}
+
+// Write to the TAC register. Changing the frequency or disabling the timer
+// can cause a falling edge which increments TIMA.
+func (gb *Gameboy) writeTAC(value byte) {
+	before := gb.timerInput()
+	gb.memory.HighRAM[TAC-0xFF00] = value | 0xF8
+	if before && !gb.timerInput() {
+		gb.incrementTIMA()
+	}
+}
@@ -0,0 +1,93 @@
+package gb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Create a Gameboy with the timer at a known state.
+func newTimerGameboy(t *testing.T, tac byte) *Gameboy {
+	gb := newProgramGameboy(t, nil, nil)
+	gb.memory.Write(DIV, 0)
+	gb.memory.Write(TAC, tac)
+	gb.memory.HighRAM[0x0F] = 0
+	return gb
+}
+
+func TestTimer_Divider(t *testing.T) {
+	gb := newTimerGameboy(t, 0)
+	gb.updateTimers(252)
+	assert.Equal(t, byte(0), gb.memory.Read(DIV))
+	gb.updateTimers(4)
+	assert.Equal(t, byte(1), gb.memory.Read(DIV), "DIV should increment every 256 cycles")
+
+	gb.updateTimers(256 * 10)
+	assert.Equal(t, byte(11), gb.memory.Read(DIV))
+	gb.memory.Write(DIV, 0x55)
+	assert.Equal(t, byte(0), gb.memory.Read(DIV), "writing DIV should reset it")
+}
+
+func TestTimer_Frequencies(t *testing.T) {
+	for tac, cycles := range map[byte]int{0x4: 1024, 0x5: 16, 0x6: 64, 0x7: 256} {
+		gb := newTimerGameboy(t, tac)
+		gb.updateTimers(cycles - 4)
+		assert.Equal(t, byte(0), gb.memory.Read(TIMA), "TAC %02X", tac)
+		gb.updateTimers(4)
+		assert.Equal(t, byte(1), gb.memory.Read(TIMA), "TAC %02X", tac)
+	}
+}
+
+func TestTimer_Overflow(t *testing.T) {
+	gb := newTimerGameboy(t, 0x5)
+	gb.memory.Write(TMA, 0x80)
+	gb.memory.Write(TIMA, 0xFF)
+
+	gb.updateTimers(16)
+	assert.Equal(t, byte(0), gb.memory.Read(TIMA), "TIMA should read 0 for a cycle after overflowing")
+	assert.Equal(t, byte(0), gb.memory.HighRAM[0x0F]&0x4, "interrupt should not be requested yet")
+
+	gb.updateTimers(4)
+	assert.Equal(t, byte(0x80), gb.memory.Read(TIMA), "TIMA should be reloaded from TMA")
+	assert.Equal(t, byte(0x4), gb.memory.HighRAM[0x0F]&0x4, "interrupt should be requested")
+}
+
+func TestTimer_WriteDuringOverflow(t *testing.T) {
+	gb := newTimerGameboy(t, 0x5)
+	gb.memory.Write(TMA, 0x80)
+	gb.memory.Write(TIMA, 0xFF)
+	gb.updateTimers(16)
+
+	// Writing TIMA in the cycle after the overflow cancels the reload
+	gb.memory.Write(TIMA, 0x10)
+	gb.updateTimers(4)
+	assert.Equal(t, byte(0x10), gb.memory.Read(TIMA))
+	assert.Equal(t, byte(0), gb.memory.HighRAM[0x0F]&0x4, "interrupt should be cancelled")
+}
+
+func TestTimer_WriteDuringReload(t *testing.T) {
+	gb := newTimerGameboy(t, 0x5)
+	gb.memory.Write(TMA, 0x80)
+	gb.memory.Write(TIMA, 0xFF)
+	gb.updateTimers(20)
+
+	// Writing TIMA during the reload is ignored, and TMA is copied to TIMA
+	gb.memory.Write(TIMA, 0x10)
+	assert.Equal(t, byte(0x80), gb.memory.Read(TIMA))
+	gb.memory.Write(TMA, 0x20)
+	assert.Equal(t, byte(0x20), gb.memory.Read(TIMA))
+}
+
+func TestTimer_FallingEdge(t *testing.T) {
+	gb := newTimerGameboy(t, 0x5)
+	gb.updateTimers(8)
+
+	// Resetting DIV while the selected bit is set increments TIMA
+	gb.memory.Write(DIV, 0)
+	assert.Equal(t, byte(1), gb.memory.Read(TIMA))
+
+	// Disabling the timer while the selected bit is set increments TIMA
+	gb.updateTimers(8)
+	gb.memory.Write(TAC, 0x1)
+	assert.Equal(t, byte(2), gb.memory.Read(TIMA))
+}
@@ -33,3 +33,60 @@ func cpuTimingTest(t *testing.T, options ...GameboyOption) {
 func TestInstructionTimingCGB(t *testing.T) {
 	cpuTimingTest(t, WithCGBEnabled())
 }
+
+func TestCPU_StepCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		cycles  int
+	}{
+		{"NOP", []byte{0x00}, 4},
+		{"LD A,(HL)", []byte{0x7E}, 8},
+		{"INC (HL)", []byte{0x34}, 12},
+		{"JP nn", []byte{0xC3, 0x00, 0x02}, 16},
+		{"CALL nn", []byte{0xCD, 0x00, 0x02}, 24},
+		{"RST", []byte{0xFF}, 16},
+		{"PUSH BC", []byte{0xC5}, 16},
+		{"POP BC", []byte{0xC1}, 12},
+		{"RET NZ not taken", []byte{0xC0}, 8},
+		{"RET Z taken", []byte{0xC8}, 20},
+		{"BIT 0,(HL)", []byte{0xCB, 0x46}, 12},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gb := newProgramGameboy(t, test.program, nil)
+			assert.Equal(t, test.cycles, gb.step())
+		})
+	}
+}
+
+func TestCPU_InterruptCycles(t *testing.T) {
+	gb := newProgramGameboy(t, append(requestVBlank, 0xFB, 0x00, 0x00), nil)
+	for gb.cpu.PC != 0x159 {
+		gb.step()
+	}
+	// The interrupt is dispatched after the instruction following EI
+	assert.Equal(t, 4+20, gb.step())
+	assert.Equal(t, uint16(0x40), gb.cpu.PC)
+}
+
+func TestCPU_MemoryAccessTiming(t *testing.T) {
+	// LDH A,($04) reads DIV on its third machine cycle, after the timer has
+	// been advanced by the two opcode fetches
+	gb := newProgramGameboy(t, []byte{0xF0, 0x04}, nil)
+	gb.timer.counter = 0x100 - 8
+	gb.step()
+	assert.Equal(t, byte(1), gb.cpu.AF.Hi(), "DIV should be read on the last cycle")
+
+	gb = newProgramGameboy(t, []byte{0xF0, 0x04}, nil)
+	gb.timer.counter = 0x100 - 12
+	gb.step()
+	assert.Equal(t, byte(0), gb.cpu.AF.Hi())
+
+	// LDH ($04),A resets DIV on its third machine cycle, and the timer
+	// continues for the rest of the cycle
+	gb = newProgramGameboy(t, []byte{0xE0, 0x04}, nil)
+	gb.timer.counter = 0x1000
+	gb.step()
+	assert.Equal(t, uint16(4), gb.timer.counter)
+}
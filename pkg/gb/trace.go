@@ -0,0 +1,74 @@
+package gb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/Humpheh/goboy/pkg/disasm"
+)
+
+// TraceFormat is the format of the lines written by a trace writer.
+type TraceFormat int
+
+const (
+	// TraceFormatDoctor writes the CPU state before each instruction in the
+	// format used by gameboy-doctor and the logs of other reference emulators:
+	//  A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0100 PCMEM:00,C3,13,02
+	TraceFormatDoctor TraceFormat = iota
+
+	// TraceFormatDisasm writes the same line as TraceFormatDoctor followed
+	// by the disassembled instruction as a comment.
+	TraceFormatDisasm
+)
+
+// Writes a line for each instruction executed by the CPU.
+type traceWriter struct {
+	w      *bufio.Writer
+	format TraceFormat
+	err    error
+}
+
+// WithTraceWriter writes a trace of the CPU state before every instruction
+// is executed. The trace is buffered and flushed when the Gameboy is closed.
+func WithTraceWriter(w io.Writer, format TraceFormat) GameboyOption {
+	return func(o *gameboyOptions) {
+		o.trace = &traceWriter{w: bufio.NewWriter(w), format: format}
+	}
+}
+
+// Write the trace line for the instruction at the current PC. If writing
+// fails then the error is logged and tracing is stopped.
+func (t *traceWriter) trace(gb *Gameboy) {
+	if t == nil || t.err != nil {
+		return
+	}
+	cpu, pc := gb.cpu, gb.cpu.PC
+	_, t.err = fmt.Fprintf(t.w,
+		"A:%02X F:%02X B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X SP:%04X PC:%04X PCMEM:%02X,%02X,%02X,%02X",
+		cpu.AF.Hi(), cpu.AF.Lo(), cpu.BC.Hi(), cpu.BC.Lo(), cpu.DE.Hi(), cpu.DE.Lo(), cpu.HL.Hi(), cpu.HL.Lo(),
+		cpu.SP.HiLo(), pc, gb.memory.Read(pc), gb.memory.Read(pc+1), gb.memory.Read(pc+2), gb.memory.Read(pc+3),
+	)
+	if t.err == nil && t.format == TraceFormatDisasm {
+		_, t.err = fmt.Fprintf(t.w, " ; %v", disasm.Decode(gb.memory.Read, pc))
+	}
+	if t.err == nil {
+		t.err = t.w.WriteByte('\n')
+	}
+	if t.err != nil {
+		log.Printf("Stopped writing trace: %v", t.err)
+	}
+}
+
+// Flush any buffered trace lines to the writer. If writing the trace failed
+// then the error is returned, as the trace is incomplete.
+func (t *traceWriter) flush() error {
+	if t == nil {
+		return nil
+	}
+	if t.err != nil {
+		return t.err
+	}
+	return t.w.Flush()
+}
@@ -0,0 +1,110 @@
+package gb
+
+import "fmt"
+
+// MemoryWatch is a value in memory which is reported by a WatchList.
+type MemoryWatch struct {
+	// Name is a description of the value, such as the variable name.
+	Name    string
+	Address uint16
+	Type    ValueType
+}
+
+func (w MemoryWatch) String() string {
+	if w.Name == "" {
+		return fmt.Sprintf("%04X (%v)", w.Address, w.Type)
+	}
+	return fmt.Sprintf("%s %04X (%v)", w.Name, w.Address, w.Type)
+}
+
+// WatchValue is the value of a MemoryWatch.
+type WatchValue struct {
+	MemoryWatch
+	Value int
+	// Changed is if the value is different to the previous frame.
+	Changed bool
+}
+
+func (v WatchValue) String() string {
+	name := v.Name
+	if name == "" {
+		name = fmt.Sprintf("%04X", v.Address)
+	}
+	return fmt.Sprintf("%s=%v", name, v.Value)
+}
+
+// WatchList reads a list of values from memory at the end of every frame, so
+// that the game variables found with a RAMSearch can be followed.
+type WatchList struct {
+	gb      *Gameboy
+	watches []MemoryWatch
+
+	// Values at the end of the previous frame.
+	previous []int
+
+	handler func(frame int, values []WatchValue)
+}
+
+// Watches returns the watch list for the Gameboy, creating one if there is
+// not one already.
+func (gb *Gameboy) Watches() *WatchList {
+	if gb.watches == nil {
+		gb.watches = &WatchList{gb: gb}
+	}
+	return gb.watches
+}
+
+// Add adds a value to the watch list and returns its index.
+func (l *WatchList) Add(watch MemoryWatch) int {
+	l.watches = append(l.watches, watch)
+	l.previous = append(l.previous, l.gb.readValue(watch.Address, watch.Type))
+	return len(l.watches) - 1
+}
+
+// Remove removes the watch at an index in List.
+func (l *WatchList) Remove(index int) {
+	if index >= 0 && index < len(l.watches) {
+		l.watches = append(l.watches[:index], l.watches[index+1:]...)
+		l.previous = append(l.previous[:index], l.previous[index+1:]...)
+	}
+}
+
+// List returns the watches.
+func (l *WatchList) List() []MemoryWatch {
+	return append([]MemoryWatch(nil), l.watches...)
+}
+
+// Values returns the current value of each watch, and if it has changed
+// since the end of the previous frame.
+func (l *WatchList) Values() []WatchValue {
+	values := make([]WatchValue, len(l.watches))
+	for i, watch := range l.watches {
+		value := l.gb.readValue(watch.Address, watch.Type)
+		values[i] = WatchValue{
+			MemoryWatch: watch,
+			Value:       value,
+			Changed:     value != l.previous[i],
+		}
+	}
+	return values
+}
+
+// SetFrameHandler sets a function which is called with the values of the
+// watches at the end of every frame.
+func (l *WatchList) SetFrameHandler(handler func(frame int, values []WatchValue)) {
+	l.handler = handler
+}
+
+// Report the values at the end of a frame.
+func (l *WatchList) onFrame() {
+	if len(l.watches) == 0 {
+		return
+	}
+	values := l.Values()
+	for i, value := range values {
+		l.previous[i] = value.Value
+	}
+	if l.handler != nil {
+		l.handler(l.gb.frames, values)
+	}
+}
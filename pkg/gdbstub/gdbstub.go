@@ -0,0 +1,512 @@
+// Package gdbstub implements a GDB remote serial protocol server for the
+// Gameboy, so that standard debugger front-ends can be attached to it.
+//
+// The server supports reading and writing the registers and memory, software
+// breakpoints, watchpoints, single stepping and continuing. The registers are
+// sent in the order AF, BC, DE, HL, SP, PC, with each register encoded as a
+// 16 bit little endian value.
+package gdbstub
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/Humpheh/goboy/pkg/gb"
+)
+
+// Register numbers used in the register packets.
+const (
+	regAF = iota
+	regBC
+	regDE
+	regHL
+	regSP
+	regPC
+	numRegisters
+)
+
+// Byte sent by the client to interrupt a running target.
+const interruptByte = 0x03
+
+// errKilled is returned from a session when the client sent a kill request.
+var errKilled = errors.New("killed by client")
+
+// Server serves the GDB remote serial protocol for a Gameboy. While a client
+// is connected the server drives the emulation through the gb.Debugger, so
+// nothing else should be calling Update on the Gameboy.
+type Server struct {
+	debugger *gb.Debugger
+
+	// Verbose logs every packet sent and received.
+	Verbose bool
+}
+
+// New returns a new server which debugs a Gameboy.
+func New(gameboy *gb.Gameboy) *Server {
+	return &Server{debugger: gameboy.Debugger()}
+}
+
+// ListenAndServe listens on a TCP address and serves clients one at a time
+// until a client sends a kill request.
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	log.Printf("Waiting for gdb connection on %v", listener.Addr())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		log.Printf("Debugger connected from %v", conn.RemoteAddr())
+		err = s.Serve(conn)
+		conn.Close()
+		if err == errKilled {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Debugger connection closed: %v", err)
+		} else {
+			log.Print("Debugger detached")
+		}
+	}
+}
+
+// Serve handles a single client session on a connection. It returns nil when
+// the client detaches or disconnects.
+func (s *Server) Serve(conn io.ReadWriter) error {
+	sess := &session{
+		server:  s,
+		w:       conn,
+		packets: make(chan packet),
+		done:    make(chan struct{}),
+	}
+	go sess.readPackets(bufio.NewReader(conn))
+	err := sess.serve()
+	close(sess.done)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// A packet or interrupt received from the client.
+type packet struct {
+	data      string
+	interrupt bool
+	valid     bool
+}
+
+// Connection state for a single client.
+type session struct {
+	server  *Server
+	w       io.Writer
+	packets chan packet
+	err     error
+	// Closed when the session has finished.
+	done chan struct{}
+
+	// If the client has disabled acknowledgements.
+	noAck bool
+}
+
+// Read packets from the client and send them to the packets channel. The
+// channel is closed when the connection is closed.
+func (sess *session) readPackets(r *bufio.Reader) {
+	defer close(sess.packets)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			sess.err = err
+			return
+		}
+		var p packet
+		switch b {
+		case interruptByte:
+			p.interrupt = true
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				sess.err = err
+				return
+			}
+			checksum := make([]byte, 2)
+			if _, err := io.ReadFull(r, checksum); err != nil {
+				sess.err = err
+				return
+			}
+			p.data = data[:len(data)-1]
+			expected, err := strconv.ParseUint(string(checksum), 16, 8)
+			p.valid = err == nil && byte(expected) == sum(p.data)
+		default:
+			// Acknowledgements from the client are ignored
+			continue
+		}
+		select {
+		case sess.packets <- p:
+		case <-sess.done:
+			return
+		}
+	}
+}
+
+// Handle packets until the client detaches or the connection is closed.
+func (sess *session) serve() error {
+	for p := range sess.packets {
+		if p.interrupt {
+			// The target is already stopped
+			continue
+		}
+		if !sess.noAck {
+			ack := "+"
+			if !p.valid {
+				ack = "-"
+			}
+			if _, err := io.WriteString(sess.w, ack); err != nil {
+				return err
+			}
+		}
+		if !p.valid || p.data == "" {
+			continue
+		}
+		if sess.server.Verbose {
+			log.Printf("gdb <- %s", p.data)
+		}
+		if err := sess.handle(p.data); err != nil {
+			return err
+		}
+	}
+	if sess.err == nil {
+		return io.EOF
+	}
+	return sess.err
+}
+
+// Send a packet to the client.
+func (sess *session) send(data string) error {
+	if sess.server.Verbose {
+		log.Printf("gdb -> %s", data)
+	}
+	_, err := fmt.Fprintf(sess.w, "$%s#%02x", data, sum(data))
+	return err
+}
+
+// Handle a single packet from the client.
+func (sess *session) handle(data string) error {
+	d := sess.server.debugger
+	command, args := data[0], data[1:]
+	switch command {
+	case '?':
+		_, event := d.Stopped()
+		return sess.send(stopReply(event))
+
+	case 'g':
+		regs := d.Registers()
+		var reply string
+		for i := 0; i < numRegisters; i++ {
+			reply += encodeRegister(getRegister(regs, i))
+		}
+		return sess.send(reply)
+
+	case 'G':
+		if len(args) != numRegisters*4 {
+			return sess.send("E01")
+		}
+		regs := d.Registers()
+		for i := 0; i < numRegisters; i++ {
+			value, err := decodeRegister(args[i*4 : i*4+4])
+			if err != nil {
+				return sess.send("E01")
+			}
+			setRegister(&regs, i, value)
+		}
+		d.SetRegisters(regs)
+		return sess.send("OK")
+
+	case 'p':
+		reg, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || reg >= numRegisters {
+			return sess.send("E01")
+		}
+		return sess.send(encodeRegister(getRegister(d.Registers(), int(reg))))
+
+	case 'P':
+		parts := strings.SplitN(args, "=", 2)
+		if len(parts) != 2 {
+			return sess.send("E01")
+		}
+		reg, err := strconv.ParseUint(parts[0], 16, 8)
+		if err != nil || reg >= numRegisters {
+			return sess.send("E01")
+		}
+		value, err := decodeRegister(parts[1])
+		if err != nil {
+			return sess.send("E01")
+		}
+		regs := d.Registers()
+		setRegister(&regs, int(reg), value)
+		d.SetRegisters(regs)
+		return sess.send("OK")
+
+	case 'm':
+		address, length, err := parseRange(args)
+		if err != nil {
+			return sess.send("E01")
+		}
+		return sess.send(hex.EncodeToString(d.ReadMemory(address, length)))
+
+	case 'M':
+		parts := strings.SplitN(args, ":", 2)
+		if len(parts) != 2 {
+			return sess.send("E01")
+		}
+		address, length, err := parseRange(parts[0])
+		if err != nil {
+			return sess.send("E01")
+		}
+		values, err := hex.DecodeString(parts[1])
+		if err != nil || len(values) != length {
+			return sess.send("E01")
+		}
+		d.WriteMemory(address, values)
+		return sess.send("OK")
+
+	case 'c', 's':
+		if args != "" {
+			address, err := strconv.ParseUint(args, 16, 16)
+			if err != nil {
+				return sess.send("E01")
+			}
+			regs := d.Registers()
+			regs.PC = uint16(address)
+			d.SetRegisters(regs)
+		}
+		if command == 's' {
+			return sess.send(stopReply(d.Step()))
+		}
+		return sess.resume()
+
+	case 'Z', 'z':
+		return sess.send(sess.setBreakpoint(command == 'Z', args))
+
+	case 'k':
+		return errKilled
+
+	case 'D':
+		d.Resume()
+		if err := sess.send("OK"); err != nil {
+			return err
+		}
+		return io.EOF
+
+	case 'H', 'T':
+		// There is only a single thread
+		return sess.send("OK")
+	}
+
+	switch {
+	case strings.HasPrefix(data, "qSupported"):
+		return sess.send("PacketSize=1000;QStartNoAckMode+")
+	case data == "QStartNoAckMode":
+		if err := sess.send("OK"); err != nil {
+			return err
+		}
+		sess.noAck = true
+		return nil
+	case data == "qAttached":
+		return sess.send("1")
+	case data == "qC":
+		return sess.send("QC1")
+	case data == "qfThreadInfo":
+		return sess.send("m1")
+	case data == "qsThreadInfo":
+		return sess.send("l")
+	}
+
+	// Empty response for unsupported packets
+	return sess.send("")
+}
+
+// Continue the execution until the debugger stops or the client interrupts.
+func (sess *session) resume() error {
+	d := sess.server.debugger
+	done := make(chan gb.StopEvent, 1)
+	go func() {
+		done <- d.Continue()
+	}()
+
+	packets := sess.packets
+	for {
+		select {
+		case event := <-done:
+			if packets == nil {
+				// The connection was closed while running
+				return sess.err
+			}
+			return sess.send(stopReply(event))
+		case p, ok := <-packets:
+			if !ok {
+				packets = nil
+				d.Interrupt()
+			} else if p.interrupt {
+				d.Interrupt()
+			}
+		}
+	}
+}
+
+// Add or remove a breakpoint or watchpoint from a Z or z packet. Returns the
+// reply to send to the client.
+func (sess *session) setBreakpoint(add bool, args string) string {
+	d := sess.server.debugger
+	parts := strings.SplitN(args, ",", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	address, length, err := parseRange(parts[1])
+	if err != nil {
+		return "E01"
+	}
+
+	var kind gb.WatchKind
+	switch parts[0] {
+	case "0", "1":
+		// Software and hardware breakpoints are treated the same
+		bp := gb.Breakpoint{Address: address, Bank: gb.AnyBank}
+		if add {
+			d.AddBreakpoint(bp)
+			return "OK"
+		}
+		for i, existing := range d.Breakpoints() {
+			if existing == bp {
+				d.RemoveBreakpoint(i)
+				return "OK"
+			}
+		}
+		return "E01"
+	case "2":
+		kind = gb.WatchWrite
+	case "3":
+		kind = gb.WatchRead
+	case "4":
+		kind = gb.WatchReadWrite
+	default:
+		return ""
+	}
+
+	if length < 1 {
+		length = 1
+	}
+	wp := gb.Watchpoint{Start: address, End: address + uint16(length-1), Kind: kind}
+	if add {
+		d.AddWatchpoint(wp)
+		return "OK"
+	}
+	for i, existing := range d.Watchpoints() {
+		if existing == wp {
+			d.RemoveWatchpoint(i)
+			return "OK"
+		}
+	}
+	return "E01"
+}
+
+// Get the stop reply packet for a stop event.
+func stopReply(event gb.StopEvent) string {
+	switch event.Reason {
+	case gb.StopInterrupted:
+		return "S02"
+	case gb.StopWatchpoint:
+		kind := map[gb.WatchKind]string{gb.WatchRead: "rwatch", gb.WatchWrite: "watch", gb.WatchReadWrite: "awatch"}
+		return fmt.Sprintf("T05%s:%04x;", kind[event.Watchpoint.Kind], event.Address)
+	default:
+		return "S05"
+	}
+}
+
+// Get the value of a register by its number.
+func getRegister(regs gb.Registers, reg int) uint16 {
+	switch reg {
+	case regAF:
+		return uint16(regs.A)<<8 | uint16(regs.F)
+	case regBC:
+		return uint16(regs.B)<<8 | uint16(regs.C)
+	case regDE:
+		return uint16(regs.D)<<8 | uint16(regs.E)
+	case regHL:
+		return uint16(regs.H)<<8 | uint16(regs.L)
+	case regSP:
+		return regs.SP
+	default:
+		return regs.PC
+	}
+}
+
+// Set the value of a register by its number.
+func setRegister(regs *gb.Registers, reg int, value uint16) {
+	hi, lo := byte(value>>8), byte(value)
+	switch reg {
+	case regAF:
+		regs.A, regs.F = hi, lo&0xF0
+	case regBC:
+		regs.B, regs.C = hi, lo
+	case regDE:
+		regs.D, regs.E = hi, lo
+	case regHL:
+		regs.H, regs.L = hi, lo
+	case regSP:
+		regs.SP = value
+	case regPC:
+		regs.PC = value
+	}
+}
+
+// Encode a register as little endian hex.
+func encodeRegister(value uint16) string {
+	return fmt.Sprintf("%02x%02x", byte(value), byte(value>>8))
+}
+
+// Decode a register from little endian hex.
+func decodeRegister(str string) (uint16, error) {
+	data, err := hex.DecodeString(str)
+	if err != nil || len(data) != 2 {
+		return 0, fmt.Errorf("invalid register value %q", str)
+	}
+	return uint16(data[1])<<8 | uint16(data[0]), nil
+}
+
+// Parse an address and length in the format addr,length.
+func parseRange(str string) (uint16, int, error) {
+	parts := strings.SplitN(str, ",", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid range %q", str)
+	}
+	address, err := strconv.ParseUint(parts[0], 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint16(address), int(length), nil
+}
+
+// Calculate the checksum of a packet.
+func sum(data string) byte {
+	var checksum byte
+	for i := 0; i < len(data); i++ {
+		checksum += data[i]
+	}
+	return checksum
+}
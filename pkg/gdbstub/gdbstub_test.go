@@ -0,0 +1,142 @@
+package gdbstub
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/Humpheh/goboy/pkg/gb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test client which talks to the server over a pipe.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Start a server for a rom and connect a test client to it. The channel
+// receives the error returned by Serve.
+func newTestClient(t *testing.T, rom string) (*testClient, *gb.Gameboy, chan error) {
+	gameboy, err := gb.New(rom)
+	require.NoError(t, err, "error in init gb %v", err)
+
+	server, client := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- New(gameboy).Serve(server)
+		server.Close()
+	}()
+	t.Cleanup(func() { client.Close() })
+	return &testClient{t: t, conn: client, r: bufio.NewReader(client)}, gameboy, done
+}
+
+// Send a packet and return the reply.
+func (c *testClient) request(data string) string {
+	c.send(data)
+	return c.reply()
+}
+
+// Send a packet to the server.
+func (c *testClient) send(data string) {
+	_, err := fmt.Fprintf(c.conn, "$%s#%02x", data, sum(data))
+	require.NoError(c.t, err)
+}
+
+// Read the next reply packet, skipping acknowledgements.
+func (c *testClient) reply() string {
+	for {
+		b, err := c.r.ReadByte()
+		require.NoError(c.t, err)
+		if b != '$' {
+			continue
+		}
+		data, err := c.r.ReadString('#')
+		require.NoError(c.t, err)
+		checksum := make([]byte, 2)
+		_, err = c.r.Read(checksum)
+		require.NoError(c.t, err)
+
+		data = strings.TrimSuffix(data, "#")
+		require.Equal(c.t, fmt.Sprintf("%02x", sum(data)), string(checksum), "invalid checksum")
+		return data
+	}
+}
+
+func TestServer_Registers(t *testing.T) {
+	client, gameboy, _ := newTestClient(t, "./../../roms/blargg/cpu_instrs.gb")
+
+	assert.Contains(t, client.request("qSupported:swbreak+"), "PacketSize")
+	assert.Equal(t, "S05", client.request("?"))
+
+	regs := gameboy.Debugger().Registers()
+	assert.Equal(t, fmt.Sprintf("%02x%02x", regs.F, regs.A), client.request("g")[:4])
+	assert.Equal(t, "0001", client.request("p5"), "PC should be 0x100")
+
+	assert.Equal(t, "OK", client.request("G"+"f012"+"3412"+"7856"+"bc9a"+"feff"+"5001"))
+	regs = gameboy.Debugger().Registers()
+	assert.Equal(t, gb.Registers{A: 0x12, F: 0xF0, B: 0x12, C: 0x34, D: 0x56, E: 0x78, H: 0x9A, L: 0xBC, SP: 0xFFFE, PC: 0x150, IME: regs.IME}, regs)
+
+	assert.Equal(t, "OK", client.request("P1=cdab"))
+	assert.Equal(t, "cdab", client.request("p1"))
+	assert.Equal(t, "E01", client.request("p9"))
+}
+
+func TestServer_Memory(t *testing.T) {
+	client, _, _ := newTestClient(t, "./../../roms/blargg/cpu_instrs.gb")
+
+	// Cartridge header title
+	assert.Equal(t, "4350555f494e53545253", client.request("m134,a"))
+
+	assert.Equal(t, "OK", client.request("Mc000,3:010203"))
+	assert.Equal(t, "010203", client.request("mc000,3"))
+	assert.Equal(t, "E01", client.request("Mc000,3:0102"))
+}
+
+func TestServer_BreakpointAndStep(t *testing.T) {
+	client, gameboy, _ := newTestClient(t, "./../../roms/blargg/cpu_instrs.gb")
+
+	// The entry point jumps to 0x637
+	assert.Equal(t, "S05", client.request("s"))
+	assert.Equal(t, "S05", client.request("s"))
+	assert.Equal(t, uint16(0x637), gameboy.Debugger().Registers().PC)
+
+	assert.Equal(t, "OK", client.request("Z0,459,1"))
+	assert.Equal(t, "S05", client.request("c"))
+	assert.Equal(t, "5904", client.request("p5"))
+
+	assert.Equal(t, "OK", client.request("z0,459,1"))
+	assert.Equal(t, "E01", client.request("z0,459,1"))
+
+	assert.Equal(t, "OK", client.request("Z2,ff01,1"))
+	assert.Equal(t, "T05watch:ff01;", client.request("c"))
+}
+
+func TestServer_Interrupt(t *testing.T) {
+	client, _, done := newTestClient(t, "./../../roms/blargg/cpu_instrs.gb")
+
+	client.send("c")
+	_, err := client.conn.Write([]byte{interruptByte})
+	require.NoError(t, err)
+	assert.Equal(t, "S02", client.reply())
+
+	client.send("k")
+	go io.Copy(io.Discard, client.r)
+	assert.Equal(t, errKilled, <-done)
+}
+
+func TestServer_Detach(t *testing.T) {
+	client, gameboy, done := newTestClient(t, "./../../roms/blargg/cpu_instrs.gb")
+
+	assert.Equal(t, "OK", client.request("QStartNoAckMode"))
+	assert.Equal(t, "OK", client.request("D"))
+	assert.NoError(t, <-done)
+
+	stopped, _ := gameboy.Debugger().Stopped()
+	assert.False(t, stopped, "debugger should resume on detach")
+}
@@ -0,0 +1,92 @@
+// Package headless provides a gb.IOBinding which runs the Gameboy without a
+// window, input devices or audio. It is useful for running ROMs on machines
+// without a display, such as CI servers running regression tests.
+package headless
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/Humpheh/goboy/pkg/gb"
+)
+
+// Binding is an IOBinding which keeps the last rendered frame in memory
+// instead of displaying it.
+type Binding struct {
+	frame     [gb.ScreenWidth][gb.ScreenHeight][3]uint8
+	frames    int
+	maxFrames int
+	stopped   bool
+}
+
+// New returns a new headless binding which will stop running after maxFrames
+// frames have been rendered. If maxFrames is 0 it will run until stopped.
+func New(maxFrames int) *Binding {
+	return &Binding{maxFrames: maxFrames}
+}
+
+// SetEnableVSync does nothing as there is no display to sync to.
+func (b *Binding) SetEnableVSync(bool) {}
+
+// Render stores the frame so it can be retrieved later.
+func (b *Binding) Render(screen *[160][144][3]uint8) {
+	b.frame = *screen
+	b.frames++
+}
+
+// ProcessButtonInput returns no input as there are no input devices.
+func (b *Binding) ProcessButtonInput() gb.ButtonInput {
+	return gb.ButtonInput{}
+}
+
+// SetTitle does nothing as there is no window.
+func (b *Binding) SetTitle(string) {}
+
+// IsRunning returns false once the binding has been stopped or the maximum
+// number of frames have been rendered.
+func (b *Binding) IsRunning() bool {
+	return !b.stopped && (b.maxFrames == 0 || b.frames < b.maxFrames)
+}
+
+// Stop stops the binding from running.
+func (b *Binding) Stop() {
+	b.stopped = true
+}
+
+// Frames returns the number of frames which have been rendered.
+func (b *Binding) Frames() int {
+	return b.frames
+}
+
+// Image returns the last rendered frame as an image.
+func (b *Binding) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, gb.ScreenWidth, gb.ScreenHeight))
+	for x := 0; x < gb.ScreenWidth; x++ {
+		for y := 0; y < gb.ScreenHeight; y++ {
+			col := b.frame[x][y]
+			img.SetRGBA(x, y, color.RGBA{R: col[0], G: col[1], B: col[2], A: 0xFF})
+		}
+	}
+	return img
+}
+
+// WritePNG encodes the last rendered frame as a PNG to a writer.
+func (b *Binding) WritePNG(w io.Writer) error {
+	return png.Encode(w, b.Image())
+}
+
+// SavePNG writes the last rendered frame to a PNG file.
+func (b *Binding) SavePNG(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := b.WritePNG(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
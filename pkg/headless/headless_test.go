@@ -0,0 +1,43 @@
+package headless
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Humpheh/goboy/pkg/gb"
+)
+
+func TestBinding_MaxFrames(t *testing.T) {
+	gameboy, err := gb.New("./../../roms/blargg/cpu_instrs.gb")
+	require.NoError(t, err, "error in init gb %v", err)
+
+	binding := New(10)
+	for binding.IsRunning() {
+		gameboy.ProcessInput(binding.ProcessButtonInput())
+		gameboy.Update()
+		binding.Render(&gameboy.PreparedData)
+	}
+	assert.Equal(t, 10, binding.Frames())
+
+	var buf bytes.Buffer
+	require.NoError(t, binding.WritePNG(&buf))
+	img, err := png.Decode(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, gb.ScreenWidth, img.Bounds().Dx())
+	assert.Equal(t, gb.ScreenHeight, img.Bounds().Dy())
+
+	r, g, b, _ := img.At(5, 7).RGBA()
+	col := gameboy.PreparedData[5][7]
+	assert.Equal(t, []uint32{uint32(col[0]), uint32(col[1]), uint32(col[2])}, []uint32{r >> 8, g >> 8, b >> 8})
+}
+
+func TestBinding_Stop(t *testing.T) {
+	binding := New(0)
+	assert.True(t, binding.IsRunning())
+	binding.Stop()
+	assert.False(t, binding.IsRunning())
+}
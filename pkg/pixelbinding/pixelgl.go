@@ -130,6 +130,8 @@ var keyMap = map[pixel.Button]gb.Button{
 	pixel.Key8:      gb.ButtonToggleSoundChannel2,
 	pixel.Key9:      gb.ButtonToggleSoundChannel3,
 	pixel.Key0:      gb.ButtonToggleSoundChannel4,
+	pixel.KeyF5:     gb.ButtonSaveState,
+	pixel.KeyF9:     gb.ButtonLoadState,
 }
 
 // ProcessButtonInput checks the input and process it.
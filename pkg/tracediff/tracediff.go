@@ -0,0 +1,123 @@
+// Package tracediff compares CPU execution traces in the "A:xx F:xx ...
+// PC:xxxx PCMEM:xx,xx,xx,xx" format written by gb.WithTraceWriter against a
+// reference log from another emulator, to find the first instruction where
+// the emulation diverges.
+package tracediff
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Divergence is the first instruction where two traces differ.
+type Divergence struct {
+	// Line is the number of the differing line in both traces, from 1.
+	Line int
+	// Expected and Actual are the differing lines. Actual is empty if the
+	// actual trace ended before the expected trace.
+	Expected string
+	Actual   string
+	// Previous is the last line which matched in the actual trace.
+	Previous string
+	// Fields which have different values, in the order of the expected line.
+	Fields []string
+}
+
+func (d Divergence) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "traces diverge at line %v", d.Line)
+	if len(d.Fields) > 0 {
+		fmt.Fprintf(&b, " (%v)", strings.Join(d.Fields, ", "))
+	}
+	if d.Previous != "" {
+		fmt.Fprintf(&b, "\n  previous: %s", d.Previous)
+	}
+	fmt.Fprintf(&b, "\n  expected: %s", d.Expected)
+	if d.Actual == "" {
+		b.WriteString("\n  actual:   <end of trace>")
+	} else {
+		fmt.Fprintf(&b, "\n  actual:   %s", d.Actual)
+	}
+	return b.String()
+}
+
+// A field in a trace line.
+type field struct {
+	name, value string
+}
+
+// Compare reads two traces line by line and returns the first line where
+// they differ, or nil if they match. Only fields which are in both lines are
+// compared, and any fields named in ignore are skipped. Values are compared
+// case insensitively and anything after a ';' on a line is ignored. If the
+// expected trace ends first, the rest of the actual trace is not checked.
+func Compare(expected, actual io.Reader, ignore ...string) (*Divergence, error) {
+	skip := map[string]bool{}
+	for _, name := range ignore {
+		skip[strings.ToUpper(name)] = true
+	}
+
+	expScanner := bufio.NewScanner(expected)
+	actScanner := bufio.NewScanner(actual)
+	var previous string
+	for line := 1; expScanner.Scan(); line++ {
+		expLine := expScanner.Text()
+		if !actScanner.Scan() {
+			if err := actScanner.Err(); err != nil {
+				return nil, fmt.Errorf("reading actual trace: %v", err)
+			}
+			return &Divergence{Line: line, Expected: expLine, Previous: previous}, nil
+		}
+		actLine := actScanner.Text()
+
+		if fields := compareLine(expLine, actLine, skip); len(fields) > 0 {
+			return &Divergence{
+				Line:     line,
+				Expected: expLine,
+				Actual:   actLine,
+				Previous: previous,
+				Fields:   fields,
+			}, nil
+		}
+		previous = actLine
+	}
+	if err := expScanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading expected trace: %v", err)
+	}
+	return nil, nil
+}
+
+// Compare the fields of two lines and return the names of the fields which
+// have different values.
+func compareLine(expected, actual string, skip map[string]bool) []string {
+	actFields := map[string]string{}
+	for _, f := range parseLine(actual) {
+		actFields[f.name] = f.value
+	}
+	var diff []string
+	for _, f := range parseLine(expected) {
+		value, ok := actFields[f.name]
+		if ok && !skip[f.name] && !strings.EqualFold(value, f.value) {
+			diff = append(diff, f.name)
+		}
+	}
+	return diff
+}
+
+// Parse the NAME:VALUE fields from a trace line.
+func parseLine(line string) []field {
+	if i := strings.IndexByte(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+	var fields []field
+	for _, token := range strings.Fields(line) {
+		parts := strings.SplitN(token, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fields = append(fields, field{name: strings.ToUpper(parts[0]), value: parts[1]})
+	}
+	return fields
+}
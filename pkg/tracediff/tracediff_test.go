@@ -0,0 +1,52 @@
+package tracediff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const reference = `A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0100 PCMEM:00,C3,13,02
+A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0101 PCMEM:C3,13,02,CE
+A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0213 PCMEM:C3,17,02,F5
+`
+
+func TestCompare_Match(t *testing.T) {
+	actual := strings.ToLower(reference) + "A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0217 PCMEM:F5,00,00,00\n"
+	divergence, err := Compare(strings.NewReader(reference), strings.NewReader(actual))
+	require.NoError(t, err)
+	assert.Nil(t, divergence, "extra lines in the actual trace are ignored")
+}
+
+func TestCompare_Diverge(t *testing.T) {
+	actual := strings.Replace(reference, "F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0213", "F:80 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0214", 1)
+	divergence, err := Compare(strings.NewReader(reference), strings.NewReader(actual))
+	require.NoError(t, err)
+	require.NotNil(t, divergence)
+	assert.Equal(t, 3, divergence.Line)
+	assert.Equal(t, []string{"F", "PC"}, divergence.Fields)
+	assert.Contains(t, divergence.Previous, "PC:0101")
+
+	divergence, err = Compare(strings.NewReader(reference), strings.NewReader(actual), "f", "PC")
+	require.NoError(t, err)
+	assert.Nil(t, divergence, "ignored fields are not compared")
+}
+
+func TestCompare_Ended(t *testing.T) {
+	lines := strings.SplitAfter(reference, "\n")
+	divergence, err := Compare(strings.NewReader(reference), strings.NewReader(lines[0]))
+	require.NoError(t, err)
+	require.NotNil(t, divergence)
+	assert.Equal(t, 2, divergence.Line)
+	assert.Equal(t, "", divergence.Actual)
+	assert.Contains(t, divergence.String(), "<end of trace>")
+}
+
+func TestCompare_Comments(t *testing.T) {
+	actual := strings.Replace(reference, "PCMEM:00,C3,13,02", "PCMEM:00,C3,13,02 ; NOP", 1)
+	divergence, err := Compare(strings.NewReader(reference), strings.NewReader(actual))
+	require.NoError(t, err)
+	assert.Nil(t, divergence)
+}